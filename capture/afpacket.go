@@ -0,0 +1,32 @@
+package capture
+
+const (
+	// BackendPcap captures packets with libpcap. It is the default backend.
+	BackendPcap = "pcap"
+	// BackendAFPacket captures packets with AF_PACKET (TPACKET_V3)
+	// ring buffers. It is only available on Linux.
+	BackendAFPacket = "afpacket"
+)
+
+const (
+	// DefaultAFPacketBlockSize is the default size in bytes of
+	// each block of an afpacket ring buffer.
+	DefaultAFPacketBlockSize = 4096 * 128
+	// DefaultAFPacketNumBlocks is the default number of blocks
+	// in an afpacket ring buffer.
+	DefaultAFPacketNumBlocks = 128
+)
+
+// AFPacketOptions configures the afpacket backend.
+type AFPacketOptions struct {
+	// BlockSize is the size in bytes of each ring buffer block.
+	// It must be a multiple of the page size.
+	BlockSize int
+	// NumBlocks is the number of blocks in each ring buffer.
+	NumBlocks int
+	// Fanout is the number of sockets opened for each interface.
+	// When greater than one, the sockets join a fanout group and
+	// the kernel balances packets between them by flow, with each
+	// socket read by its own goroutine.
+	Fanout int
+}
@@ -0,0 +1,312 @@
+//go:build linux
+// +build linux
+
+package capture
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/rename-this/vhs/core"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// afpacketPollTimeout is how long a read waits for a
+	// block when the capture has no timeout.
+	afpacketPollTimeout = 100 * time.Millisecond
+
+	// afpacketImmediateTimeout is the shortest block timeout,
+	// used when the capture has no timeout so that packets
+	// are delivered as soon as possible.
+	afpacketImmediateTimeout = time.Millisecond
+)
+
+// NewAFPacketListener creates a listener that captures packets
+// with AF_PACKET ring buffers instead of libpcap. The capture's
+// buffer size, if set, sizes each ring in whole blocks, and its
+// timeout is the time after which a block that is not full is
+// delivered.
+func NewAFPacketListener(cap *Capture, opts AFPacketOptions) (Listener, error) {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = DefaultAFPacketBlockSize
+	}
+	if opts.NumBlocks <= 0 {
+		opts.NumBlocks = DefaultAFPacketNumBlocks
+	}
+	if opts.Fanout <= 0 {
+		opts.Fanout = 1
+	}
+
+	if opts.BlockSize%os.Getpagesize() != 0 {
+		return nil, fmt.Errorf("afpacket block size %d is not a multiple of the page size %d", opts.BlockSize, os.Getpagesize())
+	}
+
+	if cap.Timeout > 0 && cap.Timeout < time.Millisecond {
+		return nil, fmt.Errorf("afpacket timeout %s is less than 1ms", cap.Timeout)
+	}
+
+	if cap.BufferSize > 0 {
+		opts.NumBlocks = (cap.BufferSize + opts.BlockSize - 1) / opts.BlockSize
+	}
+
+	return &afpacketListener{
+		listener: &listener{
+			Capture: cap,
+			packets: make(chan gopacket.Packet),
+		},
+		opts: opts,
+	}, nil
+}
+
+type afpacketListener struct {
+	*listener
+
+	opts AFPacketOptions
+
+	tpacketsMu sync.Mutex
+	tpackets   []*afpacket.TPacket
+
+	// promiscFds are the sockets that hold
+	// interfaces in promiscuous mode.
+	promiscFds []int
+}
+
+// Listen starts listening.
+func (l *afpacketListener) Listen(ctx core.Context) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "afpacket_listener").
+		Logger()
+
+	go l.stats.run(ctx)
+
+	for n, i := range l.Capture.Interfaces {
+		linkType, err := interfaceLinkType(i.Name)
+		if err != nil {
+			ctx.Errors <- err
+			continue
+		}
+
+		// Like libpcap, the any device cannot
+		// be put in promiscuous mode.
+		if l.Capture.Promiscuous && i.Name != AnyDevice {
+			if err := l.setPromiscuous(i.Name); err != nil {
+				ctx.Errors <- err
+				continue
+			}
+		}
+
+		// Fanout groups are scoped to an interface, so each
+		// interface gets a group of its own.
+		group := uint16(os.Getpid() + n)
+		for f := 0; f < l.opts.Fanout; f++ {
+			tp, err := l.newTPacket(ctx, i, linkType, group)
+			if err != nil {
+				ctx.Errors <- err
+				continue
+			}
+			go l.readPackets(ctx, tp, linkType)
+		}
+	}
+}
+
+func (l *afpacketListener) newTPacket(ctx core.Context, i pcap.Interface, linkType layers.LinkType, group uint16) (*afpacket.TPacket, error) {
+	ctx.Logger = ctx.Logger.With().
+		Interface("interface", i).
+		Logger()
+
+	ctx.Logger.Debug().Msg("creating new tpacket")
+
+	var (
+		blockTimeout = afpacketImmediateTimeout
+		pollTimeout  = afpacketPollTimeout
+	)
+	if l.Capture.Timeout > 0 {
+		blockTimeout = l.Capture.Timeout
+		pollTimeout = l.Capture.Timeout
+	}
+
+	opts := []interface{}{
+		afpacket.OptFrameSize(afpacket.DefaultFrameSize),
+		afpacket.OptBlockSize(l.opts.BlockSize),
+		afpacket.OptNumBlocks(l.opts.NumBlocks),
+		afpacket.OptBlockTimeout(blockTimeout),
+		afpacket.OptPollTimeout(pollTimeout),
+		afpacket.TPacketVersion3,
+	}
+
+	// Link layer headers other than Ethernet are
+	// removed, leaving the IP packet.
+	if linkType == layers.LinkTypeRaw {
+		opts = append(opts, afpacket.SocketDgram)
+	}
+
+	// The any device is not a real interface. Leaving the
+	// interface unset captures from all interfaces instead.
+	if i.Name != AnyDevice {
+		opts = append(opts, afpacket.OptInterface(i.Name))
+	}
+
+	tp, err := afpacket.NewTPacket(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tpacket for %s: %w", i.Name, err)
+	}
+
+	filter := newBPFFilter(l.Capture, i)
+	ctx.Logger.Debug().Str("filter", filter).Msg("bpf filter created")
+
+	if err := setTPacketFilter(tp, filter, linkType, l.Capture.SnapLen); err != nil {
+		tp.Close()
+		return nil, fmt.Errorf("failed to set filter: %w", err)
+	}
+
+	if l.opts.Fanout > 1 {
+		if err := tp.SetFanout(afpacket.FanoutHashWithDefrag, group); err != nil {
+			tp.Close()
+			return nil, fmt.Errorf("failed to join fanout group %d: %w", group, err)
+		}
+	}
+
+	l.tpacketsMu.Lock()
+	l.tpackets = append(l.tpackets, tp)
+	l.tpacketsMu.Unlock()
+
+	l.stats.add(i.Name, tpacketStats(tp))
+
+	return tp, nil
+}
+
+// interfaceLinkType gets the link type of the packets captured
+// from an interface. Ethernet frames are captured whole. Packets
+// from other interfaces, whose link layers vary, and from the any
+// device, which spans interfaces, are captured as IP packets.
+func interfaceLinkType(name string) (layers.LinkType, error) {
+	if name == AnyDevice {
+		return layers.LinkTypeRaw, nil
+	}
+
+	b, err := ioutil.ReadFile(fmt.Sprintf("/sys/class/net/%s/type", name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get hardware type of %s: %w", name, err)
+	}
+
+	hwType, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse hardware type of %s: %w", name, err)
+	}
+
+	return hardwareLinkType(hwType), nil
+}
+
+// hardwareLinkType maps an ARPHRD hardware type to a link type.
+// Loopback interfaces on Linux have Ethernet headers.
+func hardwareLinkType(hwType int) layers.LinkType {
+	switch hwType {
+	case unix.ARPHRD_ETHER, unix.ARPHRD_LOOPBACK:
+		return layers.LinkTypeEthernet
+	default:
+		return layers.LinkTypeRaw
+	}
+}
+
+// setPromiscuous puts an interface in promiscuous mode until the
+// listener is closed. The mode is held by a socket that captures
+// nothing, since the kernel counts promiscuous memberships and
+// drops them when their socket is closed.
+func (l *afpacketListener) setPromiscuous(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return fmt.Errorf("failed to find interface %s: %w", name, err)
+	}
+
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_RAW, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open socket for %s: %w", name, err)
+	}
+
+	mreq := &unix.PacketMreq{
+		Ifindex: int32(iface.Index),
+		Type:    unix.PACKET_MR_PROMISC,
+	}
+	if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP, mreq); err != nil {
+		unix.Close(fd)
+		return fmt.Errorf("failed to set promiscuous mode on %s: %w", name, err)
+	}
+
+	l.tpacketsMu.Lock()
+	l.promiscFds = append(l.promiscFds, fd)
+	l.tpacketsMu.Unlock()
+
+	return nil
+}
+
+// setTPacketFilter compiles a BPF expression with
+// libpcap and attaches it to the socket.
+func setTPacketFilter(tp *afpacket.TPacket, filter string, linkType layers.LinkType, snapLen int) error {
+	if filter == "" {
+		return nil
+	}
+
+	if snapLen <= 0 {
+		snapLen = DefaultSnapLen
+	}
+
+	instructions, err := pcap.CompileBPFFilter(linkType, snapLen, filter)
+	if err != nil {
+		return err
+	}
+
+	raw := make([]bpf.RawInstruction, len(instructions))
+	for n, i := range instructions {
+		raw[n] = bpf.RawInstruction{
+			Op: i.Code,
+			Jt: i.Jt,
+			Jf: i.Jf,
+			K:  i.K,
+		}
+	}
+
+	return tp.SetBPF(raw)
+}
+
+// tpacketStats collects socket statistics. AF_PACKET
+// sockets do not report interface drops.
+func tpacketStats(tp *afpacket.TPacket) statsFn {
+	return func() (handleStats, error) {
+		_, s, err := tp.SocketStats()
+		if err != nil {
+			return handleStats{}, err
+		}
+		return handleStats{
+			Received: uint64(s.Packets()),
+			Dropped:  uint64(s.Drops()),
+		}, nil
+	}
+}
+
+// Close closes the listener and all open sockets.
+func (l *afpacketListener) Close() {
+	l.stats.close()
+
+	l.tpacketsMu.Lock()
+	defer l.tpacketsMu.Unlock()
+
+	for _, tp := range l.tpackets {
+		tp.Close()
+	}
+
+	for _, fd := range l.promiscFds {
+		unix.Close(fd)
+	}
+}
@@ -0,0 +1,123 @@
+//go:build linux
+// +build linux
+
+package capture
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewAFPacketListener(t *testing.T) {
+	cases := []struct {
+		desc        string
+		capture     Capture
+		opts        AFPacketOptions
+		expected    AFPacketOptions
+		errContains string
+	}{
+		{
+			desc: "defaults",
+			expected: AFPacketOptions{
+				BlockSize: DefaultAFPacketBlockSize,
+				NumBlocks: DefaultAFPacketNumBlocks,
+				Fanout:    1,
+			},
+		},
+		{
+			desc: "custom",
+			opts: AFPacketOptions{
+				BlockSize: os.Getpagesize() * 256,
+				NumBlocks: 64,
+				Fanout:    4,
+			},
+			expected: AFPacketOptions{
+				BlockSize: os.Getpagesize() * 256,
+				NumBlocks: 64,
+				Fanout:    4,
+			},
+		},
+		{
+			desc: "buffer size",
+			capture: Capture{
+				BufferSize: DefaultAFPacketBlockSize*8 + 1,
+			},
+			opts: AFPacketOptions{
+				NumBlocks: 64,
+			},
+			expected: AFPacketOptions{
+				BlockSize: DefaultAFPacketBlockSize,
+				NumBlocks: 9,
+				Fanout:    1,
+			},
+		},
+		{
+			desc: "timeout too short",
+			capture: Capture{
+				Timeout: time.Microsecond,
+			},
+			errContains: "less than 1ms",
+		},
+		{
+			desc: "block size not page aligned",
+			opts: AFPacketOptions{
+				BlockSize: os.Getpagesize() + 1,
+			},
+			errContains: "not a multiple of the page size",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			l, err := NewAFPacketListener(&c.capture, c.opts)
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, c.expected, l.(*afpacketListener).opts)
+		})
+	}
+}
+
+func TestInterfaceLinkType(t *testing.T) {
+	linkType, err := interfaceLinkType(AnyDevice)
+	assert.NilError(t, err)
+	assert.Equal(t, layers.LinkTypeRaw, linkType)
+
+	_, err = interfaceLinkType("nosuchinterface0")
+	assert.ErrorContains(t, err, "failed to get hardware type of nosuchinterface0")
+}
+
+func TestHardwareLinkType(t *testing.T) {
+	cases := []struct {
+		desc     string
+		hwType   int
+		linkType layers.LinkType
+	}{
+		{
+			desc:     "ethernet",
+			hwType:   unix.ARPHRD_ETHER,
+			linkType: layers.LinkTypeEthernet,
+		},
+		{
+			desc:     "loopback",
+			hwType:   unix.ARPHRD_LOOPBACK,
+			linkType: layers.LinkTypeEthernet,
+		},
+		{
+			desc:     "tunnel",
+			hwType:   unix.ARPHRD_NONE,
+			linkType: layers.LinkTypeRaw,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.linkType, hardwareLinkType(c.hwType))
+		})
+	}
+}
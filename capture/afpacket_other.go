@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package capture
+
+import "errors"
+
+// NewAFPacketListener is not supported on this platform.
+func NewAFPacketListener(_ *Capture, _ AFPacketOptions) (Listener, error) {
+	return nil, errors.New("afpacket capture is only supported on linux")
+}
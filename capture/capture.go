@@ -3,6 +3,9 @@ package capture
 import (
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/gopacket/pcap"
 )
@@ -10,6 +13,9 @@ import (
 const (
 	// DefaultAddr is the default capture address.
 	DefaultAddr = "0.0.0.0:80"
+	// DefaultSnapLen is the default maximum number
+	// of bytes captured from each packet.
+	DefaultSnapLen = 65536
 )
 
 // Type represents the type of device.
@@ -24,65 +30,227 @@ const (
 	CaptureLoopback
 	// CaptureAll represents all interfaces (e.g. 0.0.0.0).
 	CaptureAll
+	// CaptureInterface is an interface name (e.g. eth0).
+	CaptureInterface
+	// CaptureAny is the pcap "any" device, which captures
+	// from all interfaces at once.
+	CaptureAny
+	// CaptureNet is a network in CIDR notation (e.g. 10.0.0.0/8).
+	CaptureNet
+)
+
+// AnyDevice is the name of the pcap device that
+// captures from all interfaces.
+const AnyDevice = "any"
+
+const (
+	// ProtocolTCP captures TCP.
+	ProtocolTCP = "tcp"
+	// ProtocolUDP captures UDP.
+	ProtocolUDP = "udp"
 )
 
 // Capture represents an intent to capture traffic.
 type Capture struct {
-	Host       string
-	Port       string
-	DeviceType Type
+	Addrs      []Addr
 	Interfaces []pcap.Interface
 
+	// Filter is an additional BPF expression that is
+	// ANDed with the filter generated for each interface.
+	Filter string
+
+	// Protocol is the transport protocol to capture.
+	// An empty protocol captures TCP.
+	Protocol string
+
 	Response bool
+
+	// Egress captures outbound calls from this host. Addrs
+	// are then the remote servers being called rather than
+	// local addresses that accept connections.
+	Egress bool
+
+	// SnapLen is the maximum number of bytes captured from each packet.
+	SnapLen int
+	// BufferSize is the size in bytes of the kernel capture
+	// buffer. Zero leaves the libpcap default in place.
+	BufferSize int
+	// Promiscuous captures traffic not addressed to this host.
+	Promiscuous bool
+	// Timeout is how long packets are buffered before they are
+	// delivered. Zero delivers each packet immediately.
+	Timeout time.Duration
+}
+
+// Addr is a single address on which traffic is captured.
+type Addr struct {
+	Host       string
+	Ports      PortRange
+	DeviceType Type
+}
+
+func (a Addr) matches(i pcap.Interface, egress bool) bool {
+	if egress && !a.isNamed() {
+		// Remote servers may be reached through any interface.
+		return len(i.Addresses) > 0
+	}
+
+	switch a.DeviceType {
+	case CaptureLoopback:
+		return true
+	case CaptureAll:
+		return len(i.Addresses) > 0
+	case CaptureInterface, CaptureAny:
+		return i.Name == a.Host
+	case CaptureNet:
+		_, network, err := net.ParseCIDR(a.Host)
+		if err != nil {
+			return false
+		}
+		for _, address := range i.Addresses {
+			if network.Contains(address.IP) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if i.Name == a.Host {
+		return true
+	}
+
+	for _, address := range i.Addresses {
+		if address.IP.String() == a.Host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isNamed determines if an address refers to an interface by name.
+func (a Addr) isNamed() bool {
+	return a.DeviceType == CaptureInterface || a.DeviceType == CaptureAny
+}
+
+// PortRange is an inclusive range of ports. A single
+// port is a range where First and Last are equal.
+type PortRange struct {
+	First int
+	Last  int
+}
+
+// Contains determines if a port is within the range.
+func (r PortRange) Contains(port int) bool {
+	return port >= r.First && port <= r.Last
+}
+
+func (r PortRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(r.First)
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
 }
 
 type getAllInterfacesFn func() ([]pcap.Interface, error)
 
-// NewCapture creates a new capture.
-func NewCapture(addr string, response bool) (*Capture, error) {
-	return newCapture(addr, response, pcap.FindAllDevs)
+// NewCapture creates a new capture. addrs is a comma-separated
+// list of addresses, each of which may specify a single port
+// or a range of ports (e.g. 0.0.0.0:8080,0.0.0.0:9000-9010).
+func NewCapture(addrs string, response, egress bool) (*Capture, error) {
+	return newCapture(addrs, response, egress, pcap.FindAllDevs)
 }
 
-func newCapture(addr string, response bool, fn getAllInterfacesFn) (*Capture, error) {
+func newCapture(addrs string, response, egress bool, fn getAllInterfacesFn) (*Capture, error) {
 	interfaces, err := fn()
 	if err != nil {
 		return nil, fmt.Errorf("failed to find interfaces: %w", err)
 	}
 
-	host, port := splitHostPort(addr)
-	deviceType, err := getCaptureType(host)
+	parsed, err := ParseAddrs(addrs)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get device type: %w", err)
+		return nil, err
+	}
+
+	if err := findNamedInterfaces(parsed, interfaces); err != nil {
+		return nil, err
 	}
 
 	return &Capture{
-		Host:       host,
-		Port:       port,
-		DeviceType: deviceType,
-		Response:   response,
-		Interfaces: selectInterfaces(host, deviceType, interfaces),
+		Addrs:       parsed,
+		Protocol:    ProtocolTCP,
+		Response:    response,
+		Egress:      egress,
+		Interfaces:  selectInterfaces(parsed, egress, interfaces),
+		SnapLen:     DefaultSnapLen,
+		Promiscuous: true,
 	}, nil
 }
 
-func selectInterfaces(host string, deviceType Type, interfaces []pcap.Interface) []pcap.Interface {
-	if deviceType == CaptureLoopback {
-		return interfaces
+// findNamedInterfaces ensures that every interface
+// addressed by name exists.
+func findNamedInterfaces(addrs []Addr, interfaces []pcap.Interface) error {
+	for _, a := range addrs {
+		if !a.isNamed() {
+			continue
+		}
+
+		found := false
+		for _, i := range interfaces {
+			if a.matches(i, false) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("interface not found: %s", a.Host)
+		}
 	}
 
-	var filtered []pcap.Interface
-	for _, i := range interfaces {
-		if deviceType == CaptureAll && len(i.Addresses) > 0 {
-			filtered = append(filtered, i)
-			continue
+	return nil
+}
+
+// ParseAddrs parses a comma-separated list of capture addresses.
+func ParseAddrs(addrs string) ([]Addr, error) {
+	var parsed []Addr
+	for _, addr := range strings.Split(addrs, ",") {
+		host, port := splitHostPort(strings.TrimSpace(addr))
+
+		deviceType, err := getCaptureType(host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get device type: %w", err)
 		}
 
-		if i.Name == host {
-			return []pcap.Interface{i}
+		if deviceType == CaptureNet {
+			// Use the canonical form of the network since BPF
+			// rejects networks with host bits set.
+			_, network, _ := net.ParseCIDR(host)
+			host = network.String()
 		}
 
-		for _, address := range i.Addresses {
-			if address.IP.String() == host {
-				return []pcap.Interface{i}
+		ports, err := parsePortRange(port)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, Addr{
+			Host:       host,
+			Ports:      ports,
+			DeviceType: deviceType,
+		})
+	}
+
+	return parsed, nil
+}
+
+func selectInterfaces(addrs []Addr, egress bool, interfaces []pcap.Interface) []pcap.Interface {
+	var filtered []pcap.Interface
+	for _, i := range interfaces {
+		for _, a := range addrs {
+			if a.matches(i, egress) {
+				filtered = append(filtered, i)
+				break
 			}
 		}
 	}
@@ -101,10 +269,29 @@ func getCaptureType(host string) (Type, error) {
 	if ip != nil {
 		return CaptureIP, nil
 	}
+	if host == AnyDevice {
+		return CaptureAny, nil
+	}
+	if _, _, err := net.ParseCIDR(host); err == nil {
+		return CaptureNet, nil
+	}
+	if isInterfaceName(host) {
+		return CaptureInterface, nil
+	}
 
 	return CaptureInvalid, fmt.Errorf("invalid address: %s", host)
 }
 
+// isInterfaceName determines if a host could be an interface
+// name. Hosts made up only of digits, dots, and colons are
+// malformed IP addresses rather than names.
+func isInterfaceName(host string) bool {
+	if host == "" {
+		return false
+	}
+	return strings.Trim(host, "0123456789.:") != "" && !strings.ContainsAny(host, "/ ")
+}
+
 func splitHostPort(addr string) (string, string) {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
@@ -113,3 +300,35 @@ func splitHostPort(addr string) (string, string) {
 	}
 	return host, port
 }
+
+func parsePortRange(port string) (PortRange, error) {
+	var (
+		parts = strings.SplitN(port, "-", 2)
+		r     PortRange
+		err   error
+	)
+
+	if r.First, err = parsePort(parts[0]); err != nil {
+		return PortRange{}, fmt.Errorf("invalid port: %s", port)
+	}
+
+	r.Last = r.First
+	if len(parts) == 2 {
+		if r.Last, err = parsePort(parts[1]); err != nil || r.Last < r.First {
+			return PortRange{}, fmt.Errorf("invalid port: %s", port)
+		}
+	}
+
+	return r, nil
+}
+
+func parsePort(port string) (int, error) {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 65535 {
+		return 0, fmt.Errorf("port out of range: %d", p)
+	}
+	return p, nil
+}
@@ -13,6 +13,7 @@ func TestNewCapture(t *testing.T) {
 	cases := []struct {
 		desc        string
 		addr        string
+		egress      bool
 		fn          getAllInterfacesFn
 		capture     *Capture
 		errContains string
@@ -31,9 +32,13 @@ func TestNewCapture(t *testing.T) {
 				}, nil
 			},
 			capture: &Capture{
-				Host:       "1.1.1.1",
-				Port:       "1111",
-				DeviceType: CaptureIP,
+				Addrs: []Addr{
+					{
+						Host:       "1.1.1.1",
+						Ports:      PortRange{First: 1111, Last: 1111},
+						DeviceType: CaptureIP,
+					},
+				},
 				Interfaces: []pcap.Interface{
 					{
 						Name: "111",
@@ -42,6 +47,66 @@ func TestNewCapture(t *testing.T) {
 						},
 					},
 				},
+				Protocol:    ProtocolTCP,
+				SnapLen:     DefaultSnapLen,
+				Promiscuous: true,
+			},
+		},
+		{
+			desc: "multiple addrs",
+			addr: "1.1.1.1:1111,2.2.2.2:2000-2010",
+			fn: func() ([]pcap.Interface, error) {
+				return []pcap.Interface{
+					{
+						Name: "111",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("1.1.1.1")},
+						},
+					},
+					{
+						Name: "222",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("2.2.2.2")},
+						},
+					},
+					{
+						Name: "333",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("3.3.3.3")},
+						},
+					},
+				}, nil
+			},
+			capture: &Capture{
+				Addrs: []Addr{
+					{
+						Host:       "1.1.1.1",
+						Ports:      PortRange{First: 1111, Last: 1111},
+						DeviceType: CaptureIP,
+					},
+					{
+						Host:       "2.2.2.2",
+						Ports:      PortRange{First: 2000, Last: 2010},
+						DeviceType: CaptureIP,
+					},
+				},
+				Interfaces: []pcap.Interface{
+					{
+						Name: "111",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("1.1.1.1")},
+						},
+					},
+					{
+						Name: "222",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("2.2.2.2")},
+						},
+					},
+				},
+				Protocol:    ProtocolTCP,
+				SnapLen:     DefaultSnapLen,
+				Promiscuous: true,
 			},
 		},
 		{
@@ -60,10 +125,100 @@ func TestNewCapture(t *testing.T) {
 			},
 			errContains: "invalid address: 1.1.1",
 		},
+		{
+			desc: "interface name",
+			addr: "eth0:80",
+			fn: func() ([]pcap.Interface, error) {
+				return []pcap.Interface{
+					{Name: "lo"},
+					{Name: "eth0"},
+				}, nil
+			},
+			capture: &Capture{
+				Addrs: []Addr{
+					{
+						Host:       "eth0",
+						Ports:      PortRange{First: 80, Last: 80},
+						DeviceType: CaptureInterface,
+					},
+				},
+				Interfaces: []pcap.Interface{
+					{Name: "eth0"},
+				},
+				Protocol:    ProtocolTCP,
+				SnapLen:     DefaultSnapLen,
+				Promiscuous: true,
+			},
+		},
+		{
+			desc:   "egress",
+			addr:   "9.9.9.9:443",
+			egress: true,
+			fn: func() ([]pcap.Interface, error) {
+				return []pcap.Interface{
+					{
+						Name: "111",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("1.1.1.1")},
+						},
+					},
+					{Name: "222"},
+				}, nil
+			},
+			capture: &Capture{
+				Addrs: []Addr{
+					{
+						Host:       "9.9.9.9",
+						Ports:      PortRange{First: 443, Last: 443},
+						DeviceType: CaptureIP,
+					},
+				},
+				Egress: true,
+				Interfaces: []pcap.Interface{
+					{
+						Name: "111",
+						Addresses: []pcap.InterfaceAddress{
+							{IP: net.ParseIP("1.1.1.1")},
+						},
+					},
+				},
+				Protocol:    ProtocolTCP,
+				SnapLen:     DefaultSnapLen,
+				Promiscuous: true,
+			},
+		},
+		{
+			desc: "interface not found",
+			addr: "eth1:80",
+			fn: func() ([]pcap.Interface, error) {
+				return []pcap.Interface{
+					{Name: "eth0"},
+				}, nil
+			},
+			errContains: "interface not found: eth1",
+		},
+		{
+			desc: "any device not found",
+			addr: "any:80",
+			fn: func() ([]pcap.Interface, error) {
+				return []pcap.Interface{
+					{Name: "eth0"},
+				}, nil
+			},
+			errContains: "interface not found: any",
+		},
+		{
+			desc: "fail to parse port",
+			addr: "1.1.1.1:1111,1.1.1.1:2222-2000",
+			fn: func() ([]pcap.Interface, error) {
+				return nil, nil
+			},
+			errContains: "invalid port: 2222-2000",
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
-			capture, err := newCapture(c.addr, false, c.fn)
+			capture, err := newCapture(c.addr, false, c.egress, c.fn)
 			if err != nil {
 				assert.ErrorContains(t, err, c.errContains)
 				return
@@ -110,12 +265,38 @@ func TestGeCaptureType(t *testing.T) {
 			device:     "1.1.1.1",
 			deviceType: CaptureIP,
 		},
+		{
+			desc:       "interface name",
+			device:     "eth0",
+			deviceType: CaptureInterface,
+		},
+		{
+			desc:       "any device",
+			device:     "any",
+			deviceType: CaptureAny,
+		},
+		{
+			desc:       "IPv4 CIDR",
+			device:     "10.0.0.0/8",
+			deviceType: CaptureNet,
+		},
+		{
+			desc:       "IPv6 CIDR",
+			device:     "fd00::/8",
+			deviceType: CaptureNet,
+		},
 		{
 			desc:        "invalid",
 			device:      "1111",
 			deviceType:  CaptureInvalid,
 			errContains: "invalid address",
 		},
+		{
+			desc:        "invalid CIDR",
+			device:      "10.0.0.0/33",
+			deviceType:  CaptureInvalid,
+			errContains: "invalid address",
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
@@ -131,15 +312,14 @@ func TestGeCaptureType(t *testing.T) {
 func TestSelectInterfaces(t *testing.T) {
 	cases := []struct {
 		desc               string
-		value              string
-		deviceType         Type
+		addrs              []Addr
+		egress             bool
 		interfaces         []pcap.Interface
 		expectedInterfaces []pcap.Interface
 	}{
 		{
-			desc:       "loopback",
-			value:      "::1",
-			deviceType: CaptureLoopback,
+			desc:  "loopback",
+			addrs: []Addr{{Host: "::1", DeviceType: CaptureLoopback}},
 			interfaces: []pcap.Interface{
 				{Name: "111"},
 				{Name: "222"},
@@ -152,18 +332,16 @@ func TestSelectInterfaces(t *testing.T) {
 			},
 		},
 		{
-			desc:       "all with no addresses",
-			value:      "::",
-			deviceType: CaptureAll,
+			desc:  "all with no addresses",
+			addrs: []Addr{{Host: "::", DeviceType: CaptureAll}},
 			interfaces: []pcap.Interface{
 				{Name: "111"},
 			},
 			expectedInterfaces: nil,
 		},
 		{
-			desc:       "all with addresses",
-			value:      "::",
-			deviceType: CaptureAll,
+			desc:  "all with addresses",
+			addrs: []Addr{{Host: "::", DeviceType: CaptureAll}},
 			interfaces: []pcap.Interface{
 				{
 					Name: "111",
@@ -197,9 +375,8 @@ func TestSelectInterfaces(t *testing.T) {
 			},
 		},
 		{
-			desc:       "single address match name",
-			value:      "1.1.1.1",
-			deviceType: CaptureIP,
+			desc:  "single address match name",
+			addrs: []Addr{{Host: "1.1.1.1", DeviceType: CaptureIP}},
 			interfaces: []pcap.Interface{
 				{Name: "1.1.1.1"},
 				{Name: "2.2.2.2"},
@@ -209,9 +386,8 @@ func TestSelectInterfaces(t *testing.T) {
 			},
 		},
 		{
-			desc:       "single address match IP",
-			value:      "1.1.1.1",
-			deviceType: CaptureIP,
+			desc:  "single address match IP",
+			addrs: []Addr{{Host: "1.1.1.1", DeviceType: CaptureIP}},
 			interfaces: []pcap.Interface{
 				{
 					Name: "111",
@@ -235,10 +411,102 @@ func TestSelectInterfaces(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc:  "any device",
+			addrs: []Addr{{Host: "any", DeviceType: CaptureAny}},
+			interfaces: []pcap.Interface{
+				{Name: "eth0"},
+				{Name: "any"},
+			},
+			expectedInterfaces: []pcap.Interface{
+				{Name: "any"},
+			},
+		},
+		{
+			desc:  "network",
+			addrs: []Addr{{Host: "10.0.0.0/8", DeviceType: CaptureNet}},
+			interfaces: []pcap.Interface{
+				{
+					Name: "111",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("1.1.1.1")},
+					},
+				},
+				{
+					Name: "222",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("10.1.2.3")},
+					},
+				},
+			},
+			expectedInterfaces: []pcap.Interface{
+				{
+					Name: "222",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("10.1.2.3")},
+					},
+				},
+			},
+		},
+		{
+			desc:   "egress remote address",
+			addrs:  []Addr{{Host: "9.9.9.9", DeviceType: CaptureIP}},
+			egress: true,
+			interfaces: []pcap.Interface{
+				{
+					Name: "111",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("1.1.1.1")},
+					},
+				},
+				{Name: "222"},
+			},
+			expectedInterfaces: []pcap.Interface{
+				{
+					Name: "111",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("1.1.1.1")},
+					},
+				},
+			},
+		},
+		{
+			desc:   "egress interface name",
+			addrs:  []Addr{{Host: "eth0", DeviceType: CaptureInterface}},
+			egress: true,
+			interfaces: []pcap.Interface{
+				{Name: "eth0"},
+				{
+					Name: "eth1",
+					Addresses: []pcap.InterfaceAddress{
+						{IP: net.ParseIP("1.1.1.1")},
+					},
+				},
+			},
+			expectedInterfaces: []pcap.Interface{
+				{Name: "eth0"},
+			},
+		},
+		{
+			desc: "multiple addrs",
+			addrs: []Addr{
+				{Host: "1.1.1.1", DeviceType: CaptureIP},
+				{Host: "3.3.3.3", DeviceType: CaptureIP},
+			},
+			interfaces: []pcap.Interface{
+				{Name: "1.1.1.1"},
+				{Name: "2.2.2.2"},
+				{Name: "3.3.3.3"},
+			},
+			expectedInterfaces: []pcap.Interface{
+				{Name: "1.1.1.1"},
+				{Name: "3.3.3.3"},
+			},
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
-			interfaces := selectInterfaces(c.value, c.deviceType, c.interfaces)
+			interfaces := selectInterfaces(c.addrs, c.egress, c.interfaces)
 			assert.DeepEqual(t, interfaces, c.expectedInterfaces)
 		})
 	}
@@ -283,3 +551,88 @@ func TestSplitHostPort(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAddrs(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addrs       string
+		parsed      []Addr
+		errContains string
+	}{
+		{
+			desc:  "empty",
+			addrs: "",
+			parsed: []Addr{
+				{Host: "0.0.0.0", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureAll},
+			},
+		},
+		{
+			desc:  "single",
+			addrs: "1.1.1.1:1111",
+			parsed: []Addr{
+				{Host: "1.1.1.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureIP},
+			},
+		},
+		{
+			desc:  "multiple with range",
+			addrs: "0.0.0.0:8080, 127.0.0.1:9000-9010",
+			parsed: []Addr{
+				{Host: "0.0.0.0", Ports: PortRange{First: 8080, Last: 8080}, DeviceType: CaptureAll},
+				{Host: "127.0.0.1", Ports: PortRange{First: 9000, Last: 9010}, DeviceType: CaptureLoopback},
+			},
+		},
+		{
+			desc:  "names and networks",
+			addrs: "eth0:80,any:8080,10.1.2.3/8:9000",
+			parsed: []Addr{
+				{Host: "eth0", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureInterface},
+				{Host: "any", Ports: PortRange{First: 8080, Last: 8080}, DeviceType: CaptureAny},
+				{Host: "10.0.0.0/8", Ports: PortRange{First: 9000, Last: 9000}, DeviceType: CaptureNet},
+			},
+		},
+		{
+			desc:        "invalid host",
+			addrs:       "0.0.0.0:8080,1.1.1:1111",
+			errContains: "invalid address: 1.1.1",
+		},
+		{
+			desc:        "invalid port",
+			addrs:       "0.0.0.0:http",
+			errContains: "invalid port: http",
+		},
+		{
+			desc:        "port out of range",
+			addrs:       "0.0.0.0:70000",
+			errContains: "invalid port: 70000",
+		},
+		{
+			desc:        "reversed range",
+			addrs:       "0.0.0.0:9010-9000",
+			errContains: "invalid port: 9010-9000",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			parsed, err := ParseAddrs(c.addrs)
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+			assert.DeepEqual(t, parsed, c.parsed)
+		})
+	}
+}
+
+func TestPortRange(t *testing.T) {
+	r := PortRange{First: 9000, Last: 9010}
+	assert.Equal(t, "9000-9010", r.String())
+	assert.Assert(t, r.Contains(9000))
+	assert.Assert(t, r.Contains(9010))
+	assert.Assert(t, !r.Contains(8999))
+	assert.Assert(t, !r.Contains(9011))
+
+	r = PortRange{First: 80, Last: 80}
+	assert.Equal(t, "80", r.String())
+	assert.Assert(t, r.Contains(80))
+}
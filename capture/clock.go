@@ -0,0 +1,32 @@
+package capture
+
+import "time"
+
+// Clock tracks time as seen by a capture. Packet timestamps
+// are used so that timeouts reflect wire time, which matters
+// when reading capture files whose packets were recorded in
+// the past. Between packets the clock advances with the wall
+// clock. The zero value is ready to use.
+type Clock struct {
+	last     time.Time
+	lastWall time.Time
+}
+
+// Observe advances the clock to the timestamp of a packet. Packets
+// without a timestamp are stamped with the current time.
+func (c *Clock) Observe(ts time.Time) time.Time {
+	wall := time.Now()
+	if ts.IsZero() {
+		ts = wall
+	}
+	c.last, c.lastWall = ts, wall
+	return ts
+}
+
+// Now gets the current time of the capture.
+func (c *Clock) Now() time.Time {
+	if c.last.IsZero() {
+		return time.Now()
+	}
+	return c.last.Add(time.Since(c.lastWall))
+}
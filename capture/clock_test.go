@@ -0,0 +1,20 @@
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestClock(t *testing.T) {
+	var c Clock
+
+	assert.Assert(t, time.Since(c.Now()) < time.Second)
+
+	ts := time.Unix(1000, 0)
+	assert.Equal(t, ts, c.Observe(ts))
+	assert.Assert(t, c.Now().Sub(ts) < time.Second)
+
+	assert.Assert(t, time.Since(c.Observe(time.Time{})) < time.Second)
+}
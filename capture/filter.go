@@ -4,16 +4,72 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 )
 
-// newBPFFilter creates a BPF newBPFFilter based on a capture configuration
-// and a given interface.
+// ValidateFilter compiles a user-supplied BPF expression
+// to ensure that it is valid. An empty expression is valid.
+func ValidateFilter(expr string) error {
+	if expr == "" {
+		return nil
+	}
+
+	if _, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, DefaultSnapLen, expr); err != nil {
+		return fmt.Errorf("invalid capture filter %q: %w", expr, err)
+	}
+
+	return nil
+}
+
+// newBPFFilter creates a BPF filter based on a capture configuration
+// and a given interface. A user-supplied filter is ANDed with the
+// generated filter.
 func newBPFFilter(capture *Capture, iface pcap.Interface) string {
+	filter := newGeneratedBPFFilter(capture, iface)
+
+	switch {
+	case capture.Filter == "":
+		return filter
+	case filter == "":
+		return capture.Filter
+	default:
+		return fmt.Sprintf("(%s) and (%s)", filter, capture.Filter)
+	}
+}
+
+// newGeneratedBPFFilter ORs together the filters for
+// each address that selected the interface.
+func newGeneratedBPFFilter(capture *Capture, iface pcap.Interface) string {
+	var filters []string
+	for _, a := range capture.Addrs {
+		if !a.matches(iface, capture.Egress) {
+			continue
+		}
+		if f := newAddrBPFFilter(capture, a, iface); f != "" {
+			filters = append(filters, f)
+		}
+	}
+
+	if len(filters) > 1 {
+		return fmt.Sprintf("(%s)", strings.Join(filters, ") or ("))
+	}
+
+	return strings.Join(filters, "")
+}
+
+func newAddrBPFFilter(capture *Capture, addr Addr, iface pcap.Interface) string {
+	if addr.DeviceType == CaptureNet {
+		return newNetBPFFilter(capture, addr)
+	}
+
 	var addrs []string
 
-	switch capture.DeviceType {
-	case CaptureLoopback:
+	switch {
+	case capture.Egress && (addr.DeviceType == CaptureIP || addr.DeviceType == CaptureLoopback):
+		// In egress mode the address is the remote server.
+		addrs = append(addrs, fmt.Sprintf("host %s", addr.Host))
+	case addr.DeviceType == CaptureLoopback:
 		for _, i := range capture.Interfaces {
 			for _, a := range i.Addresses {
 				addrs = append(addrs, fmt.Sprintf("host %s", a.IP))
@@ -25,6 +81,15 @@ func newBPFFilter(capture *Capture, iface pcap.Interface) string {
 		}
 	}
 
+	portExpression := "dst port"
+	if capture.Response {
+		portExpression = "port"
+	}
+	if addr.Ports.First != addr.Ports.Last {
+		portExpression += "range"
+	}
+
+	ports := fmt.Sprintf("%s %s %s", capture.protocol(), portExpression, addr.Ports)
 	hosts := strings.Join(addrs, " or ")
 
 	switch l := len(addrs); {
@@ -33,15 +98,42 @@ func newBPFFilter(capture *Capture, iface pcap.Interface) string {
 		hosts = fmt.Sprintf("(%s)", hosts)
 	case l == 1:
 		// No special formatting needed
+	case addr.isNamed():
+		// Named interfaces may have no addresses (the any
+		// device never does), so filter on the port alone.
+		return ports
 	default:
 		// No hosts/addrs means no filters
 		return ""
 	}
 
-	portExpression := "dst port"
-	if capture.Response {
-		portExpression = "port"
+	return fmt.Sprintf("%s and %s", ports, hosts)
+}
+
+// newNetBPFFilter creates the filter for a network of servers, in
+// either ingress or egress mode. Requests are matched by their
+// destination, so that connections the servers make to others on
+// the same port are not captured, and responses by their source.
+func newNetBPFFilter(capture *Capture, addr Addr) string {
+	portExpression := "port"
+	if addr.Ports.First != addr.Ports.Last {
+		portExpression += "range"
+	}
+
+	request := fmt.Sprintf("%s dst %s %s and dst net %s", capture.protocol(), portExpression, addr.Ports, addr.Host)
+	if !capture.Response {
+		return request
 	}
 
-	return fmt.Sprintf("tcp %s %s and %s", portExpression, capture.Port, hosts)
+	response := fmt.Sprintf("%s src %s %s and src net %s", capture.protocol(), portExpression, addr.Ports, addr.Host)
+
+	return fmt.Sprintf("(%s) or (%s)", request, response)
+}
+
+// protocol gets the protocol of the capture, which defaults to TCP.
+func (c *Capture) protocol() string {
+	if c.Protocol == "" {
+		return ProtocolTCP
+	}
+	return c.Protocol
 }
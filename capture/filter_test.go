@@ -19,7 +19,9 @@ func TestNewBPFFilter(t *testing.T) {
 		{
 			desc: "loopback no addrs",
 			capture: &Capture{
-				DeviceType: CaptureLoopback,
+				Addrs: []Addr{
+					{Host: "127.0.0.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureLoopback},
+				},
 			},
 			filter:         "",
 			responseFilter: "",
@@ -27,8 +29,9 @@ func TestNewBPFFilter(t *testing.T) {
 		{
 			desc: "loopback with single addr",
 			capture: &Capture{
-				Port:       "1111",
-				DeviceType: CaptureLoopback,
+				Addrs: []Addr{
+					{Host: "127.0.0.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureLoopback},
+				},
 				Interfaces: []pcap.Interface{
 					{
 						Name: "111",
@@ -44,8 +47,9 @@ func TestNewBPFFilter(t *testing.T) {
 		{
 			desc: "loopback with multiple addrs",
 			capture: &Capture{
-				Port:       "1111",
-				DeviceType: CaptureLoopback,
+				Addrs: []Addr{
+					{Host: "127.0.0.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureLoopback},
+				},
 				Interfaces: []pcap.Interface{
 					{
 						Name: "111",
@@ -67,8 +71,9 @@ func TestNewBPFFilter(t *testing.T) {
 		{
 			desc: "interface with single addr",
 			capture: &Capture{
-				Port:       "1111",
-				DeviceType: CaptureIP,
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureIP},
+				},
 			},
 			iface: pcap.Interface{
 				Name: "111",
@@ -82,8 +87,9 @@ func TestNewBPFFilter(t *testing.T) {
 		{
 			desc: "interface with multiple addrs",
 			capture: &Capture{
-				Port:       "1111",
-				DeviceType: CaptureIP,
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureIP},
+				},
 			},
 			iface: pcap.Interface{
 				Name: "111",
@@ -95,6 +101,231 @@ func TestNewBPFFilter(t *testing.T) {
 			filter:         "tcp dst port 1111 and (host 1.1.1.1 or host 2.2.2.2)",
 			responseFilter: "tcp port 1111 and (host 1.1.1.1 or host 2.2.2.2)",
 		},
+		{
+			desc: "user filter without addrs",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "111", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureIP},
+				},
+				Filter: "not net 10.0.0.0/8",
+			},
+			iface: pcap.Interface{
+				Name: "111",
+			},
+			filter:         "not net 10.0.0.0/8",
+			responseFilter: "not net 10.0.0.0/8",
+		},
+		{
+			desc: "user filter with addrs",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 1111, Last: 1111}, DeviceType: CaptureIP},
+				},
+				Filter: "not host 3.3.3.3",
+			},
+			iface: pcap.Interface{
+				Name: "111",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "(tcp dst port 1111 and host 1.1.1.1) and (not host 3.3.3.3)",
+			responseFilter: "(tcp port 1111 and host 1.1.1.1) and (not host 3.3.3.3)",
+		},
+		{
+			desc: "port range",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 9000, Last: 9010}, DeviceType: CaptureIP},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "111",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "tcp dst portrange 9000-9010 and host 1.1.1.1",
+			responseFilter: "tcp portrange 9000-9010 and host 1.1.1.1",
+		},
+		{
+			desc: "multiple addrs",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "0.0.0.0", Ports: PortRange{First: 8080, Last: 8080}, DeviceType: CaptureAll},
+					{Host: "1.1.1.1", Ports: PortRange{First: 9000, Last: 9010}, DeviceType: CaptureIP},
+					{Host: "2.2.2.2", Ports: PortRange{First: 7000, Last: 7000}, DeviceType: CaptureIP},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "111",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "(tcp dst port 8080 and host 1.1.1.1) or (tcp dst portrange 9000-9010 and host 1.1.1.1)",
+			responseFilter: "(tcp port 8080 and host 1.1.1.1) or (tcp portrange 9000-9010 and host 1.1.1.1)",
+		},
+		{
+			desc: "multiple addrs with user filter",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 8080, Last: 8080}, DeviceType: CaptureIP},
+					{Host: "1.1.1.1", Ports: PortRange{First: 9090, Last: 9090}, DeviceType: CaptureIP},
+				},
+				Filter: "not host 3.3.3.3",
+			},
+			iface: pcap.Interface{
+				Name: "111",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "((tcp dst port 8080 and host 1.1.1.1) or (tcp dst port 9090 and host 1.1.1.1)) and (not host 3.3.3.3)",
+			responseFilter: "((tcp port 8080 and host 1.1.1.1) or (tcp port 9090 and host 1.1.1.1)) and (not host 3.3.3.3)",
+		},
+		{
+			desc: "interface name with addrs",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "eth0", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureInterface},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "tcp dst port 80 and host 1.1.1.1",
+			responseFilter: "tcp port 80 and host 1.1.1.1",
+		},
+		{
+			desc: "interface name without addrs",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "eth0", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureInterface},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+			},
+			filter:         "tcp dst port 80",
+			responseFilter: "tcp port 80",
+		},
+		{
+			desc: "any device",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "any", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureAny},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "any",
+			},
+			filter:         "tcp dst port 80",
+			responseFilter: "tcp port 80",
+		},
+		{
+			desc: "network",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "10.0.0.0/8", Ports: PortRange{First: 80, Last: 80}, DeviceType: CaptureNet},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("10.1.2.3")},
+				},
+			},
+			filter:         "tcp dst port 80 and dst net 10.0.0.0/8",
+			responseFilter: "(tcp dst port 80 and dst net 10.0.0.0/8) or (tcp src port 80 and src net 10.0.0.0/8)",
+		},
+		{
+			desc: "network port range",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "10.0.0.0/8", Ports: PortRange{First: 8000, Last: 8080}, DeviceType: CaptureNet},
+				},
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("10.1.2.3")},
+				},
+			},
+			filter:         "tcp dst portrange 8000-8080 and dst net 10.0.0.0/8",
+			responseFilter: "(tcp dst portrange 8000-8080 and dst net 10.0.0.0/8) or (tcp src portrange 8000-8080 and src net 10.0.0.0/8)",
+		},
+		{
+			desc: "egress remote address",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "9.9.9.9", Ports: PortRange{First: 443, Last: 443}, DeviceType: CaptureIP},
+				},
+				Egress: true,
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "tcp dst port 443 and host 9.9.9.9",
+			responseFilter: "tcp port 443 and host 9.9.9.9",
+		},
+		{
+			desc: "egress all remotes",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "0.0.0.0", Ports: PortRange{First: 443, Last: 443}, DeviceType: CaptureAll},
+				},
+				Egress: true,
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "tcp dst port 443 and host 1.1.1.1",
+			responseFilter: "tcp port 443 and host 1.1.1.1",
+		},
+		{
+			desc: "egress remote network",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "10.0.0.0/8", Ports: PortRange{First: 5432, Last: 5432}, DeviceType: CaptureNet},
+				},
+				Egress: true,
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "tcp dst port 5432 and dst net 10.0.0.0/8",
+			responseFilter: "(tcp dst port 5432 and dst net 10.0.0.0/8) or (tcp src port 5432 and src net 10.0.0.0/8)",
+		},
+		{
+			desc: "udp",
+			capture: &Capture{
+				Addrs: []Addr{
+					{Host: "1.1.1.1", Ports: PortRange{First: 53, Last: 53}, DeviceType: CaptureIP},
+				},
+				Protocol: ProtocolUDP,
+			},
+			iface: pcap.Interface{
+				Name: "eth0",
+				Addresses: []pcap.InterfaceAddress{
+					{IP: net.ParseIP("1.1.1.1")},
+				},
+			},
+			filter:         "udp dst port 53 and host 1.1.1.1",
+			responseFilter: "udp port 53 and host 1.1.1.1",
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
@@ -104,3 +335,34 @@ func TestNewBPFFilter(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateFilter(t *testing.T) {
+	cases := []struct {
+		desc        string
+		expr        string
+		errContains string
+	}{
+		{
+			desc: "empty",
+		},
+		{
+			desc: "valid",
+			expr: "not host 1.1.1.1",
+		},
+		{
+			desc:        "invalid",
+			expr:        "tcp port",
+			errContains: `invalid capture filter "tcp port"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			err := ValidateFilter(c.expr)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+//go:build libpcap
+// +build libpcap
+
+package capture
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// These tests exercise libpcap itself rather than the code
+// around it, so they only run when built with the libpcap tag.
+
+func TestValidateFilterLibpcap(t *testing.T) {
+	cases := []struct {
+		desc        string
+		expr        string
+		errContains string
+	}{
+		{
+			desc: "host",
+			expr: "not host 1.1.1.1",
+		},
+		{
+			desc: "port range",
+			expr: "tcp portrange 8000-8080 or udp port 53",
+		},
+		{
+			desc:        "missing port",
+			expr:        "tcp port",
+			errContains: `invalid capture filter "tcp port"`,
+		},
+		{
+			desc:        "port out of range",
+			expr:        "port 99999",
+			errContains: `invalid capture filter "port 99999"`,
+		},
+		{
+			desc:        "bad host",
+			expr:        "host 1.1.1.1.1",
+			errContains: `invalid capture filter "host 1.1.1.1.1"`,
+		},
+		{
+			desc:        "unknown keyword",
+			expr:        "not a filter",
+			errContains: `invalid capture filter "not a filter"`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			err := ValidateFilter(c.expr)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func TestNewInactiveHandlerLibpcap(t *testing.T) {
+	cases := []struct {
+		desc    string
+		capture *Capture
+	}{
+		{
+			desc:    "defaults",
+			capture: &Capture{SnapLen: DefaultSnapLen, Promiscuous: true},
+		},
+		{
+			desc: "handle parameters",
+			capture: &Capture{
+				SnapLen:    1500,
+				BufferSize: 8 << 20,
+				Timeout:    time.Second,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			l := NewListener(c.capture)
+			inactive, err := l.(*listener).newInactiveHandler(AnyDevice)
+			assert.NilError(t, err)
+			inactive.CleanUp()
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package capture
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// LinkType gets the link type of the handle or file a packet
+// was read from. Listeners record the link type in the
+// packet's ancillary data since gopacket does not otherwise
+// retain it once a packet has been decoded.
+func LinkType(p gopacket.Packet) (layers.LinkType, bool) {
+	for _, d := range p.Metadata().AncillaryData {
+		if lt, ok := d.(layers.LinkType); ok {
+			return lt, true
+		}
+	}
+	return 0, false
+}
+
+func setLinkType(p gopacket.Packet, linkType layers.LinkType) {
+	if _, ok := LinkType(p); ok {
+		return
+	}
+	m := p.Metadata()
+	m.AncillaryData = append(m.AncillaryData, linkType)
+}
@@ -7,11 +7,9 @@ import (
 	"sync"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/rename-this/vhs/core"
-
-	// See https://pkg.go.dev/github.com/google/gopacket?tab=doc#hdr-A_Final_Note
-	_ "github.com/google/gopacket/layers"
 )
 
 // NewListener creates a new listener.
@@ -22,6 +20,82 @@ func NewListener(cap *Capture) Listener {
 	}
 }
 
+// NewLiveListener creates a listener for the live
+// TCP capture described by the flow config.
+func NewLiveListener(ctx core.Context) (Listener, error) {
+	return newLiveListener(ctx, ProtocolTCP)
+}
+
+// NewLiveUDPListener creates a listener for the live
+// UDP capture described by the flow config.
+func NewLiveUDPListener(ctx core.Context) (Listener, error) {
+	return newLiveListener(ctx, ProtocolUDP)
+}
+
+func newLiveListener(ctx core.Context, protocol string) (Listener, error) {
+	if err := ValidateFlowConfig(ctx.FlowConfig); err != nil {
+		return nil, err
+	}
+
+	cap, err := NewCapture(ctx.FlowConfig.Addr, ctx.FlowConfig.CaptureResponse, ctx.FlowConfig.CaptureEgress)
+	if err != nil {
+		return nil, err
+	}
+
+	cap.Protocol = protocol
+	cap.Filter = ctx.FlowConfig.CaptureFilter
+	cap.BufferSize = ctx.FlowConfig.CaptureBufferSize
+	cap.Promiscuous = ctx.FlowConfig.CapturePromiscuous
+	cap.Timeout = ctx.FlowConfig.CaptureTimeout
+	if ctx.FlowConfig.CaptureSnapLen > 0 {
+		cap.SnapLen = ctx.FlowConfig.CaptureSnapLen
+	}
+
+	ctx.Logger.Debug().
+		Interface("cap", cap).
+		Str("backend", ctx.FlowConfig.CaptureBackend).
+		Msg("capture created")
+
+	switch ctx.FlowConfig.CaptureBackend {
+	case BackendAFPacket:
+		return NewAFPacketListener(cap, AFPacketOptions{
+			BlockSize: ctx.FlowConfig.AFPacketBlockSize,
+			NumBlocks: ctx.FlowConfig.AFPacketNumBlocks,
+			Fanout:    ctx.FlowConfig.AFPacketFanout,
+		})
+	default:
+		return NewListener(cap), nil
+	}
+}
+
+// ValidateFlowConfig ensures that the capture settings
+// of a flow config are valid before capturing starts.
+func ValidateFlowConfig(cfg *core.FlowConfig) error {
+	if _, err := ParseAddrs(cfg.Addr); err != nil {
+		return err
+	}
+
+	if err := ValidateFilter(cfg.CaptureFilter); err != nil {
+		return err
+	}
+
+	switch {
+	case cfg.CaptureSnapLen < 0:
+		return fmt.Errorf("invalid capture snap length: %d", cfg.CaptureSnapLen)
+	case cfg.CaptureBufferSize < 0:
+		return fmt.Errorf("invalid capture buffer size: %d", cfg.CaptureBufferSize)
+	case cfg.CaptureTimeout < 0:
+		return fmt.Errorf("invalid capture timeout: %s", cfg.CaptureTimeout)
+	}
+
+	switch cfg.CaptureBackend {
+	case "", BackendPcap, BackendAFPacket:
+		return nil
+	default:
+		return fmt.Errorf("unknown capture backend: %s", cfg.CaptureBackend)
+	}
+}
+
 // Listener listens for network traffic on a
 // given address and port.
 type Listener interface {
@@ -37,6 +111,8 @@ type listener struct {
 
 	handleMu sync.Mutex
 	handles  []*pcap.Handle
+
+	stats statsCollector
 }
 
 // Packets retrieves a channel for all packets
@@ -51,6 +127,8 @@ func (l *listener) Listen(ctx core.Context) {
 		Str(core.LoggerKeyComponent, "listener").
 		Logger()
 
+	go l.stats.run(ctx)
+
 	for _, i := range l.Capture.Interfaces {
 		if h, err := l.newHandle(ctx, i, (*pcap.InactiveHandle).Activate); err != nil {
 			ctx.Errors <- err
@@ -71,8 +149,7 @@ func (l *listener) newHandle(ctx core.Context, i pcap.Interface, activate activa
 
 	inactive, err := l.newInactiveHandler(i.Name)
 	if err != nil {
-		ctx.Logger.Debug().Err(err).Msgf("failed to create inactive handle for %s", i.Name)
-		return nil, nil
+		return nil, fmt.Errorf("failed to create inactive handle for %s: %w", i.Name, err)
 	}
 
 	defer inactive.CleanUp()
@@ -95,11 +172,13 @@ func (l *listener) newHandle(ctx core.Context, i pcap.Interface, activate activa
 	l.handles = append(l.handles, handle)
 	l.handleMu.Unlock()
 
+	l.stats.add(i.Name, pcapStats(handle))
+
 	return handle, nil
 }
 
-func (l *listener) readPackets(ctx core.Context, dataSource gopacket.PacketDataSource, decoder gopacket.Decoder) {
-	source := gopacket.NewPacketSource(dataSource, decoder)
+func (l *listener) readPackets(ctx core.Context, dataSource gopacket.PacketDataSource, linkType layers.LinkType) {
+	source := gopacket.NewPacketSource(dataSource, linkType)
 	source.Lazy = true
 	source.NoCopy = true
 
@@ -118,6 +197,7 @@ func (l *listener) readPackets(ctx core.Context, dataSource gopacket.PacketDataS
 				}
 				continue
 			}
+			setLinkType(p, linkType)
 			if ctx.Config.DebugPackets {
 				ctx.Logger.Debug().Str("p", p.String()).Msg("packet")
 			}
@@ -132,16 +212,53 @@ func (l *listener) newInactiveHandler(name string) (*pcap.InactiveHandle, error)
 		return nil, fmt.Errorf("failed to create inactive handle: %w", err)
 	}
 
-	inactive.SetPromisc(true)
-	inactive.SetTimeout(pcap.BlockForever)
-	inactive.SetImmediateMode(true)
-	inactive.SetSnapLen(65536)
+	if err := l.configureInactiveHandle(inactive); err != nil {
+		inactive.CleanUp()
+		return nil, err
+	}
 
 	return inactive, nil
 }
 
+// configureInactiveHandle applies the capture's handle
+// parameters, which take effect once it is activated.
+func (l *listener) configureInactiveHandle(inactive *pcap.InactiveHandle) error {
+	if err := inactive.SetPromisc(l.Capture.Promiscuous); err != nil {
+		return fmt.Errorf("failed to set promiscuous mode: %w", err)
+	}
+
+	if l.Capture.Timeout > 0 {
+		if err := inactive.SetTimeout(l.Capture.Timeout); err != nil {
+			return fmt.Errorf("failed to set timeout %s: %w", l.Capture.Timeout, err)
+		}
+	} else {
+		if err := inactive.SetTimeout(pcap.BlockForever); err != nil {
+			return fmt.Errorf("failed to set timeout: %w", err)
+		}
+		if err := inactive.SetImmediateMode(true); err != nil {
+			return fmt.Errorf("failed to set immediate mode: %w", err)
+		}
+	}
+
+	if l.Capture.SnapLen > 0 {
+		if err := inactive.SetSnapLen(l.Capture.SnapLen); err != nil {
+			return fmt.Errorf("failed to set snap length %d: %w", l.Capture.SnapLen, err)
+		}
+	}
+
+	if l.Capture.BufferSize > 0 {
+		if err := inactive.SetBufferSize(l.Capture.BufferSize); err != nil {
+			return fmt.Errorf("failed to set buffer size %d: %w", l.Capture.BufferSize, err)
+		}
+	}
+
+	return nil
+}
+
 // Close closes the listener and all open handles.
 func (l *listener) Close() {
+	l.stats.close()
+
 	l.handleMu.Lock()
 	defer l.handleMu.Unlock()
 
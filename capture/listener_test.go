@@ -4,8 +4,10 @@ import (
 	"errors"
 	"io"
 	"testing"
+	"time"
 
 	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/rename-this/vhs/core"
 	"gotest.tools/v3/assert"
@@ -56,6 +58,130 @@ func TestNewInactiveHandler(t *testing.T) {
 	assert.NilError(t, err)
 }
 
+func TestNewLiveListener(t *testing.T) {
+	cases := []struct {
+		desc     string
+		flowCfg  *core.FlowConfig
+		expected *Capture
+	}{
+		{
+			desc:    "defaults",
+			flowCfg: &core.FlowConfig{},
+			expected: &Capture{
+				SnapLen: DefaultSnapLen,
+			},
+		},
+		{
+			desc: "handle parameters",
+			flowCfg: &core.FlowConfig{
+				CaptureSnapLen:     1500,
+				CaptureBufferSize:  8 << 20,
+				CapturePromiscuous: true,
+				CaptureTimeout:     time.Second,
+			},
+			expected: &Capture{
+				SnapLen:     1500,
+				BufferSize:  8 << 20,
+				Promiscuous: true,
+				Timeout:     time.Second,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, c.flowCfg, nil)
+			l, err := NewLiveListener(ctx)
+			assert.NilError(t, err)
+
+			cap := l.(*listener).Capture
+			assert.Equal(t, c.expected.SnapLen, cap.SnapLen)
+			assert.Equal(t, c.expected.BufferSize, cap.BufferSize)
+			assert.Equal(t, c.expected.Promiscuous, cap.Promiscuous)
+			assert.Equal(t, c.expected.Timeout, cap.Timeout)
+			assert.Equal(t, ProtocolTCP, cap.Protocol)
+		})
+	}
+}
+
+func TestNewLiveUDPListener(t *testing.T) {
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+	l, err := NewLiveUDPListener(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, ProtocolUDP, l.(*listener).Capture.Protocol)
+}
+
+func TestValidateFlowConfig(t *testing.T) {
+	cases := []struct {
+		desc        string
+		cfg         *core.FlowConfig
+		errContains string
+	}{
+		{
+			desc: "defaults",
+			cfg:  &core.FlowConfig{},
+		},
+		{
+			desc: "afpacket",
+			cfg: &core.FlowConfig{
+				Addr:           "eth0:80",
+				CaptureBackend: BackendAFPacket,
+			},
+		},
+		{
+			desc: "invalid addr",
+			cfg: &core.FlowConfig{
+				Addr: "0.0.0.0:http",
+			},
+			errContains: "invalid port",
+		},
+		{
+			desc: "invalid filter",
+			cfg: &core.FlowConfig{
+				CaptureFilter: "tcp port",
+			},
+			errContains: "invalid capture filter",
+		},
+		{
+			desc: "invalid snap length",
+			cfg: &core.FlowConfig{
+				CaptureSnapLen: -1,
+			},
+			errContains: "invalid capture snap length: -1",
+		},
+		{
+			desc: "invalid buffer size",
+			cfg: &core.FlowConfig{
+				CaptureBufferSize: -1,
+			},
+			errContains: "invalid capture buffer size: -1",
+		},
+		{
+			desc: "invalid timeout",
+			cfg: &core.FlowConfig{
+				CaptureTimeout: -time.Second,
+			},
+			errContains: "invalid capture timeout: -1s",
+		},
+		{
+			desc: "unknown backend",
+			cfg: &core.FlowConfig{
+				CaptureBackend: "111",
+			},
+			errContains: "unknown capture backend: 111",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			err := ValidateFlowConfig(c.cfg)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
 type testPacketDataSource struct {
 	idx  int
 	data []string
@@ -79,11 +205,12 @@ func TestReadPackets(t *testing.T) {
 		desc     string
 		listener Listener
 		source   *testPacketDataSource
-		decoder  gopacket.Decoder
+		linkType layers.LinkType
 	}{
 		{
 			desc:     "reads to EOF",
 			listener: NewListener(&Capture{}),
+			linkType: layers.LinkTypeEthernet,
 			source: &testPacketDataSource{
 				data: []string{
 					"111",
@@ -109,10 +236,13 @@ func TestReadPackets(t *testing.T) {
 
 			ctx := core.NewContext(&core.Config{DebugPackets: true}, &core.FlowConfig{}, nil)
 
-			go c.listener.(*listener).readPackets(ctx, c.source, c.decoder)
+			go c.listener.(*listener).readPackets(ctx, c.source, c.linkType)
 			for _, d := range c.source.data {
 				p := <-packets
 				assert.Equal(t, string(p.Data()), d)
+				lt, ok := LinkType(p)
+				assert.Assert(t, ok)
+				assert.Equal(t, lt, c.linkType)
 			}
 			ctx.Cancel()
 			c.listener.Close()
@@ -0,0 +1,168 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/rename-this/vhs/core"
+)
+
+// ngMagic is the block type of a pcapng section header, which
+// is always the first four bytes of a pcapng file.
+var ngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// NewOfflineListener creates a listener that reads packets
+// from a pcap or pcapng file instead of live interfaces.
+// The packets channel is closed once the file has been read.
+func NewOfflineListener(path string) Listener {
+	return &offlineListener{
+		path:    path,
+		packets: make(chan gopacket.Packet),
+	}
+}
+
+type offlineListener struct {
+	path    string
+	packets chan gopacket.Packet
+}
+
+// Packets retrieves a channel for all packets
+// read by this listener.
+func (l *offlineListener) Packets() <-chan gopacket.Packet {
+	return l.packets
+}
+
+// Listen reads the file until EOF.
+func (l *offlineListener) Listen(ctx core.Context) {
+	defer close(l.packets)
+
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "offline_listener").
+		Str("path", l.path).
+		Logger()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to open %s: %w", l.path, err)
+		return
+	}
+
+	defer f.Close()
+
+	r, err := NewFileReader(f)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to read %s: %w", l.path, err)
+		return
+	}
+
+	ctx.Logger.Debug().Msg("file opened")
+
+	for {
+		data, ci, err := r.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			ctx.Logger.Debug().Msg("EOF")
+			return
+		}
+		if err != nil {
+			ctx.Errors <- fmt.Errorf("failed to read packet from %s: %w", l.path, err)
+			return
+		}
+
+		linkType := r.LinkType(ci.InterfaceIndex)
+
+		p := gopacket.NewPacket(data, linkType, gopacket.DecodeOptions{
+			Lazy:   true,
+			NoCopy: true,
+		})
+		p.Metadata().CaptureInfo = ci
+		setLinkType(p, linkType)
+
+		if ctx.Config.DebugPackets {
+			ctx.Logger.Debug().Str("p", p.String()).Msg("packet")
+		}
+
+		select {
+		case l.packets <- p:
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+}
+
+// Close is a no-op since the file is closed
+// as soon as it has been read.
+func (l *offlineListener) Close() {}
+
+// FileReader reads packet data from a capture file.
+type FileReader interface {
+	gopacket.PacketDataSource
+	LinkType(interfaceIndex int) layers.LinkType
+}
+
+// NewFileReader creates a reader for a pcap or pcapng
+// stream. The format is detected from the first bytes.
+func NewFileReader(r io.Reader) (FileReader, error) {
+	buf := bufio.NewReader(r)
+
+	magic, err := buf.Peek(len(ngMagic))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file header: %w", err)
+	}
+
+	if bytes.Equal(magic, ngMagic) {
+		ng, err := pcapgo.NewNgReader(buf, pcapgo.NgReaderOptions{
+			WantMixedLinkType: true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create pcapng reader: %w", err)
+		}
+		return &ngFileReader{ng}, nil
+	}
+
+	p, err := pcapgo.NewReader(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pcap reader: %w", err)
+	}
+	return &pcapFileReader{p}, nil
+}
+
+type pcapFileReader struct {
+	*pcapgo.Reader
+}
+
+// LinkType gets the link type of the file. Pcap
+// files only have a single interface.
+func (r *pcapFileReader) LinkType(int) layers.LinkType {
+	return r.Reader.LinkType()
+}
+
+type ngFileReader struct {
+	*pcapgo.NgReader
+}
+
+// ReadPacketData reads the next packet. The ancillary data
+// returned by the pcapng reader is reused between packets,
+// so it is copied to keep each packet's data intact.
+func (r *ngFileReader) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	data, ci, err := r.NgReader.ReadPacketData()
+	ci.AncillaryData = append([]interface{}(nil), ci.AncillaryData...)
+	return data, ci, err
+}
+
+// LinkType gets the link type of an interface. A pcapng
+// file may contain packets from several interfaces,
+// each with its own link type.
+func (r *ngFileReader) LinkType(interfaceIndex int) layers.LinkType {
+	i, err := r.NgReader.Interface(interfaceIndex)
+	if err != nil {
+		return r.NgReader.LinkType()
+	}
+	return i.LinkType
+}
@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
+
+func TestOfflineListener(t *testing.T) {
+	cases := []struct {
+		desc        string
+		path        string
+		packets     int
+		errContains string
+	}{
+		{
+			desc:    "pcapng",
+			path:    "../testdata/200722_tcp_anon.pcapng",
+			packets: 35,
+		},
+		{
+			desc:        "no file",
+			path:        "/no/such/file",
+			errContains: "no such file or directory",
+		},
+		{
+			desc:        "not a capture",
+			path:        "../testdata/test.json",
+			errContains: "failed to create pcap reader",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs = make(chan error, 1)
+				ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+				l    = NewOfflineListener(c.path)
+			)
+
+			defer l.Close()
+
+			go l.Listen(ctx)
+
+			var n int
+			for p := range l.Packets() {
+				assert.Assert(t, !p.Metadata().Timestamp.IsZero())
+				assert.Equal(t, p.Layers()[0].LayerType(), layers.LayerTypeEthernet)
+				lt, ok := LinkType(p)
+				assert.Assert(t, ok)
+				assert.Equal(t, lt, layers.LinkTypeEthernet)
+				n++
+			}
+
+			if c.errContains != "" {
+				assert.Equal(t, 1, len(errs))
+				assert.ErrorContains(t, <-errs, c.errContains)
+				return
+			}
+
+			assert.Equal(t, 0, len(errs))
+			assert.Equal(t, c.packets, n)
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rename-this/vhs/core"
+)
+
+// statsInterval is how often capture statistics are collected.
+const statsInterval = 10 * time.Second
+
+// handleStats are the cumulative packet counters of a capture handle.
+type handleStats struct {
+	// Received is the number of packets received.
+	Received uint64
+	// Dropped is the number of packets dropped because
+	// there was no room in the capture buffer.
+	Dropped uint64
+	// IfDropped is the number of packets dropped by
+	// the network interface or its driver.
+	IfDropped uint64
+}
+
+// sub subtracts previously collected stats. A counter that has
+// gone backwards was reset, so its current value is the delta.
+func (s handleStats) sub(prev handleStats) handleStats {
+	delta := func(cur, prev uint64) uint64 {
+		if cur < prev {
+			return cur
+		}
+		return cur - prev
+	}
+	return handleStats{
+		Received:  delta(s.Received, prev.Received),
+		Dropped:   delta(s.Dropped, prev.Dropped),
+		IfDropped: delta(s.IfDropped, prev.IfDropped),
+	}
+}
+
+type statsFn func() (handleStats, error)
+
+func pcapStats(handle *pcap.Handle) statsFn {
+	return func() (handleStats, error) {
+		s, err := handle.Stats()
+		if err != nil {
+			return handleStats{}, err
+		}
+		return handleStats{
+			Received:  uint64(s.PacketsReceived),
+			Dropped:   uint64(s.PacketsDropped),
+			IfDropped: uint64(s.PacketsIfDropped),
+		}, nil
+	}
+}
+
+// statsMetrics are the Prometheus counters for capture statistics.
+type statsMetrics struct {
+	Received  *prometheus.CounterVec
+	Dropped   *prometheus.CounterVec
+	IfDropped *prometheus.CounterVec
+}
+
+func newStatsMetrics(r prometheus.Registerer) *statsMetrics {
+	f := promauto.With(r)
+	newCounter := func(name, help string) *prometheus.CounterVec {
+		return f.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "vhs",
+			Subsystem: "capture",
+			Name:      name,
+			Help:      help,
+		}, []string{"interface"})
+	}
+	return &statsMetrics{
+		Received:  newCounter("packets_received_total", "Total count of packets received by the capture."),
+		Dropped:   newCounter("packets_dropped_total", "Total count of packets dropped by the capture buffer."),
+		IfDropped: newCounter("packets_if_dropped_total", "Total count of packets dropped by the network interface."),
+	}
+}
+
+// defaultMetrics are registered with the default Prometheus
+// registry. They are only updated when metrics are enabled.
+var defaultMetrics = newStatsMetrics(prometheus.DefaultRegisterer)
+
+func (m *statsMetrics) add(iface string, delta handleStats) {
+	labels := prometheus.Labels{"interface": iface}
+	m.Received.With(labels).Add(float64(delta.Received))
+	m.Dropped.With(labels).Add(float64(delta.Dropped))
+	m.IfDropped.With(labels).Add(float64(delta.IfDropped))
+}
+
+// statsCollector periodically collects statistics from
+// capture handles, exporting them as metrics and
+// logging a warning whenever packets are dropped.
+type statsCollector struct {
+	mu      sync.Mutex
+	entries []*statsEntry
+}
+
+type statsEntry struct {
+	iface string
+	fn    statsFn
+	last  handleStats
+}
+
+func (c *statsCollector) add(iface string, fn statsFn) {
+	c.mu.Lock()
+	c.entries = append(c.entries, &statsEntry{
+		iface: iface,
+		fn:    fn,
+	})
+	c.mu.Unlock()
+}
+
+// close stops collecting from all handles. It must be called
+// before the handles are closed since collecting from a
+// closed handle is not safe.
+func (c *statsCollector) close() {
+	c.mu.Lock()
+	c.entries = nil
+	c.mu.Unlock()
+}
+
+func (c *statsCollector) run(ctx core.Context) {
+	var metrics *statsMetrics
+	if ctx.Config.PrometheusAddr != "" {
+		metrics = defaultMetrics
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.collect(ctx, metrics)
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+}
+
+func (c *statsCollector) collect(ctx core.Context, metrics *statsMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, e := range c.entries {
+		s, err := e.fn()
+		if err != nil {
+			ctx.Logger.Debug().Err(err).Str("interface", e.iface).Msg("failed to collect capture stats")
+			continue
+		}
+
+		delta := s.sub(e.last)
+		e.last = s
+
+		if metrics != nil {
+			metrics.add(e.iface, delta)
+		}
+
+		if delta.Dropped > 0 || delta.IfDropped > 0 {
+			ctx.Logger.Warn().
+				Str("interface", e.iface).
+				Uint64("received", delta.Received).
+				Uint64("dropped", delta.Dropped).
+				Uint64("if_dropped", delta.IfDropped).
+				Msg("capture dropped packets")
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rename-this/vhs/core"
+	"github.com/rs/zerolog"
+	"gotest.tools/v3/assert"
+)
+
+func TestHandleStatsSub(t *testing.T) {
+	cases := []struct {
+		desc  string
+		cur   handleStats
+		prev  handleStats
+		delta handleStats
+	}{
+		{
+			desc:  "first",
+			cur:   handleStats{Received: 10, Dropped: 2, IfDropped: 1},
+			delta: handleStats{Received: 10, Dropped: 2, IfDropped: 1},
+		},
+		{
+			desc:  "increase",
+			cur:   handleStats{Received: 15, Dropped: 3, IfDropped: 1},
+			prev:  handleStats{Received: 10, Dropped: 2, IfDropped: 1},
+			delta: handleStats{Received: 5, Dropped: 1},
+		},
+		{
+			desc:  "reset",
+			cur:   handleStats{Received: 4},
+			prev:  handleStats{Received: 10, Dropped: 2},
+			delta: handleStats{Received: 4},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.DeepEqual(t, c.delta, c.cur.sub(c.prev))
+		})
+	}
+}
+
+func TestStatsCollector(t *testing.T) {
+	var (
+		buf     bytes.Buffer
+		ctx     = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+		metrics = newStatsMetrics(prometheus.NewRegistry())
+		c       statsCollector
+		results = []handleStats{
+			{Received: 10},
+			{Received: 20, Dropped: 5, IfDropped: 1},
+		}
+		calls int
+	)
+
+	ctx.Logger = zerolog.New(&buf)
+
+	c.add("eth0", func() (handleStats, error) {
+		s := results[calls]
+		calls++
+		return s, nil
+	})
+	c.add("eth1", func() (handleStats, error) {
+		return handleStats{}, errors.New("111")
+	})
+
+	c.collect(ctx, metrics)
+	assert.Equal(t, float64(10), testutil.ToFloat64(metrics.Received.WithLabelValues("eth0")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.Dropped.WithLabelValues("eth0")))
+	assert.Assert(t, !strings.Contains(buf.String(), "capture dropped packets"))
+
+	c.collect(ctx, metrics)
+	assert.Equal(t, float64(20), testutil.ToFloat64(metrics.Received.WithLabelValues("eth0")))
+	assert.Equal(t, float64(5), testutil.ToFloat64(metrics.Dropped.WithLabelValues("eth0")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.IfDropped.WithLabelValues("eth0")))
+	assert.Assert(t, strings.Contains(buf.String(), `"interface":"eth0","received":10,"dropped":5,"if_dropped":1`))
+
+	c.close()
+	c.collect(ctx, metrics)
+	assert.Equal(t, 2, calls)
+}
@@ -23,9 +23,13 @@ import (
 	"github.com/rename-this/vhs/httpx"
 	"github.com/rename-this/vhs/internal/ioutilx"
 	"github.com/rename-this/vhs/jsonx"
+	"github.com/rename-this/vhs/pcapx"
 	"github.com/rename-this/vhs/plugin"
+	"github.com/rename-this/vhs/proxy"
 	"github.com/rename-this/vhs/s3compat"
 	"github.com/rename-this/vhs/tcp"
+	"github.com/rename-this/vhs/tlsmeta"
+	"github.com/rename-this/vhs/udp"
 
 	_ "net/http/pprof"
 
@@ -55,16 +59,42 @@ func newRootCmd() *cobra.Command {
 
 	cmd.PersistentFlags().DurationVar(&flowCfg.SourceDuration, "source-duration", math.MaxInt64, "The length of the source is left open. Leave this empty to read to EOF.")
 	cmd.PersistentFlags().DurationVar(&flowCfg.InputDrainDuration, "input-drain-duration", 500*time.Millisecond, "A grace period to allow for inputs to drain.")
-	cmd.PersistentFlags().StringVar(&flowCfg.Addr, "address", capture.DefaultAddr, "Address VHS will use to capture traffic.")
+	cmd.PersistentFlags().StringVar(&flowCfg.Addr, "address", capture.DefaultAddr, "Comma-separated addresses VHS will use to capture traffic. Ports may be ranges (e.g. 0.0.0.0:9000-9010).")
 	cmd.PersistentFlags().StringVar(&flowCfg.AddrSink, "address-sink", "", "Address used for writing to a network-based sink")
 	cmd.PersistentFlags().BoolVar(&flowCfg.CaptureResponse, "capture-response", false, "Capture the responses.")
+	cmd.PersistentFlags().BoolVar(&flowCfg.CaptureEgress, "capture-egress", false, "Capture outbound calls to the remote addresses given by --address.")
+	cmd.PersistentFlags().StringVar(&flowCfg.CaptureFilter, "capture-filter", "", "A BPF expression that is ANDed with the generated capture filter.")
+	cmd.PersistentFlags().IntVar(&flowCfg.CaptureSnapLen, "capture-snaplen", capture.DefaultSnapLen, "Maximum number of bytes captured from each packet.")
+	cmd.PersistentFlags().IntVar(&flowCfg.CaptureBufferSize, "capture-buffer-size", 0, "Size in bytes of the kernel capture buffer. Leave this empty to use the libpcap default.")
+	cmd.PersistentFlags().BoolVar(&flowCfg.CapturePromiscuous, "capture-promiscuous", true, "Capture in promiscuous mode.")
+	cmd.PersistentFlags().DurationVar(&flowCfg.CaptureTimeout, "capture-timeout", 0, "How long packets are buffered before delivery. Leave this empty to deliver packets immediately.")
+	cmd.PersistentFlags().StringVar(&flowCfg.CaptureBackend, "capture-backend", capture.BackendPcap, "The packet capture backend: pcap or afpacket (Linux only).")
+	cmd.PersistentFlags().IntVar(&flowCfg.AFPacketBlockSize, "afpacket-block-size", capture.DefaultAFPacketBlockSize, "Size in bytes of each afpacket ring buffer block. Must be a multiple of the page size.")
+	cmd.PersistentFlags().IntVar(&flowCfg.AFPacketNumBlocks, "afpacket-num-blocks", capture.DefaultAFPacketNumBlocks, "Number of blocks in each afpacket ring buffer.")
+	cmd.PersistentFlags().IntVar(&flowCfg.AFPacketFanout, "afpacket-fanout", 1, "Number of afpacket sockets per interface to balance packets between.")
 	cmd.PersistentFlags().StringVar(&flowCfg.Middleware, "middleware", "", "A path to an executable that VHS will use as middleware.")
 	cmd.PersistentFlags().DurationVar(&flowCfg.TCPTimeout, "tcp-timeout", 5*time.Minute, "A length of time after which unused TCP connections are closed.")
+	cmd.PersistentFlags().IntVar(&flowCfg.TCPAssemblers, "tcp-assemblers", 1, "Number of TCP assemblers to shard connections between, each running on its own goroutine.")
+	cmd.PersistentFlags().IntVar(&flowCfg.TCPAssemblerQueueSize, "tcp-assembler-queue-size", 1024, "Number of packets that can be queued for each TCP assembler.")
+	cmd.PersistentFlags().DurationVar(&flowCfg.UDPTimeout, "udp-timeout", time.Minute, "A length of time after which idle UDP sessions are closed.")
+	cmd.PersistentFlags().StringVar(&flowCfg.TLSKeyLogFile, "tls-key-log-file", "", "Path to an NSS key log file used to decrypt captured TLS connections.")
+	cmd.PersistentFlags().StringVar(&flowCfg.ProxyUpstream, "proxy-upstream", "", "Address to which the proxy source forwards connections.")
+	cmd.PersistentFlags().StringVar(&flowCfg.ProxyCACert, "proxy-ca-cert", "", "Path to a PEM-encoded CA certificate used by the tlsproxy source to sign certificates.")
+	cmd.PersistentFlags().StringVar(&flowCfg.ProxyCAKey, "proxy-ca-key", "", "Path to the PEM-encoded private key of the tlsproxy CA certificate.")
 	cmd.PersistentFlags().DurationVar(&flowCfg.HTTPTimeout, "http-timeout", 30*time.Second, "A length of time after which an HTTP request is considered to have timed out.")
 	cmd.PersistentFlags().StringVar(&cfg.PrometheusAddr, "prometheus-address", "", "Address for Prometheus metrics HTTP endpoint.")
 	cmd.PersistentFlags().StringVar(&flowCfg.GCSBucketName, "gcs-bucket-name", "", "Bucket name for Google Cloud Storage")
-	cmd.PersistentFlags().StringVar(&flowCfg.GCSObjectName, "gcs-object-name", "", "Object name for Google Cloud Storage")
-	cmd.PersistentFlags().StringVar(&flowCfg.InputFile, "input-file", "", "Path to an input file")
+	cmd.PersistentFlags().StringVar(&flowCfg.GCSObjectName, "gcs-object-name", "", "Object name for Google Cloud Storage. Sources accept a glob pattern. Sinks treat it as a template in which {session}, {date}, {hostname}, and {seq} are replaced, and default to {session}. {seq} only tells apart the sinks of one process.")
+	cmd.PersistentFlags().StringVar(&flowCfg.GCSObjectPrefix, "gcs-object-prefix", "", "Prefix of object names in Google Cloud Storage. Sinks prepend it to the object name and sources read the objects under it.")
+	cmd.PersistentFlags().StringToStringVar(&flowCfg.ObjectLabels, "object-labels", nil, "Labels attached as metadata to objects written to cloud storage, as key=value pairs.")
+	cmd.PersistentFlags().Var(timeValue{&flowCfg.ObjectModifiedAfter}, "object-modified-after", "Read only objects from cloud storage that were modified at or after this RFC 3339 time.")
+	cmd.PersistentFlags().Var(timeValue{&flowCfg.ObjectModifiedBefore}, "object-modified-before", "Read only objects from cloud storage that were modified before this RFC 3339 time.")
+	cmd.PersistentFlags().IntVar(&flowCfg.ObjectDownloads, "object-downloads", 4, "Number of objects that are read from cloud storage at once.")
+	cmd.PersistentFlags().StringVar(&flowCfg.InputFile, "input-file", "", "Path to an input file, a directory of input files, or a glob pattern matching input files.")
+	cmd.PersistentFlags().BoolVar(&flowCfg.InputFileFollow, "input-file-follow", false, "Keep reading input files as they grow and read new input files as they appear.")
+	cmd.PersistentFlags().StringVar(&flowCfg.OutputFile, "output-file", "", "Path template for output files. {session}, {timestamp}, {date}, {hostname}, and {seq} are replaced.")
+	cmd.PersistentFlags().Int64Var(&flowCfg.OutputFileRotateSize, "output-file-rotate-size", 0, "Size in bytes after which a new output file is started. Leave this empty to disable.")
+	cmd.PersistentFlags().DurationVar(&flowCfg.OutputFileRotateInterval, "output-file-rotate-interval", 0, "Length of time after which a new output file is started. Leave this empty to disable.")
 
 	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatEndpoint, "s3-compat-endpoint", "", "URL for S3-compatible storage.")
 	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatAccessKey, "s3-compat-access-key", "", "Access key for S3-compatible storage.")
@@ -72,7 +102,9 @@ func newRootCmd() *cobra.Command {
 	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatToken, "s3-compat-token", "", "Security token for S3-compatible storage.")
 	cmd.PersistentFlags().BoolVar(&flowCfg.S3CompatSecure, "s3-compat-secure", true, "Encrypt communication for S3-compatible storage.")
 	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatBucketName, "s3-compat-bucket-name", "", "Bucket name for S3-compatible storage.")
-	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatObjectName, "s3-compat-object-name", "", "Object name for S3-compatible storage.")
+	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatObjectName, "s3-compat-object-name", "", "Object name for S3-compatible storage. Sources accept a glob pattern. Sinks treat it as a template in which {session}, {date}, {hostname}, and {seq} are replaced, and default to {session}. {seq} only tells apart the sinks of one process.")
+	cmd.PersistentFlags().StringVar(&flowCfg.S3CompatObjectPrefix, "s3-compat-object-prefix", "", "Prefix of object names in S3-compatible storage. Sinks prepend it to the object name and sources read the objects under it.")
+	cmd.PersistentFlags().Int64Var(&flowCfg.S3CompatPartSize, "s3-compat-part-size", s3compat.DefaultPartSize, "Size in bytes of each part of a multipart upload to S3-compatible storage. Must be at least 5 MiB.")
 
 	cmd.PersistentFlags().StringVar(&inputLine, "input", "", "Input description.")
 	cmd.PersistentFlags().StringSliceVar(&outputLines, "output", nil, "Output description.")
@@ -239,6 +271,12 @@ func defaultParser() *flow.Parser {
 	p := flow.NewParser()
 
 	p.LoadSource("tcp", tcp.NewSource)
+	p.LoadSource("pcap", tcp.NewPcapSource)
+	p.LoadSource("tcp-listen", tcp.NewListenSource)
+	p.LoadSource("packets", pcapx.NewSource)
+	p.LoadSource("udp", udp.NewSource)
+	p.LoadSource("proxy", proxy.NewSource)
+	p.LoadSource("tlsproxy", proxy.NewTLSSource)
 	p.LoadSource("gcs", gcs.NewSource)
 	p.LoadSource("file", file.NewSource)
 	p.LoadSource("s3compat", s3compat.NewSource)
@@ -247,15 +285,19 @@ func defaultParser() *flow.Parser {
 
 	p.LoadInputFormat("http", httpx.NewInputFormat)
 	p.LoadInputFormat("json", jsonx.NewInputFormat)
+	p.LoadInputFormat("pcapng", pcapx.NewInputFormat)
+	p.LoadInputFormat("tls", tlsmeta.NewInputFormat)
 
 	p.LoadOutputFormat("har", httpx.NewHAR)
 	p.LoadOutputFormat("json", jsonx.NewOutputFormat)
 	p.LoadOutputFormat("http", httpx.NewOutputFormat)
+	p.LoadOutputFormat("pcapng", pcapx.NewOutputFormat)
 
 	p.LoadOutputModifier("gzip", gzipx.NewOutputModifier)
 
 	p.LoadSink("gcs", gcs.NewSink)
 	p.LoadSink("s3compat", s3compat.NewSink)
+	p.LoadSink("file", file.NewSink)
 	p.LoadSink("stdout", func(_ core.Context) (core.Sink, error) {
 		return os.Stdout, nil
 	})
@@ -266,3 +308,28 @@ func defaultParser() *flow.Parser {
 
 	return p
 }
+
+// timeValue is a flag value that holds an RFC 3339 time.
+type timeValue struct {
+	t *time.Time
+}
+
+func (v timeValue) String() string {
+	if v.t == nil || v.t.IsZero() {
+		return ""
+	}
+	return v.t.Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	*v.t = t
+	return nil
+}
+
+func (v timeValue) Type() string {
+	return "time"
+}
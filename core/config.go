@@ -25,23 +25,68 @@ type FlowConfig struct {
 	Addr            string
 	AddrSink        string
 	CaptureResponse bool
+	CaptureEgress   bool
+	CaptureFilter   string
+	CaptureBackend  string
 	Middleware      string
 	HTTPTimeout     time.Duration
 
-	TCPTimeout time.Duration
+	CaptureSnapLen     int
+	CaptureBufferSize  int
+	CapturePromiscuous bool
+	CaptureTimeout     time.Duration
+
+	TCPTimeout            time.Duration
+	TCPAssemblers         int
+	TCPAssemblerQueueSize int
+
+	UDPTimeout time.Duration
+
+	TLSKeyLogFile string
+
+	ProxyUpstream string
+	ProxyCACert   string
+	ProxyCAKey    string
+
+	AFPacketBlockSize int
+	AFPacketNumBlocks int
+	AFPacketFanout    int
 
 	BufferOutput bool
 
-	GCSBucketName string
-	GCSObjectName string
+	ObjectLabels         map[string]string
+	ObjectModifiedAfter  time.Time
+	ObjectModifiedBefore time.Time
+	ObjectDownloads      int
 
-	InputFile string
+	GCSBucketName   string
+	GCSObjectName   string
+	GCSObjectPrefix string
+
+	InputFile       string
+	InputFileFollow bool
+
+	OutputFile               string
+	OutputFileRotateSize     int64
+	OutputFileRotateInterval time.Duration
+
+	S3CompatEndpoint     string
+	S3CompatAccessKey    string
+	S3CompatSecretKey    string
+	S3CompatToken        string
+	S3CompatSecure       bool
+	S3CompatBucketName   string
+	S3CompatObjectName   string
+	S3CompatObjectPrefix string
+	S3CompatPartSize     int64
+}
 
-	S3CompatEndpoint   string
-	S3CompatAccessKey  string
-	S3CompatSecretKey  string
-	S3CompatToken      string
-	S3CompatSecure     bool
-	S3CompatBucketName string
-	S3CompatObjectName string
+// SourceDurationElapsed returns a channel that receives once the
+// source duration has elapsed. A source duration of zero or less
+// is unlimited, so the channel never receives.
+func (c *FlowConfig) SourceDurationElapsed() <-chan time.Time {
+	if c.SourceDuration <= 0 {
+		return nil
+	}
+	return time.After(c.SourceDuration)
 }
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/assert"
+)
+
+func TestSourceDurationElapsed(t *testing.T) {
+	cases := []struct {
+		desc     string
+		duration time.Duration
+		elapsed  bool
+	}{
+		{
+			desc:     "elapsed",
+			duration: time.Millisecond,
+			elapsed:  true,
+		},
+		{
+			desc:     "unlimited",
+			duration: 0,
+		},
+		{
+			desc:     "negative",
+			duration: -time.Second,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			cfg := &FlowConfig{SourceDuration: c.duration}
+
+			var elapsed bool
+			select {
+			case <-cfg.SourceDurationElapsed():
+				elapsed = true
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			assert.Equal(t, c.elapsed, elapsed)
+		})
+	}
+}
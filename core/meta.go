@@ -66,3 +66,12 @@ func (m *Meta) GetString(key string) (string, bool) {
 	v, ok := m.values[key].(string)
 	return v, ok
 }
+
+// GetBool gets a bool value.
+func (m *Meta) GetBool(key string) (bool, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	v, ok := m.values[key].(bool)
+	return v, ok
+}
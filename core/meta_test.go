@@ -12,9 +12,10 @@ func TestMeta(t *testing.T) {
 	}
 
 	m := NewMeta("id", map[string]interface{}{
-		"str": "111",
-		"num": 111,
-		"fox": &fox{name: "Tails"},
+		"str":  "111",
+		"num":  111,
+		"bool": true,
+		"fox":  &fox{name: "Tails"},
 	})
 
 	assert.Equal(t, "id", m.SourceID)
@@ -23,6 +24,13 @@ func TestMeta(t *testing.T) {
 	assert.Assert(t, ok)
 	assert.Equal(t, n, "111")
 
+	b, ok := m.GetBool("bool")
+	assert.Assert(t, ok)
+	assert.Assert(t, b)
+
+	_, ok = m.GetBool("str")
+	assert.Assert(t, !ok)
+
 	f, ok := m.Get("fox")
 	assert.Assert(t, ok)
 	assert.Equal(t, "Tails", f.(*fox).name)
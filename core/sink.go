@@ -4,3 +4,14 @@ import "io"
 
 // Sink is a writable location for output.
 type Sink io.WriteCloser
+
+// SegmentedSink is a sink that splits its output into segments,
+// such as rotated files. Output modifiers are applied to each
+// segment rather than to the whole output, so that every
+// segment is complete on its own.
+type SegmentedSink interface {
+	Sink
+	// WrapSegments sets the modifiers applied to each
+	// segment, returning the writer for the output.
+	WrapSegments(OutputModifiers) (OutputWriter, error)
+}
@@ -2,20 +2,43 @@ package file
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/rename-this/vhs/core"
 )
 
-// NewSource creates a new file source.
-func NewSource(_ core.Context) (core.Source, error) {
+// pollInterval is how often followed files
+// are checked for new data and new files.
+const pollInterval = 250 * time.Millisecond
+
+// idleTimeout is how long a followed file may stop growing
+// before it is finished if a newer file matches.
+const idleTimeout = time.Minute
+
+// NewSource creates a new file source. The input file may be a file,
+// a directory whose files are read, or a glob pattern. Each file is
+// read as its own stream, in name order. In follow mode the source
+// keeps reading files as they grow and reads new files as they
+// appear, like tail -F, until it is canceled.
+func NewSource(ctx core.Context) (core.Source, error) {
 	return &source{
-		streams: make(chan core.InputReader),
+		streams:  make(chan core.InputReader),
+		follow:   ctx.FlowConfig.InputFileFollow,
+		interval: pollInterval,
+		idle:     idleTimeout,
 	}, nil
 }
 
 type source struct {
-	streams chan core.InputReader
+	streams  chan core.InputReader
+	follow   bool
+	interval time.Duration
+	idle     time.Duration
 }
 
 func (s *source) Init(ctx core.Context) {
@@ -25,15 +48,35 @@ func (s *source) Init(ctx core.Context) {
 		Str(core.LoggerKeyComponent, "file_source").
 		Logger()
 
-	file, err := os.Open(ctx.FlowConfig.InputFile)
+	if s.follow {
+		s.followFiles(ctx)
+		return
+	}
+
+	names, err := match(ctx.FlowConfig.InputFile)
 	if err != nil {
-		ctx.Errors <- fmt.Errorf("failed to open %s: %w", ctx.FlowConfig.InputFile, err)
+		ctx.Errors <- err
+		return
+	}
+
+	if len(names) == 0 {
+		ctx.Errors <- fmt.Errorf("no files match %s", ctx.FlowConfig.InputFile)
 		return
 	}
 
-	s.streams <- &fileReader{
-		file: file,
-		meta: core.NewMeta(ctx.FlowConfig.InputFile, nil),
+	for _, name := range names {
+		file, err := os.Open(name)
+		if err != nil {
+			ctx.Errors <- fmt.Errorf("failed to open %s: %w", name, err)
+			continue
+		}
+
+		ctx.Logger.Debug().Str("name", name).Msg("reading file")
+
+		s.streams <- &fileReader{
+			file: file,
+			meta: core.NewMeta(name, nil),
+		}
 	}
 }
 
@@ -41,6 +84,65 @@ func (s *source) Streams() <-chan core.InputReader {
 	return s.streams
 }
 
+// match returns the files named by an input file in name order.
+func match(input string) ([]string, error) {
+	if isPattern(input) {
+		names, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match %s: %w", input, err)
+		}
+		return regularFiles(names)
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", input, err)
+	}
+
+	if !info.IsDir() {
+		return []string{input}, nil
+	}
+
+	infos, err := ioutil.ReadDir(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory %s: %w", input, err)
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.Mode().IsRegular() {
+			names = append(names, filepath.Join(input, info.Name()))
+		}
+	}
+
+	return names, nil
+}
+
+// regularFiles returns the names of regular files in name order.
+func regularFiles(names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", name, err)
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, name)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
 type fileReader struct {
 	file *os.File
 	meta *core.Meta
@@ -1,7 +1,10 @@
 package file
 
 import (
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -57,3 +60,302 @@ func TestNewSource(t *testing.T) {
 		})
 	}
 }
+
+func TestSourceFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-file-source")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.json", "a.json", "c.har"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(name[:1]), 0644)
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "d.json"), 0755))
+
+	cases := []struct {
+		desc        string
+		file        string
+		expected    []string
+		errContains string
+	}{
+		{
+			desc:     "directory",
+			file:     dir,
+			expected: []string{"a.json", "b.json", "c.har"},
+		},
+		{
+			desc:     "pattern",
+			file:     filepath.Join(dir, "*.json"),
+			expected: []string{"a.json", "b.json"},
+		},
+		{
+			desc:        "no match",
+			file:        filepath.Join(dir, "*.pcap"),
+			errContains: "no files match",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs = make(chan error, 1)
+				ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{InputFile: c.file}, errs)
+			)
+			defer ctx.Cancel()
+
+			s, err := NewSource(ctx)
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+
+			var names []string
+			for r := range s.Streams() {
+				b, err := ioutil.ReadAll(r)
+				assert.NilError(t, err)
+				assert.NilError(t, r.Close())
+
+				name := filepath.Base(r.Meta().SourceID)
+				assert.Equal(t, name[:1], string(b))
+
+				names = append(names, name)
+			}
+
+			if c.errContains != "" {
+				assert.Equal(t, 1, len(errs))
+				assert.ErrorContains(t, <-errs, c.errContains)
+				return
+			}
+
+			assert.DeepEqual(t, c.expected, names)
+			assert.Equal(t, 0, len(errs))
+		})
+	}
+}
+
+// newFollowSource starts a source that follows files
+// with no source duration.
+func newFollowSource(t *testing.T, file string) (core.Context, core.Source) {
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		InputFile:       file,
+		InputFileFollow: true,
+	}, make(chan error, 1))
+
+	s, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s.(*source).interval = 10 * time.Millisecond
+
+	go s.Init(ctx)
+
+	return ctx, s
+}
+
+func readString(t *testing.T, r io.Reader, n int) string {
+	b := make([]byte, n)
+	_, err := io.ReadFull(r, b)
+	assert.NilError(t, err)
+	return string(b)
+}
+
+func appendFile(t *testing.T, name, data string) {
+	f, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.NilError(t, err)
+	_, err = f.WriteString(data)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+}
+
+func TestSourceFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-file-source")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		first  = filepath.Join(dir, "out-000000.json")
+		second = filepath.Join(dir, "out-000001.json")
+	)
+
+	ctx, s := newFollowSource(t, filepath.Join(dir, "out-*.json"))
+
+	// Files that appear later are read.
+	appendFile(t, first, "111")
+
+	r1 := <-s.Streams()
+	assert.Equal(t, first, r1.Meta().SourceID)
+	assert.Equal(t, "111", readString(t, r1, 3))
+
+	// Data appended to a file is read.
+	appendFile(t, first, "222")
+	assert.Equal(t, "222", readString(t, r1, 3))
+
+	// A new file does not finish the previous
+	// one, so both are read as they grow.
+	appendFile(t, second, "333")
+
+	r2 := <-s.Streams()
+	assert.Equal(t, second, r2.Meta().SourceID)
+	assert.Equal(t, "333", readString(t, r2, 3))
+
+	appendFile(t, first, "444")
+	assert.Equal(t, "444", readString(t, r1, 3))
+
+	// A removed file is finished, and its stream
+	// ends once the rest of its data is read.
+	appendFile(t, first, "555")
+	assert.NilError(t, os.Remove(first))
+
+	rest, err := ioutil.ReadAll(r1)
+	assert.NilError(t, err)
+	assert.Equal(t, "555", string(rest))
+	assert.NilError(t, r1.Close())
+
+	appendFile(t, second, "666")
+	assert.Equal(t, "666", readString(t, r2, 3))
+
+	// Files are read until the source stops.
+	ctx.Cancel()
+
+	rest, err = ioutil.ReadAll(r2)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(rest))
+	assert.NilError(t, r2.Close())
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+	assert.Equal(t, 0, len(ctx.Errors))
+}
+
+func TestSourceFollowRename(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-file-source")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "app.log")
+	appendFile(t, name, "111")
+
+	ctx, s := newFollowSource(t, name+"*")
+	defer ctx.Cancel()
+
+	r1 := <-s.Streams()
+	assert.Equal(t, "111", readString(t, r1, 3))
+
+	// A renamed file is not read again, and the
+	// file that replaces it is read from the start.
+	appendFile(t, name, "222")
+	assert.NilError(t, os.Rename(name, name+".1"))
+	time.Sleep(10 * time.Millisecond)
+	appendFile(t, name, "333")
+
+	r2 := <-s.Streams()
+	assert.Equal(t, name, r2.Meta().SourceID)
+	assert.Equal(t, "333", readString(t, r2, 3))
+
+	rest, err := ioutil.ReadAll(r1)
+	assert.NilError(t, err)
+	assert.Equal(t, "222", string(rest))
+	assert.NilError(t, r1.Close())
+	assert.NilError(t, r2.Close())
+
+	select {
+	case r := <-s.Streams():
+		t.Fatalf("unexpected stream %s", r.Meta().SourceID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSourceFollowDuration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-file-source")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		InputFile:       dir,
+		InputFileFollow: true,
+		SourceDuration:  50 * time.Millisecond,
+	}, make(chan error, 1))
+	defer ctx.Cancel()
+
+	s, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s.(*source).interval = 10 * time.Millisecond
+
+	go s.Init(ctx)
+
+	select {
+	case _, more := <-s.Streams():
+		assert.Assert(t, !more)
+	case <-time.After(time.Second):
+		t.Fatal("source did not stop")
+	}
+}
+
+func TestSourceFollowIdle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-file-source")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		first  = filepath.Join(dir, "out-000000.json")
+		second = filepath.Join(dir, "out-000001.json")
+	)
+
+	appendFile(t, first, "111")
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		InputFile:       filepath.Join(dir, "out-*.json"),
+		InputFileFollow: true,
+	}, make(chan error, 1))
+	defer ctx.Cancel()
+
+	s, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s.(*source).interval = 10 * time.Millisecond
+	s.(*source).idle = 50 * time.Millisecond
+
+	go s.Init(ctx)
+
+	r1 := <-s.Streams()
+	assert.Equal(t, "111", readString(t, r1, 3))
+
+	// An idle file is not finished while it is the newest.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		rest, err := ioutil.ReadAll(r1)
+		assert.Check(t, err)
+		assert.Check(t, string(rest) == "", string(rest))
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("idle file finished without a newer file")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// It is finished once a newer file matches, such
+	// as the next segment of a rotated output.
+	past := time.Now().Add(-time.Hour)
+	assert.NilError(t, os.Chtimes(first, past, past))
+	appendFile(t, second, "222")
+
+	r2 := <-s.Streams()
+	assert.Equal(t, "222", readString(t, r2, 3))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("idle file not finished")
+	}
+	assert.NilError(t, r1.Close())
+
+	// The finished file is not read again.
+	select {
+	case r := <-s.Streams():
+		t.Fatalf("unexpected stream %s", r.Meta().SourceID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NilError(t, r2.Close())
+	assert.Equal(t, 0, len(ctx.Errors))
+}
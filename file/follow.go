@@ -0,0 +1,226 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+)
+
+// followFiles reads the files named by the input file until the
+// source duration, if any, elapses or the source is canceled,
+// checking for new files at each interval. Each file is read from
+// the start and followed as it grows until it is finished: once the
+// name it was opened by has been removed or refers to another file,
+// or once it has stopped growing for the idle timeout and a newer
+// file matches, such as the next segment of a rotated output. A
+// finished file's stream ends once it is read to the end.
+func (s *source) followFiles(ctx core.Context) {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.FlowConfig.SourceDurationElapsed():
+			ctx.Logger.Debug().Msg("source duration elapsed")
+		case <-ctx.StdContext.Done():
+		}
+		close(stop)
+	}()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	f := &follower{
+		source: s,
+		stop:   stop,
+	}
+
+	for {
+		names, err := match(ctx.FlowConfig.InputFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			ctx.Errors <- err
+			return
+		}
+
+		if !f.update(ctx, names) {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// follower tracks the files read in follow mode. Files are
+// identified by their identity rather than their name, so a
+// file that is renamed is not read again.
+type follower struct {
+	source *source
+	stop   <-chan struct{}
+	files  []*followedFile
+}
+
+// emit emits a stream unless the source has stopped. It
+// reports whether the source may continue emitting streams.
+func (f *follower) emit(ctx core.Context, r core.InputReader) bool {
+	select {
+	case f.source.streams <- r:
+		ctx.Logger.Debug().Str("name", r.Meta().SourceID).Msg("following file")
+		return true
+	case <-f.stop:
+		r.Close()
+		return false
+	}
+}
+
+// followedFile is a file that has been read.
+type followedFile struct {
+	name string
+	info os.FileInfo
+	r    *followReader
+
+	// grown is when the file was last seen to grow.
+	grown time.Time
+}
+
+// update reads new files and finishes those that have been
+// removed or replaced at the name they were opened by, or that
+// are idle while a newer file matches. It reports whether the
+// source may continue.
+func (f *follower) update(ctx core.Context, names []string) bool {
+	var (
+		now    = time.Now()
+		files  []*followedFile
+		infos  = make(map[string]os.FileInfo, len(names))
+		newest time.Time
+	)
+
+	defer func() {
+		for _, ff := range f.files {
+			if info, ok := infos[ff.name]; !ok || !os.SameFile(ff.info, info) {
+				ff.r.finish()
+			}
+		}
+
+		// Idle files stay followed until they are removed,
+		// so that they are not read again.
+		for _, ff := range files {
+			if now.Sub(ff.grown) >= f.source.idle && newest.After(ff.info.ModTime()) {
+				ff.r.finish()
+			}
+		}
+
+		f.files = files
+	}()
+
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			continue
+		}
+
+		infos[name] = info
+
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+
+		if ff := f.find(info); ff != nil {
+			if info.Size() != ff.info.Size() {
+				ff.grown = now
+			}
+			ff.info = info
+			files = append(files, ff)
+			continue
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			ctx.Errors <- err
+			continue
+		}
+
+		ff := &followedFile{
+			name:  name,
+			info:  info,
+			grown: now,
+			r: &followReader{
+				file:     file,
+				meta:     core.NewMeta(name, nil),
+				interval: f.source.interval,
+				stop:     f.stop,
+				finished: make(chan struct{}),
+			},
+		}
+
+		files = append(files, ff)
+
+		if !f.emit(ctx, ff.r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// find returns the followed file that is the same file as info.
+func (f *follower) find(info os.FileInfo) *followedFile {
+	for _, ff := range f.files {
+		if os.SameFile(ff.info, info) {
+			return ff
+		}
+	}
+	return nil
+}
+
+// followReader reads a file that may still be growing. At the
+// end of the file it waits for more data until the file is
+// finished or the source is canceled.
+type followReader struct {
+	file     *os.File
+	meta     *core.Meta
+	interval time.Duration
+	stop     <-chan struct{}
+	finished chan struct{}
+	once     sync.Once
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.file.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		select {
+		case <-r.finished:
+			// Data written before the file was
+			// finished is read before the end.
+			return r.file.Read(p)
+		case <-r.stop:
+			return 0, io.EOF
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// finish marks the file as finished.
+func (r *followReader) finish() {
+	r.once.Do(func() {
+		close(r.finished)
+	})
+}
+
+func (r *followReader) Close() error {
+	r.finish()
+	return r.file.Close()
+}
+
+func (r *followReader) Meta() *core.Meta {
+	return r.meta
+}
@@ -0,0 +1,237 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/nametmpl"
+)
+
+// NewSink creates a new file sink. Output is written to files named
+// by the output file template. If a rotation size or interval is
+// set, a new file is started whenever the current one reaches the
+// size or age, and output modifiers are applied to each file.
+func NewSink(ctx core.Context) (core.Sink, error) {
+	cfg := ctx.FlowConfig
+
+	if cfg.OutputFile == "" {
+		return nil, errors.New("output file is required")
+	}
+	if cfg.OutputFileRotateSize < 0 || cfg.OutputFileRotateInterval < 0 {
+		return nil, errors.New("output file rotation thresholds must not be negative")
+	}
+
+	rotate := cfg.OutputFileRotateSize > 0 || cfg.OutputFileRotateInterval > 0
+	if rotate && !strings.Contains(cfg.OutputFile, nametmpl.Seq) {
+		return nil, fmt.Errorf("output file must contain %s to be rotated", nametmpl.Seq)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "file_sink").
+		Logger()
+
+	return &sink{
+		ctx:      ctx,
+		tmpl:     cfg.OutputFile,
+		hostname: hostname,
+		maxSize:  cfg.OutputFileRotateSize,
+		interval: cfg.OutputFileRotateInterval,
+		now:      time.Now,
+	}, nil
+}
+
+// sink writes output to a sequence of files. Each file is
+// a segment to which the output modifiers are applied.
+type sink struct {
+	ctx      core.Context
+	tmpl     string
+	hostname string
+	maxSize  int64
+	interval time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	mods   core.OutputModifiers
+	seq    int
+	seg    *segment
+	closed bool
+}
+
+// segment is a file that is being written.
+type segment struct {
+	w      core.OutputWriter
+	f      *countingFile
+	opened time.Time
+	timer  *time.Timer
+}
+
+func (s *sink) WrapSegments(mods core.OutputModifiers) (core.OutputWriter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.mods = mods
+
+	return s, nil
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, os.ErrClosed
+	}
+
+	if s.seg != nil && s.full() {
+		if err := s.closeSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	if s.seg == nil {
+		if err := s.openSegment(); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.seg.w.Write(p)
+}
+
+func (s *sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	if s.seg == nil {
+		return nil
+	}
+
+	return s.closeSegment()
+}
+
+// full reports whether the current segment has reached
+// the rotation size or interval. s.mu must be held.
+func (s *sink) full() bool {
+	if s.maxSize > 0 && s.seg.f.n >= s.maxSize {
+		return true
+	}
+	if s.interval > 0 && s.now().Sub(s.seg.opened) >= s.interval {
+		return true
+	}
+	return false
+}
+
+// openSegment creates the next file. s.mu must be held.
+func (s *sink) openSegment() error {
+	var (
+		opened = s.now()
+		name   = nametmpl.Expand(s.tmpl, nametmpl.Values{
+			SessionID: s.ctx.SessionID,
+			Time:      opened,
+			Hostname:  s.hostname,
+			Seq:       s.seq,
+		})
+	)
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", name, err)
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	cf := &countingFile{f: f}
+
+	w, err := s.mods.Wrap(cf)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to wrap %s: %w", name, err)
+	}
+
+	s.seg = &segment{
+		w:      w,
+		f:      cf,
+		opened: opened,
+	}
+	s.seq++
+
+	// Segments are closed once their interval has elapsed,
+	// even if there is nothing more to write, so that they
+	// can be shipped.
+	if s.interval > 0 {
+		seg := s.seg
+		seg.timer = time.AfterFunc(s.interval, func() {
+			s.expire(seg)
+		})
+	}
+
+	s.ctx.Logger.Debug().Str("name", name).Msg("opened file")
+
+	return nil
+}
+
+// closeSegment closes the current file. s.mu must be held.
+func (s *sink) closeSegment() error {
+	seg := s.seg
+	s.seg = nil
+
+	if seg.timer != nil {
+		seg.timer.Stop()
+	}
+
+	if err := seg.w.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", seg.f.f.Name(), err)
+	}
+
+	s.ctx.Logger.Debug().
+		Str("name", seg.f.f.Name()).
+		Int64("size", seg.f.n).
+		Msg("closed file")
+
+	return nil
+}
+
+// expire closes a segment whose interval has elapsed
+// if it is still being written.
+func (s *sink) expire(seg *segment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seg != seg {
+		return
+	}
+
+	if err := s.closeSegment(); err != nil {
+		s.ctx.Errors <- fmt.Errorf("failed to rotate file: %w", err)
+	}
+}
+
+// countingFile is a file that counts the bytes written to it.
+type countingFile struct {
+	f *os.File
+	n int64
+}
+
+func (c *countingFile) Write(p []byte) (int, error) {
+	n, err := c.f.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingFile) Close() error {
+	return c.f.Close()
+}
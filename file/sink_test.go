@@ -0,0 +1,229 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/gzipx"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewSink(t *testing.T) {
+	cases := []struct {
+		desc        string
+		cfg         core.FlowConfig
+		errContains string
+	}{
+		{
+			desc: "success",
+			cfg:  core.FlowConfig{OutputFile: "out.json"},
+		},
+		{
+			desc: "rotate",
+			cfg: core.FlowConfig{
+				OutputFile:           "out-{seq}.json",
+				OutputFileRotateSize: 10,
+			},
+		},
+		{
+			desc:        "no file",
+			errContains: "output file is required",
+		},
+		{
+			desc: "negative size",
+			cfg: core.FlowConfig{
+				OutputFile:           "out-{seq}.json",
+				OutputFileRotateSize: -1,
+			},
+			errContains: "must not be negative",
+		},
+		{
+			desc: "rotate without seq",
+			cfg: core.FlowConfig{
+				OutputFile:               "out-{timestamp}.json",
+				OutputFileRotateInterval: time.Minute,
+			},
+			errContains: "must contain {seq}",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			cfg := c.cfg
+			ctx := core.NewContext(&core.Config{}, &cfg, nil)
+			_, err := NewSink(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+// writeSink writes each message to a sink with
+// gzip applied to each segment, then closes it.
+func writeSink(t *testing.T, s *sink, msgs []string) {
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+
+	gz, err := gzipx.NewOutputModifier(ctx)
+	assert.NilError(t, err)
+
+	w, err := s.WrapSegments(core.OutputModifiers{gz})
+	assert.NilError(t, err)
+
+	for _, msg := range msgs {
+		_, err := w.Write([]byte(msg))
+		assert.NilError(t, err)
+	}
+
+	assert.NilError(t, w.Close())
+}
+
+// readSegments reads the gzipped files in a directory in name order.
+func readSegments(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NilError(t, err)
+
+	var segments []string
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		assert.NilError(t, err)
+
+		gr, err := gzip.NewReader(bytes.NewReader(b))
+		assert.NilError(t, err)
+
+		// Each segment must be a single complete member.
+		gr.Multistream(false)
+
+		data, err := ioutil.ReadAll(gr)
+		assert.NilError(t, err)
+
+		segments = append(segments, string(data))
+	}
+
+	return segments
+}
+
+func newTestSink(t *testing.T, cfg *core.FlowConfig) (*sink, string) {
+	dir, err := ioutil.TempDir("", "vhs-file-sink")
+	assert.NilError(t, err)
+
+	cfg.OutputFile = filepath.Join(dir, cfg.OutputFile)
+
+	ctx := core.NewContext(&core.Config{}, cfg, make(chan error, 1))
+	ctx.SessionID = "session"
+
+	s, err := NewSink(ctx)
+	assert.NilError(t, err)
+
+	return s.(*sink), dir
+}
+
+func TestSink(t *testing.T) {
+	s, dir := newTestSink(t, &core.FlowConfig{
+		OutputFile: "{session}/out.json.gz",
+	})
+	defer os.RemoveAll(dir)
+
+	writeSink(t, s, []string{"111", "222", "333"})
+
+	assert.DeepEqual(t, []string{"111222333"}, readSegments(t, filepath.Join(dir, "session")))
+}
+
+func TestSinkRotateSize(t *testing.T) {
+	s, dir := newTestSink(t, &core.FlowConfig{
+		OutputFile:           "out-{seq}.json.gz",
+		OutputFileRotateSize: 1,
+	})
+	defer os.RemoveAll(dir)
+
+	writeSink(t, s, []string{"111", "222", "333"})
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{
+		filepath.Join(dir, "out-000000.json.gz"),
+		filepath.Join(dir, "out-000001.json.gz"),
+		filepath.Join(dir, "out-000002.json.gz"),
+	}, names)
+
+	assert.DeepEqual(t, []string{"111", "222", "333"}, readSegments(t, dir))
+}
+
+func TestSinkRotateInterval(t *testing.T) {
+	s, dir := newTestSink(t, &core.FlowConfig{
+		OutputFile:               "out-{seq}-{timestamp}.json.gz",
+		OutputFileRotateInterval: time.Hour,
+	})
+	defer os.RemoveAll(dir)
+
+	var (
+		now   = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+		times = []time.Time{now, now.Add(time.Minute), now.Add(time.Hour), now.Add(3 * time.Hour)}
+	)
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+	gz, err := gzipx.NewOutputModifier(ctx)
+	assert.NilError(t, err)
+
+	w, err := s.WrapSegments(core.OutputModifiers{gz})
+	assert.NilError(t, err)
+
+	for i, msg := range []string{"111", "222", "333", "444"} {
+		s.now = func() time.Time { return times[i] }
+		_, err := w.Write([]byte(msg))
+		assert.NilError(t, err)
+	}
+	assert.NilError(t, w.Close())
+
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{
+		filepath.Join(dir, "out-000000-20200901T000000Z.json.gz"),
+		filepath.Join(dir, "out-000001-20200901T010000Z.json.gz"),
+		filepath.Join(dir, "out-000002-20200901T030000Z.json.gz"),
+	}, names)
+
+	assert.DeepEqual(t, []string{"111222", "333", "444"}, readSegments(t, dir))
+}
+
+func TestSinkRotateIdle(t *testing.T) {
+	s, dir := newTestSink(t, &core.FlowConfig{
+		OutputFile:               "out-{seq}.json.gz",
+		OutputFileRotateInterval: 10 * time.Millisecond,
+	})
+	defer os.RemoveAll(dir)
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+	gz, err := gzipx.NewOutputModifier(ctx)
+	assert.NilError(t, err)
+
+	w, err := s.WrapSegments(core.OutputModifiers{gz})
+	assert.NilError(t, err)
+
+	_, err = w.Write([]byte("111"))
+	assert.NilError(t, err)
+
+	// The segment is closed once its interval
+	// elapses, while the sink is still open.
+	for {
+		s.mu.Lock()
+		open := s.seg != nil
+		s.mu.Unlock()
+		if !open {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.DeepEqual(t, []string{"111"}, readSegments(t, dir))
+
+	assert.NilError(t, w.Close())
+	assert.Equal(t, 0, len(s.ctx.Errors))
+}
@@ -44,7 +44,7 @@ func (o *Output) Init(ctx core.Context) {
 		o.done <- struct{}{}
 	}()
 
-	w, err := o.Modifiers.Wrap(o.Sink)
+	w, err := o.wrap()
 	if err != nil {
 		ctx.Errors <- fmt.Errorf("failed to wrap sink: %w", err)
 		return
@@ -59,6 +59,15 @@ func (o *Output) Init(ctx core.Context) {
 	o.Format.Init(ctx, w)
 }
 
+// wrap wraps the sink in the modifiers. Segmented
+// sinks apply the modifiers to each segment.
+func (o *Output) wrap() (core.OutputWriter, error) {
+	if s, ok := o.Sink.(core.SegmentedSink); ok {
+		return s.WrapSegments(o.Modifiers)
+	}
+	return o.Modifiers.Wrap(o.Sink)
+}
+
 // Write writes to the output.
 func (o *Output) Write(n interface{}) {
 	o.Format.In() <- n
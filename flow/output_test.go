@@ -108,3 +108,39 @@ func TestOutput(t *testing.T) {
 		})
 	}
 }
+
+type testSegmentedSink struct {
+	coretest.TestSink
+	mods core.OutputModifiers
+}
+
+func (s *testSegmentedSink) WrapSegments(mods core.OutputModifiers) (core.OutputWriter, error) {
+	s.mods = mods
+	return s, nil
+}
+
+func TestOutputSegmentedSink(t *testing.T) {
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		mods = core.OutputModifiers{&coretest.TestDoubleOutputModifier{}}
+		s    = &testSegmentedSink{}
+		o    = NewOutput(coretest.NewTestOutputFormatNoErr(ctx), mods, s)
+	)
+
+	go o.Init(ctx)
+
+	for _, d := range []interface{}{1, 2, 3} {
+		o.Format.In() <- d
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	ctx.Cancel()
+	<-o.Done()
+
+	// The modifiers are left to the sink.
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, "123", string(s.Data()))
+	assert.DeepEqual(t, mods, s.mods)
+}
@@ -1,10 +1,19 @@
 package gcs
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/nametmpl"
+	"github.com/rename-this/vhs/internal/objects"
+	"google.golang.org/api/iterator"
 )
 
 type newClientFn func(core.Context) (*storage.Client, error)
@@ -13,7 +22,11 @@ func newClient(ctx core.Context) (*storage.Client, error) {
 	return storage.NewClient(ctx.StdContext)
 }
 
-// NewSink creates a new Google Cloud Storage sink.
+// NewSink creates a new Google Cloud Storage sink. The object
+// is named by the object name template and prefix, and the
+// object labels are attached to it as metadata. The object is
+// uploaded when the sink is closed. If the flow stops and the
+// sink is not closed within a minute, the upload is aborted.
 func NewSink(ctx core.Context) (core.Sink, error) {
 	return newSink(ctx, newClient)
 }
@@ -25,6 +38,11 @@ func newSink(ctx core.Context, newClient newClientFn) (core.Sink, error) {
 
 	ctx.Logger.Debug().Msg("creating sink")
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
 	c, err := newClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create client: %w", err)
@@ -37,35 +55,140 @@ func newSink(ctx core.Context, newClient newClientFn) (core.Sink, error) {
 		return nil, fmt.Errorf("failed to find bucket: %w", err)
 	}
 
-	ctx.Logger.Debug().Msg("creating writer")
+	name := nametmpl.Object(ctx.FlowConfig.GCSObjectPrefix, ctx.FlowConfig.GCSObjectName, nametmpl.Values{
+		SessionID: ctx.SessionID,
+		Time:      time.Now(),
+		Hostname:  hostname,
+		Seq:       nametmpl.NextObjectSeq(),
+	})
+
+	ctx.Logger.Debug().Str("name", name).Msg("creating writer")
+
+	// Sinks are still written to and closed while a flow shuts
+	// down, after the session context is canceled, so the upload
+	// is not bound to it.
+	uploadCtx, cancel := context.WithCancel(context.Background())
+
+	w := b.Object(name).NewWriter(uploadCtx)
+	w.Metadata = ctx.FlowConfig.ObjectLabels
+
+	s := &sink{
+		ctx:          ctx,
+		w:            w,
+		cancel:       cancel,
+		abortTimeout: abortTimeout,
+		closed:       make(chan struct{}),
+	}
+
+	go objects.AbortIfNotClosed(ctx, s.closed, s.abortTimeout, s.abort)
+
+	return s, nil
+}
+
+// abortTimeout is how long a sink may remain open
+// after its flow stops before its upload is aborted.
+var abortTimeout = objects.AbortTimeout
+
+type sink struct {
+	ctx          core.Context
+	w            *storage.Writer
+	cancel       context.CancelFunc
+	abortTimeout time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+
+	// mu is held while the sink is closed or aborted.
+	mu      sync.Mutex
+	aborted bool
+}
 
-	return b.Object(ctx.SessionID).NewWriter(ctx.StdContext), nil
+func (s *sink) Write(p []byte) (int, error) {
+	return s.w.Write(p)
 }
 
-// NewSource creates a new Google Cloud Storage source.
+func (s *sink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	if s.aborted {
+		return fmt.Errorf("upload aborted because the sink was not closed within %s of the flow stopping", s.abortTimeout)
+	}
+
+	defer s.cancel()
+
+	if err := s.w.Close(); err != nil {
+		return fmt.Errorf("failed to upload object: %w", err)
+	}
+
+	s.ctx.Logger.Debug().Msg("sink closed")
+
+	return nil
+}
+
+// abort cancels the upload of a sink that was
+// not closed in time after its flow stopped.
+func (s *sink) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The sink was closed while waiting for the lock.
+	select {
+	case <-s.closed:
+		return
+	default:
+	}
+
+	s.ctx.Logger.Error().Msg("sink not closed after flow stopped, aborting upload")
+
+	s.aborted = true
+	s.cancel()
+}
+
+// NewSource creates a new Google Cloud Storage source. It reads
+// the object named by the object name and prefix or, if the name
+// is empty or a glob pattern, lists the objects under the prefix
+// and reads those that match and that were modified in the time
+// range, in name order, with one stream per object.
 func NewSource(ctx core.Context) (core.Source, error) {
-	return newSource(ctx, newClient), nil
+	return newSource(ctx, newClient)
 }
 
-func newSource(ctx core.Context, newClient newClientFn) core.Source {
+func newSource(ctx core.Context, newClient newClientFn) (core.Source, error) {
 	ctx.Logger.Debug().Msg("creating gcs source")
+
+	sel, err := objects.NewSelector(
+		ctx.FlowConfig.GCSObjectPrefix,
+		ctx.FlowConfig.GCSObjectName,
+		ctx.FlowConfig.ObjectModifiedAfter,
+		ctx.FlowConfig.ObjectModifiedBefore,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select objects: %w", err)
+	}
+
 	return &gcsSource{
-		streams:   make(chan core.InputReader),
+		emitter:   objects.NewEmitter(ctx.FlowConfig.ObjectDownloads),
 		newClient: newClient,
-	}
+		sel:       sel,
+	}, nil
 }
 
 type gcsSource struct {
-	streams   chan core.InputReader
+	emitter   *objects.Emitter
 	newClient newClientFn
+	sel       objects.Selector
 }
 
 func (s *gcsSource) Streams() <-chan core.InputReader {
-	return s.streams
+	return s.emitter.Streams()
 }
 
 func (s *gcsSource) Init(ctx core.Context) {
-	defer close(s.streams)
+	defer s.emitter.Close()
 
 	ctx.Logger = ctx.Logger.With().
 		Str(core.LoggerKeyComponent, "gcs_source").
@@ -87,26 +210,44 @@ func (s *gcsSource) Init(ctx core.Context) {
 
 	ctx.Logger.Debug().Msg("bucket found")
 
-	o := b.Object(ctx.FlowConfig.GCSObjectName)
-	r, err := o.NewReader(ctx.StdContext)
-	if err != nil {
-		ctx.Errors <- fmt.Errorf("failed to create object reader: %w", err)
+	if name, ok := s.sel.Single(); ok {
+		s.emitter.Emit(ctx, name, open(b))
 		return
 	}
 
-	ctx.Logger.Debug().Msg("reader created")
-
-	s.streams <- &gcsStream{
-		Reader: r,
-		meta:   core.NewMeta(ctx.FlowConfig.GCSObjectName, nil),
+	it := b.Objects(ctx.StdContext, &storage.Query{
+		Prefix: s.sel.ListPrefix(),
+	})
+
+	for {
+		attrs, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			ctx.Errors <- fmt.Errorf("failed to list objects: %w", err)
+			return
+		}
+
+		if !s.sel.Match(attrs.Name, attrs.Updated) {
+			continue
+		}
+
+		if !s.emitter.Emit(ctx, attrs.Name, open(b)) {
+			return
+		}
 	}
-}
 
-type gcsStream struct {
-	*storage.Reader
-	meta *core.Meta
+	ctx.Logger.Debug().Msg("all objects read")
 }
 
-func (s *gcsStream) Meta() *core.Meta {
-	return s.meta
+// open opens an object in a bucket for reading.
+func open(b *storage.BucketHandle) objects.OpenFn {
+	return func(ctx context.Context, name string) (io.ReadCloser, error) {
+		r, err := b.Object(name).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create object reader for %s: %w", name, err)
+		}
+		return r, nil
+	}
 }
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/storage"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/objects"
 	"gotest.tools/v3/assert"
 )
 
@@ -19,19 +22,40 @@ func TestNewSink(t *testing.T) {
 	server := fakestorage.NewServer([]fakestorage.Object{{BucketName: bucketName}})
 	defer server.Stop()
 
+	hostname, err := os.Hostname()
+	assert.NilError(t, err)
+
 	cases := []struct {
-		desc        string
-		bucketName  string
-		sessionID   string
-		data        string
-		errContains string
-		newClientFn newClientFn
+		desc         string
+		bucketName   string
+		sessionID    string
+		objectName   string
+		objectPrefix string
+		labels       map[string]string
+		data         string
+		expectedName string
+		errContains  string
+		newClientFn  newClientFn
 	}{
 		{
-			desc:       "success",
-			bucketName: bucketName,
-			sessionID:  "111",
-			data:       "data-111",
+			desc:         "success",
+			bucketName:   bucketName,
+			sessionID:    "111",
+			data:         "data-111",
+			expectedName: "111",
+			newClientFn: func(_ core.Context) (*storage.Client, error) {
+				return server.Client(), nil
+			},
+		},
+		{
+			desc:         "object name template",
+			bucketName:   bucketName,
+			sessionID:    "222",
+			objectName:   "{hostname}/{session}.json",
+			objectPrefix: "vhs/",
+			labels:       map[string]string{"env": "test"},
+			data:         "data-222",
+			expectedName: "vhs/" + hostname + "/222.json",
 			newClientFn: func(_ core.Context) (*storage.Client, error) {
 				return server.Client(), nil
 			},
@@ -56,7 +80,10 @@ func TestNewSink(t *testing.T) {
 		t.Run(c.desc, func(t *testing.T) {
 			err := func() error {
 				ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
-					GCSBucketName: c.bucketName,
+					GCSBucketName:   c.bucketName,
+					GCSObjectName:   c.objectName,
+					GCSObjectPrefix: c.objectPrefix,
+					ObjectLabels:    c.labels,
 				}, nil)
 				ctx.SessionID = c.sessionID
 				defer ctx.Cancel()
@@ -76,7 +103,14 @@ func TestNewSink(t *testing.T) {
 					return err
 				}
 
-				o := server.Client().Bucket(c.bucketName).Object(c.sessionID)
+				o := server.Client().Bucket(c.bucketName).Object(c.expectedName)
+				attrs, err := o.Attrs(context.Background())
+				if err != nil {
+					return err
+				}
+
+				assert.DeepEqual(t, c.labels, attrs.Metadata)
+
 				r, err := o.NewReader(context.Background())
 				if err != nil {
 					return err
@@ -102,6 +136,79 @@ func TestNewSink(t *testing.T) {
 	}
 }
 
+func TestSinkCancel(t *testing.T) {
+	bucketName := "bucket-111"
+
+	server := fakestorage.NewServer([]fakestorage.Object{{BucketName: bucketName}})
+	defer server.Stop()
+
+	defer func(d time.Duration) { abortTimeout = d }(abortTimeout)
+	abortTimeout = 10 * time.Millisecond
+
+	cases := []struct {
+		desc        string
+		sessionID   string
+		wait        time.Duration
+		errContains string
+	}{
+		{
+			desc:      "closed after cancel",
+			sessionID: "111",
+		},
+		{
+			desc:        "not closed",
+			sessionID:   "222",
+			wait:        100 * time.Millisecond,
+			errContains: "upload aborted",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				GCSBucketName: bucketName,
+			}, nil)
+			ctx.SessionID = c.sessionID
+
+			s, err := newSink(ctx, func(_ core.Context) (*storage.Client, error) {
+				return server.Client(), nil
+			})
+			assert.NilError(t, err)
+
+			_, err = s.Write([]byte("111"))
+			assert.NilError(t, err)
+
+			// Writes made while the flow shuts down, after
+			// the session context is canceled, are uploaded
+			// if the sink is closed in time.
+			ctx.Cancel()
+
+			_, err = s.Write([]byte("222"))
+			assert.NilError(t, err)
+
+			time.Sleep(c.wait)
+
+			o := server.Client().Bucket(bucketName).Object(c.sessionID)
+
+			if c.errContains != "" {
+				assert.ErrorContains(t, s.Close(), c.errContains)
+				_, err = o.Attrs(context.Background())
+				assert.Assert(t, errors.Is(err, storage.ErrObjectNotExist))
+				return
+			}
+
+			assert.NilError(t, s.Close())
+
+			r, err := o.NewReader(context.Background())
+			assert.NilError(t, err)
+			defer r.Close()
+
+			b, err := ioutil.ReadAll(r)
+			assert.NilError(t, err)
+			assert.Equal(t, "111222", string(b))
+		})
+	}
+}
+
 func TestNewSource(t *testing.T) {
 	var (
 		bucketName = "bucket-111"
@@ -167,7 +274,8 @@ func TestNewSource(t *testing.T) {
 				GCSObjectName: c.objectName,
 			}, errs)
 
-			s := newSource(ctx, c.newClientFn)
+			s, err := newSource(ctx, c.newClientFn)
+			assert.NilError(t, err)
 
 			go s.Init(ctx)
 
@@ -189,6 +297,144 @@ func TestNewSource(t *testing.T) {
 	}
 }
 
+func TestSourceObjects(t *testing.T) {
+	var (
+		bucketName = "bucket-111"
+		t0         = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+	)
+
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: bucketName, Name: "vhs/2020-09-01/b.json", Content: []byte("b"), Updated: t0.Add(2 * time.Hour)},
+		{BucketName: bucketName, Name: "vhs/2020-09-01/a.json", Content: []byte("a"), Updated: t0.Add(time.Hour)},
+		{BucketName: bucketName, Name: "vhs/2020-09-01/c.har", Content: []byte("c"), Updated: t0.Add(3 * time.Hour)},
+		{BucketName: bucketName, Name: "vhs/2020-09-02/d.json", Content: []byte("d"), Updated: t0.Add(25 * time.Hour)},
+		{BucketName: bucketName, Name: "other/e.json", Content: []byte("e"), Updated: t0},
+	})
+	defer server.Stop()
+
+	cases := []struct {
+		desc         string
+		objectName   string
+		objectPrefix string
+		after        time.Time
+		before       time.Time
+		expected     []string
+		errContains  string
+	}{
+		{
+			desc:         "prefix",
+			objectPrefix: "vhs/",
+			expected:     []string{"vhs/2020-09-01/a.json", "vhs/2020-09-01/b.json", "vhs/2020-09-01/c.har", "vhs/2020-09-02/d.json"},
+		},
+		{
+			desc:         "pattern",
+			objectPrefix: "vhs/",
+			objectName:   "*/*.json",
+			expected:     []string{"vhs/2020-09-01/a.json", "vhs/2020-09-01/b.json", "vhs/2020-09-02/d.json"},
+		},
+		{
+			desc:         "time range",
+			objectPrefix: "vhs/",
+			after:        t0.Add(2 * time.Hour),
+			before:       t0.Add(24 * time.Hour),
+			expected:     []string{"vhs/2020-09-01/b.json", "vhs/2020-09-01/c.har"},
+		},
+		{
+			desc:         "no match",
+			objectPrefix: "none/",
+		},
+		{
+			desc:        "bad pattern",
+			objectName:  "[",
+			errContains: "failed to select objects",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			errs := make(chan error, 10)
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				GCSBucketName:        bucketName,
+				GCSObjectName:        c.objectName,
+				GCSObjectPrefix:      c.objectPrefix,
+				ObjectModifiedAfter:  c.after,
+				ObjectModifiedBefore: c.before,
+				ObjectDownloads:      2,
+			}, errs)
+
+			s, err := newSource(ctx, func(_ core.Context) (*storage.Client, error) {
+				return server.Client(), nil
+			})
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+
+			var names []string
+			for r := range s.Streams() {
+				name, _ := r.Meta().GetString(objects.MetaObjectName)
+				assert.Equal(t, name, r.Meta().SourceID)
+
+				data, err := ioutil.ReadAll(r)
+				assert.NilError(t, err)
+				assert.NilError(t, r.Close())
+				assert.Equal(t, path.Base(name)[:1], string(data))
+
+				names = append(names, name)
+			}
+
+			assert.DeepEqual(t, c.expected, names)
+			assert.Equal(t, 0, len(errs))
+		})
+	}
+}
+
+func TestSourceObjectsLimit(t *testing.T) {
+	bucketName := "bucket-111"
+
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: bucketName, Name: "a", Content: []byte("a")},
+		{BucketName: bucketName, Name: "b", Content: []byte("b")},
+	})
+	defer server.Stop()
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		GCSBucketName:   bucketName,
+		ObjectDownloads: 1,
+	}, make(chan error, 10))
+	defer ctx.Cancel()
+
+	s, err := newSource(ctx, func(_ core.Context) (*storage.Client, error) {
+		return server.Client(), nil
+	})
+	assert.NilError(t, err)
+
+	go s.Init(ctx)
+
+	r := <-s.Streams()
+	assert.Equal(t, "a", r.Meta().SourceID)
+
+	// The next object is not read until
+	// the first has been read to the end.
+	select {
+	case <-s.Streams():
+		t.Fatal("unexpected stream")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	_, err = ioutil.ReadAll(r)
+	assert.NilError(t, err)
+
+	r = <-s.Streams()
+	assert.Equal(t, "b", r.Meta().SourceID)
+	assert.NilError(t, r.Close())
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+}
+
 func TestNewSinkFail(t *testing.T) {
 	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
 	_, err := NewSink(ctx)
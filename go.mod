@@ -12,6 +12,10 @@ require (
 	github.com/rs/zerolog v1.19.0
 	github.com/segmentio/ksuid v1.0.3
 	github.com/spf13/cobra v1.0.0
+	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
+	golang.org/x/net v0.0.0-20200813134508-3edf25e44fcc
+	golang.org/x/sys v0.0.0-20200831180312-196b9ba8737a
+	google.golang.org/api v0.30.0
 	gotest.tools v2.2.0+incompatible
 	gotest.tools/v3 v3.0.2
 )
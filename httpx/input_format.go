@@ -56,43 +56,94 @@ func (i *inputFormat) Init(ctx core.Context, m core.Middleware, streams <-chan c
 				return
 			}
 
+			if events, ok := getConnectionEvents(r.Meta()); ok {
+				go func() {
+					for e := range events {
+						select {
+						case i.out <- e:
+						case <-ctx.StdContext.Done():
+							return
+						}
+					}
+				}()
+			}
+
 			var (
-				buf      = bufio.NewReader(r)
+				cr       = &countingReader{r: r}
+				buf      = bufio.NewReader(cr)
 				sourceID = r.Meta().SourceID
+				timeline = getTimeline(r.Meta())
+				gaps     = getGaps(r.Meta())
 			)
 
 			switch direction {
 			case tcp.DirectionUp:
 				go func() {
 					for {
-						eID := ksuid.New().String()
-						exchangeIDs <- eID
+						var (
+							created = messageCreated(buf, cr, timeline)
+							start   = readOffset(buf, cr)
+							eID     = ksuid.New().String()
+						)
 
 						req, err := NewRequest(buf, sourceID, eID, r.Meta())
 						if isEOF(err) {
 							return
 						}
+						if end := readOffset(buf, cr); spansGap(gaps, start, end) {
+							ctx.Logger.Debug().Int64("offset", start).Int64("end", end).Msg("dropped request spanning gap")
+							continue
+						}
 						if err != nil {
 							ctx.Errors <- fmt.Errorf("failed to parse request: %w", err)
 							continue
 						}
-						i.handle(ctx, m, TypeRequest, req)
+
+						// Only emitted requests are paired with responses.
+						select {
+						case exchangeIDs <- eID:
+						case <-ctx.StdContext.Done():
+							return
+						}
+
+						i.handle(ctx, m, TypeRequest, req, created)
 					}
 				}()
 			case tcp.DirectionDown:
 				go func() {
+					// eID is the exchange ID of the next emitted
+					// response. It is kept until a response is
+					// emitted, so dropped responses do not use it up.
+					var eID string
 					for {
-						eID := <-exchangeIDs
+						if eID == "" {
+							select {
+							case eID = <-exchangeIDs:
+							case <-ctx.StdContext.Done():
+								return
+							}
+						}
+
+						var (
+							created = messageCreated(buf, cr, timeline)
+							start   = readOffset(buf, cr)
+						)
 
 						res, err := NewResponse(buf, sourceID, eID, r.Meta())
 						if isEOF(err) {
 							return
 						}
+						if end := readOffset(buf, cr); spansGap(gaps, start, end) {
+							ctx.Logger.Debug().Int64("offset", start).Int64("end", end).Msg("dropped response spanning gap")
+							continue
+						}
 						if err != nil {
 							ctx.Errors <- fmt.Errorf("failed to parse response: %w", err)
 							continue
 						}
-						i.handle(ctx, m, TypeResponse, res)
+
+						eID = ""
+						i.handle(ctx, m, TypeResponse, res, created)
 					}
 				}()
 			default:
@@ -105,8 +156,8 @@ func (i *inputFormat) Init(ctx core.Context, m core.Middleware, streams <-chan c
 	}
 }
 
-func (i *inputFormat) handle(ctx core.Context, m core.Middleware, t MessageType, msg Message) {
-	msg.SetCreated(time.Now())
+func (i *inputFormat) handle(ctx core.Context, m core.Middleware, t MessageType, msg Message, created time.Time) {
+	msg.SetCreated(created)
 	msg.SetSessionID(ctx.SessionID)
 
 	// By default, msgOut is the original message.
@@ -133,6 +184,74 @@ func (i *inputFormat) handle(ctx core.Context, m core.Middleware, t MessageType,
 
 func (i *inputFormat) Out() <-chan interface{} { return i.out }
 
+func getTimeline(m *core.Meta) *tcp.Timeline {
+	v, ok := m.Get(tcp.MetaTimeline)
+	if !ok {
+		return nil
+	}
+	timeline, _ := v.(*tcp.Timeline)
+	return timeline
+}
+
+// messageCreated gets the time at which the first byte of the
+// next message in a stream was captured. It blocks until that
+// byte is available. If the stream has no timeline, the time
+// at which the byte was read is used instead.
+func messageCreated(buf *bufio.Reader, cr *countingReader, timeline *tcp.Timeline) time.Time {
+	if _, err := buf.Peek(1); err != nil || timeline == nil {
+		return time.Now()
+	}
+
+	if created, ok := timeline.At(readOffset(buf, cr)); ok {
+		return created
+	}
+
+	return time.Now()
+}
+
+// readOffset gets the offset in the stream of
+// the next byte to be read from the buffer.
+func readOffset(buf *bufio.Reader, cr *countingReader) int64 {
+	return cr.n - int64(buf.Buffered())
+}
+
+func getConnectionEvents(m *core.Meta) (<-chan *tcp.Connection, bool) {
+	v, ok := m.Get(tcp.MetaConnectionEvents)
+	if !ok {
+		return nil, false
+	}
+	events, ok := v.(<-chan *tcp.Connection)
+	return events, ok
+}
+
+func getGaps(m *core.Meta) *tcp.Gaps {
+	v, ok := m.Get(tcp.MetaGaps)
+	if !ok {
+		return nil
+	}
+	gaps, _ := v.(*tcp.Gaps)
+	return gaps
+}
+
+// spansGap reports whether bytes of a message between start and
+// end were lost during reassembly. Such messages are incomplete,
+// so they are dropped rather than emitted or reported as errors.
+func spansGap(gaps *tcp.Gaps, start, end int64) bool {
+	return gaps != nil && len(gaps.Between(start, end)) > 0
+}
+
+// countingReader counts the bytes read from a reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
 func isEOF(errs ...error) bool {
 	for _, err := range errs {
 		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
@@ -167,3 +167,144 @@ func TestInputFormatInit(t *testing.T) {
 		})
 	}
 }
+
+func TestMessageCreated(t *testing.T) {
+	var (
+		req1 = "GET /111.html HTTP/1.1\r\n\r\n"
+		req2 = "GET /222.html HTTP/1.1\r\n\r\n"
+		t1   = time.Unix(1000, 0)
+		t2   = time.Unix(2000, 0)
+	)
+
+	timeline := tcp.NewTimeline()
+	timeline.Add(10, t1)
+	timeline.Add(len(req1)-10, t1.Add(time.Millisecond))
+	timeline.Add(len(req2), t2)
+
+	var (
+		cr  = &countingReader{r: strings.NewReader(req1 + req2)}
+		buf = bufio.NewReader(cr)
+	)
+
+	assert.Equal(t, t1, messageCreated(buf, cr, timeline))
+	_, err := NewRequest(buf, "", "", nil)
+	assert.NilError(t, err)
+
+	assert.Equal(t, t2, messageCreated(buf, cr, timeline))
+	_, err = NewRequest(buf, "", "", nil)
+	assert.NilError(t, err)
+
+	created := messageCreated(buf, cr, timeline)
+	assert.Assert(t, time.Since(created) < time.Second)
+}
+
+func TestMessageCreatedNoTimeline(t *testing.T) {
+	var (
+		cr  = &countingReader{r: strings.NewReader("GET /111.html HTTP/1.1\r\n\r\n")}
+		buf = bufio.NewReader(cr)
+	)
+
+	created := messageCreated(buf, cr, nil)
+	assert.Assert(t, time.Since(created) < time.Second)
+}
+
+func TestSpansGap(t *testing.T) {
+	var (
+		req1 = "GET /111.html HTTP/1.1\r\n\r\n"
+		req2 = "GET /222.html HTTP/1.1\r\n\r\n"
+		gaps = tcp.NewGaps()
+	)
+
+	gaps.Add(int64(len(req1)+5), 10)
+
+	var (
+		cr  = &countingReader{r: strings.NewReader(req1 + req2)}
+		buf = bufio.NewReader(cr)
+	)
+
+	for _, spans := range []bool{false, true} {
+		buf.Peek(1)
+		start := readOffset(buf, cr)
+		_, err := NewRequest(buf, "", "", nil)
+		assert.NilError(t, err)
+		assert.Equal(t, spans, spansGap(gaps, start, readOffset(buf, cr)))
+	}
+
+	assert.Assert(t, !spansGap(nil, 0, 100))
+}
+
+func TestInputFormatGapExchangeIDs(t *testing.T) {
+	var (
+		errs = make(chan error, 10)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		req1 = "GET /111.html HTTP/1.1\r\n\r\n"
+		req2 = "GET /222.html HTTP/1.1\r\n\r\n"
+		res2 = "HTTP/1.1 204 No Content\r\n\r\n"
+		gaps = tcp.NewGaps()
+	)
+
+	// The first request spans a gap, so it is
+	// dropped and its response is never seen.
+	gaps.Add(5, 10)
+
+	inputFormat, err := NewInputFormat(ctx)
+	assert.NilError(t, err)
+
+	up := newTestInputReader(tcp.DirectionUp, req1+req2)
+	up.Meta().Set(tcp.MetaGaps, gaps)
+
+	streams := make(chan core.InputReader, 2)
+	streams <- up
+	streams <- newTestInputReader(tcp.DirectionDown, res2)
+
+	go inputFormat.Init(ctx, nil, streams)
+
+	var (
+		req *Request
+		res *Response
+	)
+	for i := 0; i < 2; i++ {
+		switch m := (<-inputFormat.Out()).(type) {
+		case *Request:
+			req = m
+		case *Response:
+			res = m
+		}
+	}
+
+	assert.Equal(t, "/222.html", req.RequestURI)
+	assert.Equal(t, req.ExchangeID, res.ExchangeID)
+
+	ctx.Cancel()
+}
+
+func TestInputFormatConnectionEvents(t *testing.T) {
+	var (
+		errs       = make(chan error, 10)
+		ctx        = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		events     = make(chan *tcp.Connection, 2)
+		openEvent  = &tcp.Connection{ConnectionID: "111", Event: tcp.ConnectionOpen}
+		closeEvent = &tcp.Connection{ConnectionID: "111", Event: tcp.ConnectionClose, CloseReason: tcp.CloseFIN}
+	)
+
+	inputFormat, err := NewInputFormat(ctx)
+	assert.NilError(t, err)
+
+	up := newTestInputReader(tcp.DirectionUp, "")
+	up.Meta().Set(tcp.MetaConnectionEvents, (<-chan *tcp.Connection)(events))
+
+	streams := make(chan core.InputReader, 1)
+	streams <- up
+
+	go inputFormat.Init(ctx, nil, streams)
+
+	events <- openEvent
+	events <- closeEvent
+	close(events)
+
+	out := inputFormat.Out()
+	assert.Equal(t, openEvent, <-out)
+	assert.Equal(t, closeEvent, <-out)
+
+	ctx.Cancel()
+}
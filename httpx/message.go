@@ -5,6 +5,7 @@ import (
 
 	"github.com/rename-this/vhs/core"
 	"github.com/rename-this/vhs/envelope"
+	"github.com/rename-this/vhs/tcp"
 )
 
 // MessageType is the type of an HTTP message.
@@ -28,4 +29,5 @@ type Message interface {
 func registerEnvelopes(ctx core.Context) {
 	ctx.Registry.Register(func() envelope.Kindify { return &Request{} })
 	ctx.Registry.Register(func() envelope.Kindify { return &Response{} })
+	tcp.RegisterEnvelopes(ctx)
 }
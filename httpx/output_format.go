@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
 )
 
 // NewOutputFormat creates an HTTP output format.
@@ -61,6 +62,8 @@ func (o *outputFormat) Init(ctx core.Context, w io.Writer) {
 				go o.writeRequest(ctx, wait, w, r)
 			case *Response:
 				// Ignore for now.
+			case *tcp.Connection:
+				// Connection events are not replayed.
 			default:
 				ctx.Errors <- errors.New("http output format: unknown type")
 			}
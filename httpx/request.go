@@ -46,6 +46,7 @@ type Request struct {
 	ClientPort       string         `json:"client_port,omitempty"`
 	ServerAddr       string         `json:"server_addr,omitempty"`
 	ServerPort       string         `json:"server_port,omitempty"`
+	Outbound         bool           `json:"outbound,omitempty"`
 }
 
 // Kind gets an envelope kind for a Request.
@@ -118,6 +119,7 @@ func NewRequest(b *bufio.Reader, connectionID string, exchangeID string, m *core
 		serverAddr string
 		serverPort string
 		remoteAddr string
+		outbound   bool
 	)
 
 	if m != nil {
@@ -133,6 +135,7 @@ func NewRequest(b *bufio.Reader, connectionID string, exchangeID string, m *core
 
 		serverAddr, _ = m.GetString(tcp.MetaDstAddr)
 		serverPort, _ = m.GetString(tcp.MetaDstPort)
+		outbound, _ = m.GetBool(tcp.MetaEgress)
 	}
 
 	return &Request{
@@ -158,5 +161,6 @@ func NewRequest(b *bufio.Reader, connectionID string, exchangeID string, m *core
 		ClientPort:       clientPort,
 		ServerAddr:       serverAddr,
 		ServerPort:       serverPort,
+		Outbound:         outbound,
 	}, nil
 }
@@ -68,6 +68,40 @@ func TestNewRequest(t *testing.T) {
 				ServerPort:    "80",
 			},
 		},
+		{
+			desc: "outbound",
+			cID:  "111",
+			eID:  "111",
+			b:    bufio.NewReader(strings.NewReader("GET /111.html HTTP/1.1\r\nheader:foo\r\n\r\n")),
+			meta: core.NewMeta("source", map[string]interface{}{
+				tcp.MetaSrcAddr: "10.10.10.1",
+				tcp.MetaSrcPort: "2346",
+				tcp.MetaDstAddr: "10.10.10.2",
+				tcp.MetaDstPort: "443",
+				tcp.MetaEgress:  true,
+			}),
+			r: &Request{
+				ConnectionID:  "111",
+				ExchangeID:    "111",
+				Method:        "GET",
+				URL:           newURL("/111.html"),
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{"Header": {"foo"}},
+				MimeType:      "text/plain; charset=utf-8",
+				Cookies:       []*http.Cookie{},
+				Body:          "",
+				ContentLength: 0,
+				RequestURI:    "/111.html",
+				RemoteAddr:    "10.10.10.1:2346",
+				ClientAddr:    "10.10.10.1",
+				ClientPort:    "2346",
+				ServerAddr:    "10.10.10.2",
+				ServerPort:    "443",
+				Outbound:      true,
+			},
+		},
 		{
 			desc: "cookie",
 			cID:  "111",
@@ -39,6 +39,7 @@ type Response struct {
 	ClientPort       string         `json:"client_port,omitempty"`
 	ServerAddr       string         `json:"server_addr,omitempty"`
 	ServerPort       string         `json:"server_port,omitempty"`
+	Outbound         bool           `json:"outbound,omitempty"`
 }
 
 // Kind gets an envelope kind for a Response.
@@ -81,6 +82,7 @@ func NewResponse(b *bufio.Reader, connectionID, exchangeID string, m *core.Meta)
 		clientPort string
 		serverAddr string
 		serverPort string
+		outbound   bool
 	)
 
 	if m != nil {
@@ -88,6 +90,7 @@ func NewResponse(b *bufio.Reader, connectionID, exchangeID string, m *core.Meta)
 		clientPort, _ = m.GetString(tcp.MetaDstPort)
 		serverAddr, _ = m.GetString(tcp.MetaSrcAddr)
 		serverPort, _ = m.GetString(tcp.MetaSrcPort)
+		outbound, _ = m.GetBool(tcp.MetaEgress)
 	}
 
 	return &Response{
@@ -111,5 +114,6 @@ func NewResponse(b *bufio.Reader, connectionID, exchangeID string, m *core.Meta)
 		ClientPort:       clientPort,
 		ServerAddr:       serverAddr,
 		ServerPort:       serverPort,
+		Outbound:         outbound,
 	}, nil
 }
@@ -64,6 +64,37 @@ func TestNewResponset(t *testing.T) {
 				ServerPort:    "80",
 			},
 		},
+		{
+			desc: "outbound",
+			cID:  "111",
+			eID:  "111",
+			b:    bufio.NewReader(strings.NewReader("HTTP/1.1 204 No Content\r\n\r\n")),
+			meta: core.NewMeta("source", map[string]interface{}{
+				tcp.MetaDstAddr: "10.10.10.1",
+				tcp.MetaDstPort: "2346",
+				tcp.MetaSrcAddr: "10.10.10.2",
+				tcp.MetaSrcPort: "443",
+				tcp.MetaEgress:  true,
+			}),
+			r: &Response{
+				ConnectionID:  "111",
+				ExchangeID:    "111",
+				Status:        "204 No Content",
+				StatusCode:    http.StatusNoContent,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{},
+				Cookies:       []*http.Cookie{},
+				Body:          "",
+				ContentLength: 0,
+				ClientAddr:    "10.10.10.1",
+				ClientPort:    "2346",
+				ServerAddr:    "10.10.10.2",
+				ServerPort:    "443",
+				Outbound:      true,
+			},
+		},
 		{
 			desc: "success with a cookie",
 			cID:  "111",
@@ -0,0 +1,102 @@
+package chanreader
+
+import (
+	"io"
+	"sync"
+)
+
+// Reader reads byte slices that are sent to it by another
+// goroutine, such as reassembled TCP data or UDP datagrams.
+// Each call to Read returns bytes from at most one slice.
+type Reader struct {
+	data      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// buf is only accessed by the consumer.
+	buf []byte
+}
+
+// New creates a new reader that buffers up to size
+// slices before Send waits for the consumer.
+func New(size int) *Reader {
+	return &Reader{
+		data: make(chan []byte, size),
+		done: make(chan struct{}),
+	}
+}
+
+// Send hands b to the consumer, blocking while the buffer is full
+// until the reader is closed. It reports whether b was handed over.
+// The reader takes ownership of b.
+func (r *Reader) Send(b []byte) bool {
+	select {
+	case r.data <- b:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// TrySend hands b to the consumer if there is room in the buffer
+// and the reader is open. It reports whether b was handed over,
+// and takes ownership of b only if it was.
+func (r *Reader) TrySend(b []byte) bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+	}
+	select {
+	case r.data <- b:
+		return true
+	default:
+		return false
+	}
+}
+
+// Closed reports whether the reader has been closed.
+func (r *Reader) Closed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Complete signals that nothing more will be sent. It
+// must not be called concurrently with Send.
+func (r *Reader) Complete() {
+	close(r.data)
+}
+
+// Read reads from the next slice. If p is too small to hold
+// the slice, the rest is returned by the following reads.
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		select {
+		case b, more := <-r.data:
+			if !more {
+				return 0, io.EOF
+			}
+			r.buf = b
+		case <-r.done:
+			return 0, io.EOF
+		}
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// Close closes the reader. Any data that has
+// not been read yet is discarded.
+func (r *Reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	return nil
+}
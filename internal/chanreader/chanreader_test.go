@@ -0,0 +1,96 @@
+package chanreader
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReader(t *testing.T) {
+	cases := []struct {
+		desc   string
+		slices []string
+		size   int
+		reads  []string
+	}{
+		{
+			desc:   "one slice per read",
+			slices: []string{"aaa", "bb", "c"},
+			size:   10,
+			reads:  []string{"aaa", "bb", "c"},
+		},
+		{
+			desc:   "short buffer",
+			slices: []string{"aaaaa", "bb"},
+			size:   2,
+			reads:  []string{"aa", "aa", "a", "bb"},
+		},
+		{
+			desc:   "empty slice",
+			slices: []string{"aaa", "", "bb"},
+			size:   10,
+			reads:  []string{"aaa", "bb"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			r := New(len(c.slices))
+			for _, s := range c.slices {
+				assert.Assert(t, r.Send([]byte(s)))
+			}
+			r.Complete()
+
+			var reads []string
+			for {
+				p := make([]byte, c.size)
+				n, err := r.Read(p)
+				if err == io.EOF {
+					break
+				}
+				assert.NilError(t, err)
+				reads = append(reads, string(p[:n]))
+			}
+
+			assert.DeepEqual(t, c.reads, reads)
+		})
+	}
+}
+
+func TestReaderClose(t *testing.T) {
+	r := New(1)
+	assert.Assert(t, r.Send([]byte("a")))
+	assert.Assert(t, !r.Closed())
+
+	assert.NilError(t, r.Close())
+	assert.NilError(t, r.Close())
+	assert.Assert(t, r.Closed())
+
+	// Sending to a closed reader does not block.
+	for i := 0; i < 2; i++ {
+		r.Send([]byte("b"))
+	}
+
+	b, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Assert(t, len(b) <= 1)
+}
+
+func TestReaderTrySend(t *testing.T) {
+	r := New(1)
+	assert.Assert(t, r.TrySend([]byte("a")))
+
+	// The buffer is full.
+	assert.Assert(t, !r.TrySend([]byte("b")))
+
+	p := make([]byte, 2)
+	n, err := r.Read(p)
+	assert.NilError(t, err)
+	assert.Equal(t, "a", string(p[:n]))
+
+	assert.Assert(t, r.TrySend([]byte("c")))
+
+	assert.NilError(t, r.Close())
+	assert.Assert(t, !r.TrySend([]byte("d")))
+}
@@ -0,0 +1,69 @@
+package nametmpl
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Placeholders that may appear in a template.
+const (
+	Session   = "{session}"
+	Timestamp = "{timestamp}"
+	Date      = "{date}"
+	Hostname  = "{hostname}"
+	Seq       = "{seq}"
+)
+
+// TimestampLayout is the layout of an expanded timestamp. It sorts
+// in time order and contains no characters that are unsafe in
+// file or object names.
+const TimestampLayout = "20060102T150405Z"
+
+// DateLayout is the layout of an expanded date.
+const DateLayout = "2006-01-02"
+
+// Values are the values of the placeholders of a template.
+type Values struct {
+	SessionID string
+	Time      time.Time
+	Hostname  string
+	Seq       int
+}
+
+// Expand replaces the placeholders in a template with their values.
+// Times are expanded in UTC and sequence numbers are zero-padded
+// so that names sort in order.
+func Expand(tmpl string, v Values) string {
+	t := v.Time.UTC()
+	return strings.NewReplacer(
+		Session, v.SessionID,
+		Timestamp, t.Format(TimestampLayout),
+		Date, t.Format(DateLayout),
+		Hostname, v.Hostname,
+		Seq, fmt.Sprintf("%06d", v.Seq),
+	).Replace(tmpl)
+}
+
+// Object expands the name of an object written by a sink. The prefix
+// is prepended to the template, which defaults to the session ID, and
+// both may contain placeholders.
+func Object(prefix, tmpl string, v Values) string {
+	if tmpl == "" {
+		tmpl = Session
+	}
+	return Expand(prefix+tmpl, v)
+}
+
+// objectSeq counts the objects named by sinks in this process.
+var objectSeq int64
+
+// NextObjectSeq returns the next object sequence number. Numbers
+// are shared by all object sinks in the process and start at 0
+// each time it runs. Each sink writes one object, so a number only
+// tells apart the sinks of one process: it is 0 for the only sink
+// of a flow and does not distinguish objects across runs or hosts.
+func NextObjectSeq() int {
+	return int(atomic.AddInt64(&objectSeq, 1) - 1)
+}
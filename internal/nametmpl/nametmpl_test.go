@@ -0,0 +1,90 @@
+package nametmpl
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExpand(t *testing.T) {
+	v := Values{
+		SessionID: "abc",
+		Time:      time.Date(2020, 9, 1, 0, 30, 5, 0, time.FixedZone("", 3600)),
+		Hostname:  "host",
+		Seq:       7,
+	}
+
+	cases := []struct {
+		desc     string
+		tmpl     string
+		expected string
+	}{
+		{
+			desc:     "no placeholders",
+			tmpl:     "out.json",
+			expected: "out.json",
+		},
+		{
+			desc:     "all placeholders",
+			tmpl:     "/tmp/{date}/{hostname}/{session}/{timestamp}-{seq}.json.gz",
+			expected: "/tmp/2020-08-31/host/abc/20200831T233005Z-000007.json.gz",
+		},
+		{
+			desc:     "repeated placeholders",
+			tmpl:     "{seq}-{seq}",
+			expected: "000007-000007",
+		},
+		{
+			desc:     "unknown placeholders",
+			tmpl:     "{host}-{seq}",
+			expected: "{host}-000007",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.expected, Expand(c.tmpl, v))
+		})
+	}
+}
+
+func TestObject(t *testing.T) {
+	v := Values{
+		SessionID: "abc",
+		Time:      time.Date(2020, 9, 1, 12, 30, 5, 0, time.UTC),
+		Hostname:  "host",
+	}
+
+	cases := []struct {
+		desc     string
+		prefix   string
+		tmpl     string
+		expected string
+	}{
+		{
+			desc:     "default",
+			expected: "abc",
+		},
+		{
+			desc:     "template",
+			tmpl:     "{hostname}/{session}-{seq}.json",
+			expected: "host/abc-000000.json",
+		},
+		{
+			desc:     "prefix",
+			prefix:   "vhs/{date}/",
+			expected: "vhs/2020-09-01/abc",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.expected, Object(c.prefix, c.tmpl, v))
+		})
+	}
+}
+
+func TestNextObjectSeq(t *testing.T) {
+	first := NextObjectSeq()
+	assert.Equal(t, first+1, NextObjectSeq())
+	assert.Equal(t, first+2, NextObjectSeq())
+}
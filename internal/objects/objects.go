@@ -0,0 +1,260 @@
+package objects
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+)
+
+// MetaObjectName is the meta key for the name
+// of the object that a stream is read from.
+const MetaObjectName = "object.name"
+
+// Selector selects the objects read by a source. It either names
+// a single object, or selects the objects under a prefix whose
+// names match a glob pattern and that were modified in a range.
+type Selector struct {
+	Prefix  string
+	Pattern string
+	After   time.Time
+	Before  time.Time
+}
+
+// NewSelector creates a new selector. The prefix is prepended to the
+// name, which may be a glob pattern as accepted by path.Match. An
+// empty name selects every object under the prefix. A zero after or
+// before time leaves that end of the range open.
+func NewSelector(prefix, name string, after, before time.Time) (Selector, error) {
+	var pattern string
+	if name != "" {
+		pattern = prefix + name
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return Selector{}, fmt.Errorf("invalid object name %s: %w", name, err)
+	}
+
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		return Selector{}, errors.New("object time range is empty")
+	}
+
+	return Selector{
+		Prefix:  prefix,
+		Pattern: pattern,
+		After:   after,
+		Before:  before,
+	}, nil
+}
+
+// Single returns the name of the object if the selector names a
+// single object, which can be read without listing the bucket.
+func (s Selector) Single() (string, bool) {
+	if s.Pattern == "" || isPattern(s.Pattern) || !s.After.IsZero() || !s.Before.IsZero() {
+		return "", false
+	}
+	return s.Pattern, true
+}
+
+// ListPrefix returns the prefix under which to list objects. It
+// extends the prefix with the literal start of the pattern.
+func (s Selector) ListPrefix() string {
+	if s.Pattern == "" {
+		return s.Prefix
+	}
+	if i := strings.IndexAny(s.Pattern, patternChars); i >= 0 {
+		return s.Pattern[:i]
+	}
+	return s.Pattern
+}
+
+// Match reports whether an object is selected. The modified
+// time is inclusive of After and exclusive of Before.
+func (s Selector) Match(name string, modified time.Time) bool {
+	if !strings.HasPrefix(name, s.Prefix) {
+		return false
+	}
+	if s.Pattern != "" {
+		if ok, _ := path.Match(s.Pattern, name); !ok {
+			return false
+		}
+	}
+	if !s.After.IsZero() && modified.Before(s.After) {
+		return false
+	}
+	if !s.Before.IsZero() && !modified.Before(s.Before) {
+		return false
+	}
+	return true
+}
+
+// patternChars are the characters that are special in a pattern.
+const patternChars = `*?[\`
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, patternChars)
+}
+
+// Limiter bounds the number of objects that are read at once.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter creates a limiter that allows n objects
+// to be read at once. It allows at least one.
+func NewLimiter(n int) *Limiter {
+	if n < 1 {
+		n = 1
+	}
+	return &Limiter{
+		slots: make(chan struct{}, n),
+	}
+}
+
+// Acquire waits for a slot to read an object.
+func (l *Limiter) Acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader wraps the reader of an object for which a slot was acquired.
+// The slot is released once the reader returns an error, such as
+// io.EOF, or is closed.
+func (l *Limiter) Reader(rc io.ReadCloser) io.ReadCloser {
+	return &limitedReader{
+		rc:      rc,
+		release: l.Release,
+	}
+}
+
+// Release releases a slot, such as one acquired
+// for an object that could not be opened.
+func (l *Limiter) Release() {
+	<-l.slots
+}
+
+type limitedReader struct {
+	rc      io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	if err != nil {
+		r.once.Do(r.release)
+	}
+	return n, err
+}
+
+func (r *limitedReader) Close() error {
+	r.once.Do(r.release)
+	return r.rc.Close()
+}
+
+// OpenFn opens an object for reading.
+type OpenFn func(ctx context.Context, name string) (io.ReadCloser, error)
+
+// Emitter emits the objects read by a source as streams,
+// limiting the number of objects that are read at once.
+type Emitter struct {
+	streams chan core.InputReader
+	limiter *Limiter
+}
+
+// NewEmitter creates an emitter that allows
+// n objects to be read at once.
+func NewEmitter(n int) *Emitter {
+	return &Emitter{
+		streams: make(chan core.InputReader),
+		limiter: NewLimiter(n),
+	}
+}
+
+// Streams gets the streams of the objects.
+func (e *Emitter) Streams() <-chan core.InputReader {
+	return e.streams
+}
+
+// Emit opens an object and emits its stream once the limiter allows
+// it to be read. An object that fails to open is reported to the
+// context's errors and skipped. Emit reports whether more objects
+// may be read, which is false once the context is done.
+func (e *Emitter) Emit(ctx core.Context, name string, open OpenFn) bool {
+	if err := e.limiter.Acquire(ctx.StdContext); err != nil {
+		return false
+	}
+
+	rc, err := open(ctx.StdContext, name)
+	if err != nil {
+		e.limiter.Release()
+		ctx.Errors <- err
+		return true
+	}
+
+	ctx.Logger.Debug().Str("name", name).Msg("object opened")
+
+	s := &stream{
+		ReadCloser: e.limiter.Reader(rc),
+		meta: core.NewMeta(name, map[string]interface{}{
+			MetaObjectName: name,
+		}),
+	}
+
+	select {
+	case e.streams <- s:
+		return true
+	case <-ctx.StdContext.Done():
+		s.Close()
+		return false
+	}
+}
+
+// Close closes the streams once no more objects will be emitted.
+func (e *Emitter) Close() {
+	close(e.streams)
+}
+
+type stream struct {
+	io.ReadCloser
+	meta *core.Meta
+}
+
+func (s *stream) Meta() *core.Meta {
+	return s.meta
+}
+
+// AbortTimeout is how long a sink may remain open after its
+// flow stops before the upload of its object is aborted.
+const AbortTimeout = time.Minute
+
+// AbortIfNotClosed calls abort if closed is not closed within the
+// timeout after the context is done. Sinks are closed after their
+// flow stops, so output written while it stops is still uploaded,
+// but an upload that will never be completed is not left behind.
+func AbortIfNotClosed(ctx core.Context, closed <-chan struct{}, timeout time.Duration, abort func()) {
+	select {
+	case <-closed:
+		return
+	case <-ctx.StdContext.Done():
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-closed:
+	case <-t.C:
+		abort()
+	}
+}
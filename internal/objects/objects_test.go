@@ -0,0 +1,297 @@
+package objects
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewSelector(t *testing.T) {
+	var (
+		t0 = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(time.Hour)
+	)
+
+	cases := []struct {
+		desc         string
+		prefix       string
+		name         string
+		after        time.Time
+		before       time.Time
+		single       string
+		listPrefix   string
+		errContains  string
+		expectSingle bool
+	}{
+		{
+			desc:         "single",
+			prefix:       "vhs/",
+			name:         "a.json",
+			single:       "vhs/a.json",
+			listPrefix:   "vhs/a.json",
+			expectSingle: true,
+		},
+		{
+			desc:       "prefix",
+			prefix:     "vhs/",
+			listPrefix: "vhs/",
+		},
+		{
+			desc:       "pattern",
+			prefix:     "vhs/",
+			name:       "2020-09-01/*.json",
+			listPrefix: "vhs/2020-09-01/",
+		},
+		{
+			desc:       "single in range",
+			name:       "a.json",
+			after:      t0,
+			listPrefix: "a.json",
+		},
+		{
+			desc:        "bad pattern",
+			name:        "[",
+			errContains: "invalid object name",
+		},
+		{
+			desc:        "empty range",
+			after:       t1,
+			before:      t0,
+			errContains: "object time range is empty",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			s, err := NewSelector(c.prefix, c.name, c.after, c.before)
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+
+			single, ok := s.Single()
+			assert.Equal(t, c.expectSingle, ok)
+			assert.Equal(t, c.single, single)
+			assert.Equal(t, c.listPrefix, s.ListPrefix())
+		})
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	var (
+		t0 = time.Date(2020, 9, 1, 0, 0, 0, 0, time.UTC)
+		t1 = t0.Add(time.Hour)
+		t2 = t1.Add(time.Hour)
+	)
+
+	s, err := NewSelector("vhs/", "*/*.json", t0, t2)
+	assert.NilError(t, err)
+
+	cases := []struct {
+		desc     string
+		name     string
+		modified time.Time
+		expected bool
+	}{
+		{
+			desc:     "match",
+			name:     "vhs/host/a.json",
+			modified: t1,
+			expected: true,
+		},
+		{
+			desc:     "start of range",
+			name:     "vhs/host/a.json",
+			modified: t0,
+			expected: true,
+		},
+		{
+			desc:     "end of range",
+			name:     "vhs/host/a.json",
+			modified: t2,
+		},
+		{
+			desc:     "outside prefix",
+			name:     "other/host/a.json",
+			modified: t1,
+		},
+		{
+			desc:     "pattern mismatch",
+			name:     "vhs/host/a.har",
+			modified: t1,
+		},
+		{
+			desc:     "too deep",
+			name:     "vhs/host/2020/a.json",
+			modified: t1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.Equal(t, c.expected, s.Match(c.name, c.modified))
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	var (
+		ctx = context.Background()
+		l   = NewLimiter(2)
+	)
+
+	assert.NilError(t, l.Acquire(ctx))
+	r1 := l.Reader(ioutil.NopCloser(strings.NewReader("111")))
+
+	assert.NilError(t, l.Acquire(ctx))
+	r2 := l.Reader(ioutil.NopCloser(strings.NewReader("222")))
+
+	// Both slots are taken.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorContains(t, l.Acquire(canceled), "canceled")
+
+	// Reading to the end releases a slot.
+	b, err := ioutil.ReadAll(r1)
+	assert.NilError(t, err)
+	assert.Equal(t, "111", string(b))
+	assert.NilError(t, l.Acquire(ctx))
+
+	// Closing releases a slot, but only once.
+	assert.NilError(t, r2.Close())
+	assert.NilError(t, r2.Close())
+	assert.NilError(t, l.Acquire(ctx))
+	assert.Equal(t, 2, len(l.slots))
+}
+
+type testObject struct {
+	io.Reader
+	closed bool
+}
+
+func (o *testObject) Close() error {
+	o.closed = true
+	return nil
+}
+
+func TestEmitter(t *testing.T) {
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		e    = NewEmitter(1)
+		objs = map[string]*testObject{
+			"a": {Reader: strings.NewReader("aaa")},
+			"c": {Reader: strings.NewReader("ccc")},
+		}
+		open = func(_ context.Context, name string) (io.ReadCloser, error) {
+			o, ok := objs[name]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return o, nil
+		}
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+		defer e.Close()
+		assert.Check(t, e.Emit(ctx, "a", open))
+		assert.Check(t, e.Emit(ctx, "b", open))
+		assert.Check(t, !e.Emit(ctx, "c", open))
+	}()
+
+	r := <-e.Streams()
+	name, _ := r.Meta().GetString(MetaObjectName)
+	assert.Equal(t, "a", name)
+	assert.Equal(t, "a", r.Meta().SourceID)
+
+	b, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Equal(t, "aaa", string(b))
+
+	// An object that fails to open is skipped.
+	assert.ErrorContains(t, <-errs, "not found")
+
+	// A stream that is not emitted before
+	// the context is done is closed.
+	time.Sleep(50 * time.Millisecond)
+	ctx.Cancel()
+	<-done
+
+	assert.Assert(t, objs["c"].closed)
+
+	_, more := <-e.Streams()
+	assert.Assert(t, !more)
+}
+
+func TestAbortIfNotClosed(t *testing.T) {
+	cases := []struct {
+		desc    string
+		cancel  bool
+		close   bool
+		aborted bool
+	}{
+		{
+			desc:  "closed",
+			close: true,
+		},
+		{
+			desc:   "closed after cancel",
+			cancel: true,
+			close:  true,
+		},
+		{
+			desc:    "not closed after cancel",
+			cancel:  true,
+			aborted: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				ctx     = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+				closed  = make(chan struct{})
+				aborted = make(chan struct{})
+				done    = make(chan struct{})
+			)
+			defer ctx.Cancel()
+
+			go func() {
+				defer close(done)
+				AbortIfNotClosed(ctx, closed, 50*time.Millisecond, func() {
+					close(aborted)
+				})
+			}()
+
+			if c.cancel {
+				ctx.Cancel()
+			}
+			if c.close {
+				close(closed)
+			}
+
+			select {
+			case <-aborted:
+			case <-time.After(100 * time.Millisecond):
+			}
+
+			if c.close {
+				<-done
+			}
+
+			select {
+			case <-aborted:
+				assert.Assert(t, c.aborted)
+			default:
+				assert.Assert(t, !c.aborted)
+			}
+		})
+	}
+}
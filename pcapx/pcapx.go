@@ -0,0 +1,227 @@
+package pcapx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/envelope"
+)
+
+// Packet is a raw captured packet.
+type Packet struct {
+	CaptureInfo gopacket.CaptureInfo `json:"capture_info"`
+	LinkType    layers.LinkType      `json:"link_type"`
+	Data        []byte               `json:"data"`
+}
+
+// Kind gets an envelope kind for a Packet.
+func (p *Packet) Kind() envelope.Kind { return "pcapx.packet" }
+
+func registerEnvelopes(ctx core.Context) {
+	ctx.Registry.Register(func() envelope.Kindify { return &Packet{} })
+}
+
+// newWriter creates a pcapng writer. The section header is not
+// written until the first packet arrives since every pcapng
+// section must describe at least one interface.
+func newWriter(w io.Writer) *writer {
+	return &writer{
+		w:          w,
+		interfaces: make(map[layers.LinkType]int),
+	}
+}
+
+// writer writes packets of any link type to a pcapng stream.
+// An interface is added to the section for each link type.
+type writer struct {
+	w          io.Writer
+	ng         *pcapgo.NgWriter
+	interfaces map[layers.LinkType]int
+}
+
+func (w *writer) WritePacket(ci gopacket.CaptureInfo, linkType layers.LinkType, data []byte) error {
+	id, ok := w.interfaces[linkType]
+	if !ok {
+		var err error
+		if id, err = w.addInterface(linkType); err != nil {
+			return err
+		}
+	}
+
+	ci.InterfaceIndex = id
+	ci.CaptureLength = len(data)
+	if ci.Length < ci.CaptureLength {
+		ci.Length = ci.CaptureLength
+	}
+
+	if err := w.ng.WritePacket(ci, data); err != nil {
+		return fmt.Errorf("failed to write packet: %w", err)
+	}
+
+	return nil
+}
+
+func (w *writer) addInterface(linkType layers.LinkType) (int, error) {
+	intf := pcapgo.DefaultNgInterface
+	intf.Name = linkType.String()
+	intf.LinkType = linkType
+
+	if w.ng == nil {
+		ng, err := pcapgo.NewNgWriterInterface(w.w, intf, pcapgo.NgWriterOptions{
+			SectionInfo: pcapgo.NgSectionInfo{
+				Application: "vhs",
+			},
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to create pcapng writer: %w", err)
+		}
+		w.ng = ng
+		w.interfaces[linkType] = 0
+		return 0, nil
+	}
+
+	id, err := w.ng.AddInterface(intf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add interface: %w", err)
+	}
+	w.interfaces[linkType] = id
+
+	return id, nil
+}
+
+func (w *writer) Flush() error {
+	if w.ng == nil {
+		return nil
+	}
+	return w.ng.Flush()
+}
+
+// NewInputFormat creates a new pcapng input format. Both
+// pcapng and pcap streams are accepted.
+func NewInputFormat(ctx core.Context) (core.InputFormat, error) {
+	registerEnvelopes(ctx)
+	return &inputFormat{
+		out: make(chan interface{}),
+	}, nil
+}
+
+type inputFormat struct {
+	out chan interface{}
+}
+
+func (i *inputFormat) Out() <-chan interface{} {
+	return i.out
+}
+
+func (i *inputFormat) Init(ctx core.Context, _ core.Middleware, streams <-chan core.InputReader) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "pcapng_input_format").
+		Logger()
+
+	ctx.Logger.Debug().Msg("init")
+
+	for rdr := range streams {
+		go func(r core.InputReader) {
+			defer func() {
+				if err := r.Close(); err != nil {
+					ctx.Errors <- fmt.Errorf("failed to close pcapng input format: %w", err)
+				}
+			}()
+
+			fr, err := capture.NewFileReader(r)
+			if err != nil {
+				ctx.Errors <- fmt.Errorf("failed to create packet reader: %w", err)
+				return
+			}
+
+			for {
+				data, ci, err := fr.ReadPacketData()
+				if errors.Is(err, io.EOF) {
+					return
+				}
+				if err != nil {
+					ctx.Errors <- fmt.Errorf("failed to read packet: %w", err)
+					return
+				}
+
+				p := &Packet{
+					CaptureInfo: ci,
+					LinkType:    fr.LinkType(ci.InterfaceIndex),
+					Data:        data,
+				}
+
+				select {
+				case i.out <- p:
+				case <-ctx.StdContext.Done():
+					ctx.Logger.Debug().Msg("context canceled")
+					return
+				}
+			}
+		}(rdr)
+	}
+}
+
+// NewOutputFormat creates a new pcapng output format.
+func NewOutputFormat(ctx core.Context) (core.OutputFormat, error) {
+	registerEnvelopes(ctx)
+	return &outputFormat{
+		in:       make(chan interface{}),
+		complete: make(chan struct{}, 1),
+	}, nil
+}
+
+type outputFormat struct {
+	in       chan interface{}
+	complete chan struct{}
+}
+
+func (f *outputFormat) In() chan<- interface{} {
+	return f.in
+}
+
+func (f *outputFormat) Complete() <-chan struct{} {
+	return f.complete
+}
+
+func (f *outputFormat) Init(ctx core.Context, w io.Writer) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "output_pcapng").
+		Logger()
+
+	ctx.Logger.Debug().Msg("init")
+
+	defer func() {
+		f.complete <- struct{}{}
+	}()
+
+	pw := newWriter(w)
+
+	defer func() {
+		if err := pw.Flush(); err != nil {
+			ctx.Errors <- fmt.Errorf("failed to flush pcapng output: %w", err)
+		}
+	}()
+
+	for {
+		select {
+		case n := <-f.in:
+			p, ok := n.(*Packet)
+			if !ok {
+				ctx.Errors <- errors.New("pcapng output format: unknown type")
+				continue
+			}
+			if err := pw.WritePacket(p.CaptureInfo, p.LinkType, p.Data); err != nil {
+				ctx.Errors <- err
+			}
+		case <-ctx.StdContext.Done():
+			ctx.Logger.Debug().Msg("context canceled")
+			return
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package pcapx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/coretest"
+	"gotest.tools/v3/assert"
+)
+
+const testFile = "../testdata/200722_tcp_anon.pcapng"
+
+func readPackets(t *testing.T, r io.Reader) []*Packet {
+	fr, err := capture.NewFileReader(r)
+	assert.NilError(t, err)
+
+	var packets []*Packet
+	for {
+		data, ci, err := fr.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return packets
+		}
+		assert.NilError(t, err)
+		packets = append(packets, &Packet{
+			CaptureInfo: ci,
+			LinkType:    fr.LinkType(ci.InterfaceIndex),
+			Data:        data,
+		})
+	}
+}
+
+func TestInputFormat(t *testing.T) {
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+	)
+
+	f, err := os.Open(testFile)
+	assert.NilError(t, err)
+
+	ifmt, err := NewInputFormat(ctx)
+	assert.NilError(t, err)
+
+	streams := make(chan core.InputReader, 1)
+	streams <- core.EmptyMeta(f)
+	close(streams)
+
+	go ifmt.Init(ctx, nil, streams)
+
+	for i := 0; i < 35; i++ {
+		p, ok := (<-ifmt.Out()).(*Packet)
+		assert.Assert(t, ok)
+		assert.Equal(t, p.LinkType, layers.LinkTypeEthernet)
+		assert.Equal(t, p.CaptureInfo.CaptureLength, len(p.Data))
+	}
+
+	ctx.Cancel()
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestOutputFormat(t *testing.T) {
+	f, err := os.Open(testFile)
+	assert.NilError(t, err)
+	defer f.Close()
+
+	in := readPackets(t, f)
+	assert.Equal(t, 35, len(in))
+
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		sink = &coretest.TestSink{}
+	)
+
+	ofmt, err := NewOutputFormat(ctx)
+	assert.NilError(t, err)
+
+	go ofmt.Init(ctx, sink)
+
+	for _, p := range in {
+		ofmt.In() <- p
+	}
+	ofmt.In() <- &Packet{
+		CaptureInfo: in[0].CaptureInfo,
+		LinkType:    layers.LinkTypeRaw,
+		Data:        []byte{0x45},
+	}
+
+	ctx.Cancel()
+	<-ofmt.Complete()
+
+	assert.Equal(t, 0, len(errs))
+
+	out := readPackets(t, bytes.NewReader(sink.Data()))
+	assert.Equal(t, len(in)+1, len(out))
+
+	for i, p := range in {
+		assert.DeepEqual(t, p.Data, out[i].Data)
+		assert.Equal(t, p.LinkType, out[i].LinkType)
+		assert.Assert(t, p.CaptureInfo.Timestamp.Equal(out[i].CaptureInfo.Timestamp))
+	}
+
+	assert.Equal(t, out[len(in)].LinkType, layers.LinkTypeRaw)
+}
+
+func TestSource(t *testing.T) {
+	var (
+		errs    = make(chan error, 1)
+		flowCfg = &core.FlowConfig{SourceDuration: time.Minute}
+		ctx     = core.NewContext(&core.Config{}, flowCfg, errs)
+	)
+
+	s := &source{
+		streams: make(chan core.InputReader),
+		newListener: func(core.Context) (capture.Listener, error) {
+			return capture.NewOfflineListener(testFile), nil
+		},
+	}
+
+	go s.Init(ctx)
+
+	r := <-s.Streams()
+	defer r.Close()
+
+	assert.Equal(t, r.Meta().SourceID, ctx.SessionID)
+
+	packets := readPackets(t, r)
+	assert.Equal(t, 35, len(packets))
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestSourceCancel(t *testing.T) {
+	var (
+		errs    = make(chan error, 1)
+		flowCfg = &core.FlowConfig{SourceDuration: time.Minute}
+		ctx     = core.NewContext(&core.Config{}, flowCfg, errs)
+	)
+
+	s := &source{
+		streams: make(chan core.InputReader),
+		newListener: func(core.Context) (capture.Listener, error) {
+			return capture.NewOfflineListener(testFile), nil
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.Init(ctx)
+		close(done)
+	}()
+
+	// Init returns without the stream being read.
+	ctx.Cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("init did not return")
+	}
+
+	assert.Equal(t, 0, len(errs))
+}
@@ -0,0 +1,119 @@
+package pcapx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+)
+
+// NewSource creates a new source that records raw packets
+// from a live capture without reassembling them. All packets
+// are emitted as a single pcapng stream.
+func NewSource(ctx core.Context) (core.Source, error) {
+	if err := capture.ValidateFlowConfig(ctx.FlowConfig); err != nil {
+		return nil, err
+	}
+
+	return &source{
+		streams:     make(chan core.InputReader),
+		newListener: capture.NewLiveListener,
+	}, nil
+}
+
+type source struct {
+	streams     chan core.InputReader
+	newListener func(core.Context) (capture.Listener, error)
+}
+
+func (s *source) Streams() <-chan core.InputReader {
+	return s.streams
+}
+
+func (s *source) Init(ctx core.Context) {
+	defer close(s.streams)
+
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "packet_source").
+		Logger()
+
+	listener, err := s.newListener(ctx)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to initialize capture: %w", err)
+		return
+	}
+
+	defer listener.Close()
+
+	go listener.Listen(ctx)
+
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	strm := &stream{
+		ReadCloser: pr,
+		meta:       core.NewMeta(ctx.SessionID, nil),
+	}
+
+	select {
+	case s.streams <- strm:
+	case <-ctx.StdContext.Done():
+		strm.Close()
+		return
+	}
+
+	ctx.Logger.Debug().Msg("stream emitted")
+
+	var (
+		w        = newWriter(pw)
+		complete = ctx.FlowConfig.SourceDurationElapsed()
+		packets  = listener.Packets()
+	)
+
+	defer func() {
+		// The pipe is closed if the reader went away first,
+		// in which case there is no one left to flush to.
+		if err := w.Flush(); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			ctx.Errors <- fmt.Errorf("failed to flush packets: %w", err)
+		}
+	}()
+
+	for {
+		select {
+		case p, more := <-packets:
+			if !more {
+				ctx.Logger.Debug().Msg("no more packets")
+				return
+			}
+			if p == nil {
+				continue
+			}
+			linkType, ok := capture.LinkType(p)
+			if !ok {
+				ctx.Logger.Debug().Msg("packet without link type")
+				continue
+			}
+			if err := w.WritePacket(p.Metadata().CaptureInfo, linkType, p.Data()); err != nil {
+				if !errors.Is(err, io.ErrClosedPipe) {
+					ctx.Errors <- err
+				}
+				return
+			}
+		case <-complete:
+			return
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+}
+
+type stream struct {
+	io.ReadCloser
+	meta *core.Meta
+}
+
+func (s *stream) Meta() *core.Meta {
+	return s.meta
+}
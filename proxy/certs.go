@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// leafValidity is how long generated leaf certificates are valid.
+	leafValidity = 24 * time.Hour
+	// leafBackdate is how far before their creation generated leaf
+	// certificates become valid, to allow for clock skew.
+	leafBackdate = time.Hour
+	// leafRenewBefore is how long before it expires a cached leaf
+	// certificate is replaced.
+	leafRenewBefore = time.Hour
+)
+
+// certAuthority signs leaf certificates for intercepted hosts.
+// Leaf certificates are cached by host and share a single key.
+type certAuthority struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+
+	leafKey *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// loadCertAuthority loads a CA certificate and key from PEM files.
+func loadCertAuthority(certFile, keyFile string) (*certAuthority, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CA key pair: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported CA private key")
+	}
+
+	return newCertAuthority(cert, key)
+}
+
+func newCertAuthority(cert *x509.Certificate, key crypto.Signer) (*certAuthority, error) {
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+
+	return &certAuthority{
+		cert:    cert,
+		key:     key,
+		leafKey: leafKey,
+		leaves:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// leaf gets a leaf certificate for a host, creating
+// it if there is no valid certificate in the cache.
+func (ca *certAuthority) leaf(host string, now time.Time) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if c, ok := ca.leaves[host]; ok && now.Add(leafRenewBefore).Before(c.Leaf.NotAfter) {
+		return c, nil
+	}
+
+	c, err := ca.sign(host, now)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.leaves[host] = c
+
+	return c, nil
+}
+
+// sign creates a leaf certificate for a host. The certificate
+// never outlives the CA certificate.
+func (ca *certAuthority) sign(host string, now time.Time) (*tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	notAfter := now.Add(leafValidity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName: host,
+		},
+		NotBefore:             now.Add(-leafBackdate),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &ca.leafKey.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate for %s: %w", host, err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate for %s: %w", host, err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, ca.cert.Raw},
+		PrivateKey:  ca.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
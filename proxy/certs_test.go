@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// newTestCA creates a CA certificate and key, writing them as
+// PEM files to a temporary directory.
+func newTestCA(t *testing.T, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vhs test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(48 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NilError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NilError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NilError(t, err)
+
+	dir, err := ioutil.TempDir("", "vhs-proxy-ca")
+	assert.NilError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	var (
+		certFile = filepath.Join(dir, "ca.pem")
+		keyFile  = filepath.Join(dir, "ca-key.pem")
+	)
+
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	assert.NilError(t, err)
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	assert.NilError(t, err)
+
+	return cert, key, certFile, keyFile
+}
+
+func TestLoadCertAuthority(t *testing.T) {
+	_, _, certFile, keyFile := newTestCA(t, true)
+	_, _, leafCertFile, leafKeyFile := newTestCA(t, false)
+
+	cases := []struct {
+		desc        string
+		certFile    string
+		keyFile     string
+		errContains string
+	}{
+		{
+			desc:     "success",
+			certFile: certFile,
+			keyFile:  keyFile,
+		},
+		{
+			desc:        "missing files",
+			certFile:    "/does/not/exist",
+			keyFile:     keyFile,
+			errContains: "failed to load CA key pair",
+		},
+		{
+			desc:        "mismatched key",
+			certFile:    certFile,
+			keyFile:     leafKeyFile,
+			errContains: "failed to load CA key pair",
+		},
+		{
+			desc:        "not a CA",
+			certFile:    leafCertFile,
+			keyFile:     leafKeyFile,
+			errContains: "certificate is not a CA",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			_, err := loadCertAuthority(c.certFile, c.keyFile)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func TestCertAuthorityLeaf(t *testing.T) {
+	caCert, caKey, _, _ := newTestCA(t, true)
+
+	ca, err := newCertAuthority(caCert, caKey)
+	assert.NilError(t, err)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	now := time.Now()
+
+	for _, host := range []string{"example.com", "127.0.0.1"} {
+		c, err := ca.leaf(host, now)
+		assert.NilError(t, err)
+
+		_, err = c.Leaf.Verify(x509.VerifyOptions{
+			DNSName: host,
+			Roots:   roots,
+		})
+		assert.NilError(t, err)
+
+		cached, err := ca.leaf(host, now)
+		assert.NilError(t, err)
+		assert.Equal(t, c, cached)
+	}
+
+	c, err := ca.leaf("example.com", now)
+	assert.NilError(t, err)
+
+	// Certificates close to expiry are replaced.
+	renewed, err := ca.leaf("example.com", c.Leaf.NotAfter.Add(-leafRenewBefore/2))
+	assert.NilError(t, err)
+	assert.Assert(t, renewed != c)
+
+	// Certificates never outlive the CA.
+	assert.Assert(t, !renewed.Leaf.NotAfter.After(caCert.NotAfter))
+
+	assert.Assert(t, net.ParseIP("127.0.0.1").Equal(ca.leaves["127.0.0.1"].Leaf.IPAddresses[0]))
+}
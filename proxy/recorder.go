@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/chanreader"
+	"github.com/rename-this/vhs/tcp"
+)
+
+// recorderBufferSize is the number of writes that can be buffered
+// for a recorder before forwarding waits for the consumer.
+const recorderBufferSize = 64
+
+func newRecorder(meta *core.Meta, timeline *tcp.Timeline) *recorder {
+	return &recorder{
+		meta:     meta,
+		timeline: timeline,
+		data:     chanreader.New(recorderBufferSize),
+	}
+}
+
+// recorder is one direction of a proxied connection. The bytes
+// forwarded in that direction are written to it and read by
+// the flow.
+type recorder struct {
+	meta     *core.Meta
+	timeline *tcp.Timeline
+
+	data *chanreader.Reader
+
+	// read is only accessed by the consumer.
+	read int64
+}
+
+// Write hands forwarded bytes to the consumer, blocking while the
+// buffer is full. Once the recorder is closed, bytes are discarded
+// so that forwarding is not interrupted.
+func (r *recorder) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.data.Closed() {
+		return len(p), nil
+	}
+
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	// The timeline must be updated before the bytes are handed
+	// to the consumer since they may be read immediately.
+	r.timeline.Add(len(b), time.Now())
+
+	r.data.Send(b)
+
+	return len(p), nil
+}
+
+// complete signals that there is no more data. It must
+// not be called concurrently with Write.
+func (r *recorder) complete() {
+	r.data.Complete()
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+
+	r.read += int64(n)
+	r.timeline.Consume(r.read)
+
+	return n, err
+}
+
+// Close closes the recorder. Any data that has
+// not been read yet is discarded.
+func (r *recorder) Close() error {
+	return r.data.Close()
+}
+
+func (r *recorder) Meta() *core.Meta {
+	return r.meta
+}
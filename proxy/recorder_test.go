@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"gotest.tools/v3/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	var (
+		timeline = tcp.NewTimeline()
+		r        = newRecorder(core.NewMeta("", nil), timeline)
+	)
+
+	for _, s := range []string{"111", "", "22"} {
+		n, err := r.Write([]byte(s))
+		assert.NilError(t, err)
+		assert.Equal(t, len(s), n)
+	}
+	r.complete()
+
+	b, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Equal(t, "11122", string(b))
+
+	for _, offset := range []int64{0, 3, 4} {
+		_, ok := timeline.At(offset)
+		assert.Assert(t, ok)
+	}
+}
+
+func TestRecorderClose(t *testing.T) {
+	r := newRecorder(core.NewMeta("", nil), tcp.NewTimeline())
+	assert.NilError(t, r.Close())
+
+	// Writes never block once the recorder is closed.
+	for i := 0; i < recorderBufferSize*2; i++ {
+		n, err := r.Write([]byte("1"))
+		assert.NilError(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	n, err := r.Read(make([]byte, 1))
+	assert.Equal(t, 0, n)
+	assert.ErrorContains(t, err, "EOF")
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"github.com/segmentio/ksuid"
+)
+
+// NewSource creates a new proxy source.
+func NewSource(ctx core.Context) (core.Source, error) {
+	if _, _, err := net.SplitHostPort(ctx.FlowConfig.Addr); err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	if ctx.FlowConfig.ProxyUpstream == "" {
+		return nil, errors.New("proxy upstream is required")
+	}
+	if _, _, err := net.SplitHostPort(ctx.FlowConfig.ProxyUpstream); err != nil {
+		return nil, fmt.Errorf("invalid proxy upstream: %w", err)
+	}
+
+	s := &proxySource{
+		streams: make(chan core.InputReader),
+		listen:  net.Listen,
+	}
+	s.connect = s.dialUpstream
+
+	return s, nil
+}
+
+type listenFn func(network, address string) (net.Listener, error)
+
+// connectFn connects a client to its upstream. It returns the
+// connections to forward between, which may wrap the client
+// connection, and any metadata to add to the recorded streams.
+type connectFn func(ctx core.Context, client net.Conn) (net.Conn, net.Conn, map[string]interface{}, error)
+
+// proxySource accepts connections on the flow address and forwards
+// them to the proxy upstream. Both directions of each connection
+// are recorded and emitted as streams with the same metadata as
+// the streams of the tcp source, so that traffic can be recorded
+// without packet capture.
+type proxySource struct {
+	streams chan core.InputReader
+	listen  listenFn
+	connect connectFn
+}
+
+func (s *proxySource) Streams() <-chan core.InputReader {
+	return s.streams
+}
+
+func (s *proxySource) Init(ctx core.Context) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "proxy_source").
+		Logger()
+
+	ctx.Logger.Debug().Msg("init")
+
+	l, err := s.listen("tcp", ctx.FlowConfig.Addr)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to listen: %w", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	tcp.Serve(ctx, l, func(client net.Conn, stop <-chan struct{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.proxy(ctx, client, l.Addr(), stop)
+		}()
+	})
+
+	wg.Wait()
+	close(s.streams)
+
+	ctx.Logger.Debug().Msg("proxy source complete")
+}
+
+// proxy forwards a client connection to the upstream, recording
+// both directions. The connections are closed when the source
+// stops.
+func (s *proxySource) proxy(ctx core.Context, conn net.Conn, listenAddr net.Addr, stop <-chan struct{}) {
+	defer conn.Close()
+
+	client, upstream, values, err := s.connect(ctx, conn)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to proxy connection: %w", err)
+		return
+	}
+
+	defer client.Close()
+	defer upstream.Close()
+
+	var (
+		id    = ksuid.New().String()
+		up    = newConnRecorder(id, tcp.DirectionUp, client.RemoteAddr(), upstream.RemoteAddr(), listenAddr, values)
+		down  = newConnRecorder(id, tcp.DirectionDown, upstream.RemoteAddr(), client.RemoteAddr(), listenAddr, values)
+		done  = make(chan struct{})
+		pipes sync.WaitGroup
+	)
+
+	ctx.Logger = ctx.Logger.With().
+		Str("client", client.RemoteAddr().String()).
+		Str("upstream", upstream.RemoteAddr().String()).
+		Str("source_id", id).
+		Logger()
+
+	ctx.Logger.Debug().Msg("proxying connection")
+
+	for _, r := range []*recorder{up, down} {
+		select {
+		case s.streams <- r:
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+
+	go func() {
+		select {
+		case <-stop:
+			client.Close()
+			upstream.Close()
+		case <-done:
+		}
+	}()
+
+	pipes.Add(2)
+	go func() {
+		defer pipes.Done()
+		pipe(ctx, upstream, client, up)
+	}()
+	go func() {
+		defer pipes.Done()
+		pipe(ctx, client, upstream, down)
+	}()
+
+	pipes.Wait()
+	close(done)
+
+	ctx.Logger.Debug().Msg("connection closed")
+}
+
+// dialUpstream connects a client to the proxy upstream.
+func (s *proxySource) dialUpstream(ctx core.Context, client net.Conn) (net.Conn, net.Conn, map[string]interface{}, error) {
+	var d net.Dialer
+	upstream, err := d.DialContext(ctx.StdContext, "tcp", ctx.FlowConfig.ProxyUpstream)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to dial proxy upstream: %w", err)
+	}
+	return client, upstream, nil, nil
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe forwards src to dst, recording the forwarded bytes. When src
+// is closed, dst is half-closed so that the other direction can
+// finish. If forwarding fails, both connections are closed.
+func pipe(ctx core.Context, dst, src net.Conn, r *recorder) {
+	_, err := io.Copy(dst, io.TeeReader(src, r))
+	r.complete()
+
+	if err != nil {
+		ctx.Logger.Debug().Err(err).Msg("failed to forward")
+		dst.Close()
+		src.Close()
+		return
+	}
+
+	if cw, ok := dst.(closeWriter); ok {
+		if err := cw.CloseWrite(); err != nil {
+			ctx.Logger.Debug().Err(err).Msg("failed to close write")
+		}
+	}
+}
+
+// newConnRecorder creates a recorder for one direction of a
+// proxied connection from src to dst. Extra metadata values
+// are copied to the recorder's metadata.
+func newConnRecorder(id string, d tcp.Direction, src, dst, listenAddr net.Addr, extra map[string]interface{}) *recorder {
+	var (
+		srcAddr, srcPort = tcp.SplitAddr(src)
+		dstAddr, dstPort = tcp.SplitAddr(dst)
+		_, listenPort    = tcp.SplitAddr(listenAddr)
+		timeline         = tcp.NewTimeline()
+	)
+
+	values := map[string]interface{}{
+		tcp.MetaDirection:  d,
+		tcp.MetaSrcAddr:    srcAddr,
+		tcp.MetaSrcPort:    srcPort,
+		tcp.MetaDstAddr:    dstAddr,
+		tcp.MetaDstPort:    dstPort,
+		tcp.MetaListenPort: listenPort,
+		tcp.MetaTimeline:   timeline,
+	}
+	for k, v := range extra {
+		values[k] = v
+	}
+
+	return newRecorder(core.NewMeta(id, values), timeline)
+}
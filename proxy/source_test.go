@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewSource(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addr        string
+		upstream    string
+		errContains string
+	}{
+		{
+			desc:     "valid",
+			addr:     "0.0.0.0:8080",
+			upstream: "10.0.0.1:80",
+		},
+		{
+			desc:        "invalid addr",
+			addr:        "0.0.0.0",
+			upstream:    "10.0.0.1:80",
+			errContains: "invalid address",
+		},
+		{
+			desc:        "missing upstream",
+			addr:        "0.0.0.0:8080",
+			errContains: "proxy upstream is required",
+		},
+		{
+			desc:        "invalid upstream",
+			addr:        "0.0.0.0:8080",
+			upstream:    "10.0.0.1",
+			errContains: "invalid proxy upstream",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				Addr:          c.addr,
+				ProxyUpstream: c.upstream,
+			}, nil)
+			_, err := NewSource(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func TestProxy(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer upstream.Close()
+
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		b, err := ioutil.ReadAll(conn)
+		if err != nil {
+			return
+		}
+		conn.Write(append([]byte("re: "), b...))
+	}()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{
+			Addr:           l.Addr().String(),
+			ProxyUpstream:  upstream.Addr().String(),
+			SourceDuration: time.Minute,
+		}, errs)
+	)
+
+	source, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s := source.(*proxySource)
+	s.listen = func(string, string) (net.Listener, error) {
+		return l, nil
+	}
+
+	go s.Init(ctx)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	assert.NilError(t, err)
+	defer client.Close()
+
+	var (
+		up   = <-s.Streams()
+		down = <-s.Streams()
+	)
+
+	_, err = client.Write([]byte("hello"))
+	assert.NilError(t, err)
+	assert.NilError(t, client.(*net.TCPConn).CloseWrite())
+
+	res, err := ioutil.ReadAll(client)
+	assert.NilError(t, err)
+	assert.Equal(t, "re: hello", string(res))
+
+	upData, err := ioutil.ReadAll(up)
+	assert.NilError(t, err)
+	assert.Equal(t, "hello", string(upData))
+
+	downData, err := ioutil.ReadAll(down)
+	assert.NilError(t, err)
+	assert.Equal(t, "re: hello", string(downData))
+
+	assert.Equal(t, up.Meta().SourceID, down.Meta().SourceID)
+
+	var (
+		clientPort   = strconv.Itoa(client.LocalAddr().(*net.TCPAddr).Port)
+		upstreamPort = strconv.Itoa(upstream.Addr().(*net.TCPAddr).Port)
+		listenPort   = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	)
+
+	for _, c := range []struct {
+		r       core.InputReader
+		d       tcp.Direction
+		srcPort string
+		dstPort string
+	}{
+		{r: up, d: tcp.DirectionUp, srcPort: clientPort, dstPort: upstreamPort},
+		{r: down, d: tcp.DirectionDown, srcPort: upstreamPort, dstPort: clientPort},
+	} {
+		d, _ := c.r.Meta().Get(tcp.MetaDirection)
+		assert.Equal(t, c.d, d)
+		srcAddr, _ := c.r.Meta().GetString(tcp.MetaSrcAddr)
+		assert.Equal(t, "127.0.0.1", srcAddr)
+		srcPort, _ := c.r.Meta().GetString(tcp.MetaSrcPort)
+		assert.Equal(t, c.srcPort, srcPort)
+		dstPort, _ := c.r.Meta().GetString(tcp.MetaDstPort)
+		assert.Equal(t, c.dstPort, dstPort)
+		port, _ := c.r.Meta().GetString(tcp.MetaListenPort)
+		assert.Equal(t, listenPort, port)
+		_, ok := c.r.Meta().Get(tcp.MetaTimeline)
+		assert.Assert(t, ok)
+	}
+
+	ctx.Cancel()
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestProxyUpstreamDown(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	upstreamAddr := upstream.Addr().String()
+	upstream.Close()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{
+			Addr:           l.Addr().String(),
+			ProxyUpstream:  upstreamAddr,
+			SourceDuration: time.Minute,
+		}, errs)
+	)
+
+	source, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s := source.(*proxySource)
+	s.listen = func(string, string) (net.Listener, error) {
+		return l, nil
+	}
+
+	go s.Init(ctx)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	assert.NilError(t, err)
+	defer client.Close()
+
+	assert.ErrorContains(t, <-errs, "failed to dial proxy upstream")
+
+	// The client connection is closed.
+	_, err = ioutil.ReadAll(client)
+	assert.NilError(t, err)
+
+	ctx.Cancel()
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+}
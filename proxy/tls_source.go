@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tlsx"
+)
+
+// handshakeTimeout is how long a client has to send its CONNECT
+// request and complete the TLS handshake.
+const handshakeTimeout = 10 * time.Second
+
+// NewTLSSource creates a new TLS-intercepting proxy source. It is
+// an HTTP CONNECT proxy that terminates TLS with certificates signed
+// by the configured CA and forwards the decrypted traffic over a new
+// TLS connection to the requested host.
+func NewTLSSource(ctx core.Context) (core.Source, error) {
+	if _, _, err := net.SplitHostPort(ctx.FlowConfig.Addr); err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	if ctx.FlowConfig.ProxyCACert == "" || ctx.FlowConfig.ProxyCAKey == "" {
+		return nil, errors.New("proxy CA certificate and key are required")
+	}
+
+	ca, err := loadCertAuthority(ctx.FlowConfig.ProxyCACert, ctx.FlowConfig.ProxyCAKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTLSSource(ca, nil), nil
+}
+
+func newTLSSource(ca *certAuthority, rootCAs *x509.CertPool) *proxySource {
+	i := &interceptor{
+		ca:      ca,
+		rootCAs: rootCAs,
+	}
+
+	return &proxySource{
+		streams: make(chan core.InputReader),
+		listen:  net.Listen,
+		connect: i.connect,
+	}
+}
+
+// interceptor intercepts TLS connections tunneled with HTTP CONNECT.
+type interceptor struct {
+	ca *certAuthority
+
+	// rootCAs verify upstream certificates. If nil,
+	// the host's root CAs are used.
+	rootCAs *x509.CertPool
+}
+
+// connect accepts a CONNECT request from a client, completes a TLS
+// handshake with it, and dials the requested host.
+func (i *interceptor) connect(ctx core.Context, conn net.Conn) (net.Conn, net.Conn, map[string]interface{}, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to set handshake deadline: %w", err)
+	}
+
+	buf := bufio.NewReader(conn)
+
+	req, err := http.ReadRequest(buf)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read CONNECT request: %w", err)
+	}
+
+	if req.Method != http.MethodConnect {
+		writeStatus(conn, http.StatusMethodNotAllowed)
+		return nil, nil, nil, fmt.Errorf("unsupported proxy method: %s", req.Method)
+	}
+
+	target := req.Host
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, "443")
+	}
+	host, _, _ := net.SplitHostPort(target)
+
+	if err := writeStatus(conn, http.StatusOK); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to accept CONNECT request: %w", err)
+	}
+
+	ctx.Logger.Debug().Str("target", target).Msg("accepted CONNECT request")
+
+	// The client does not send its handshake until the CONNECT
+	// request is accepted, but the buffered reader must still be
+	// drained before the connection is read directly.
+	client := tls.Server(&bufferedConn{Conn: conn, r: buf}, &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			name := hello.ServerName
+			if name == "" {
+				name = host
+			}
+			return i.ca.leaf(name, time.Now())
+		},
+		// Only HTTP/1.1 can be parsed from the recorded streams.
+		NextProtos: []string{"http/1.1"},
+	})
+
+	if err := client.Handshake(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to complete client handshake: %w", err)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to clear handshake deadline: %w", err)
+	}
+
+	state := client.ConnectionState()
+
+	serverName := state.ServerName
+	if serverName == "" {
+		serverName = host
+	}
+
+	d := &tls.Dialer{
+		Config: &tls.Config{
+			ServerName: serverName,
+			RootCAs:    i.rootCAs,
+			NextProtos: []string{"http/1.1"},
+		},
+	}
+
+	upstream, err := d.DialContext(ctx.StdContext, "tcp", target)
+	if err != nil {
+		client.Close()
+		return nil, nil, nil, fmt.Errorf("failed to dial %s: %w", target, err)
+	}
+
+	return client, upstream, map[string]interface{}{
+		tlsx.MetaServerName:  serverName,
+		tlsx.MetaVersion:     tlsx.VersionName(state.Version),
+		tlsx.MetaCipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}, nil
+}
+
+func writeStatus(conn net.Conn, code int) error {
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\n\r\n", code, http.StatusText(code))
+	return err
+}
+
+// bufferedConn is a connection that is read through a buffered reader.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"github.com/rename-this/vhs/tlsx"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewTLSSource(t *testing.T) {
+	_, _, certFile, keyFile := newTestCA(t, true)
+
+	cases := []struct {
+		desc        string
+		addr        string
+		certFile    string
+		keyFile     string
+		errContains string
+	}{
+		{
+			desc:     "valid",
+			addr:     "0.0.0.0:8080",
+			certFile: certFile,
+			keyFile:  keyFile,
+		},
+		{
+			desc:        "invalid addr",
+			addr:        "0.0.0.0",
+			certFile:    certFile,
+			keyFile:     keyFile,
+			errContains: "invalid address",
+		},
+		{
+			desc:        "missing CA",
+			addr:        "0.0.0.0:8080",
+			errContains: "proxy CA certificate and key are required",
+		},
+		{
+			desc:        "bad CA",
+			addr:        "0.0.0.0:8080",
+			certFile:    keyFile,
+			keyFile:     keyFile,
+			errContains: "failed to load CA key pair",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				Addr:        c.addr,
+				ProxyCACert: c.certFile,
+				ProxyCAKey:  c.keyFile,
+			}, nil)
+			_, err := NewTLSSource(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func TestTLSProxy(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "hello from %s", r.URL.Path)
+	}))
+	defer upstream.Close()
+
+	caCert, caKey, _, _ := newTestCA(t, true)
+
+	ca, err := newCertAuthority(caCert, caKey)
+	assert.NilError(t, err)
+
+	upstreamRoots := x509.NewCertPool()
+	upstreamRoots.AddCert(upstream.Certificate())
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{
+			Addr:           l.Addr().String(),
+			SourceDuration: time.Minute,
+		}, errs)
+		s = newTLSSource(ca, upstreamRoots)
+	)
+
+	s.listen = func(string, string) (net.Listener, error) {
+		return l, nil
+	}
+
+	go s.Init(ctx)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+
+	proxyURL, err := url.Parse("http://" + l.Addr().String())
+	assert.NilError(t, err)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(proxyURL),
+			TLSClientConfig:   &tls.Config{RootCAs: roots},
+			DisableKeepAlives: true,
+		},
+	}
+
+	type result struct {
+		body string
+		err  error
+	}
+
+	res := make(chan result, 1)
+
+	go func() {
+		r, err := client.Get(upstream.URL + "/test")
+		if err != nil {
+			res <- result{err: err}
+			return
+		}
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		res <- result{body: string(b), err: err}
+	}()
+
+	var (
+		up   = <-s.Streams()
+		down = <-s.Streams()
+		data = make(chan string, 1)
+	)
+
+	go func() {
+		b, _ := ioutil.ReadAll(down)
+		data <- string(b)
+	}()
+
+	upData, err := ioutil.ReadAll(up)
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasPrefix(string(upData), "GET /test HTTP/1.1\r\n"), string(upData))
+
+	downData := <-data
+	assert.Assert(t, strings.HasPrefix(downData, "HTTP/1.1 200 OK\r\n"), downData)
+	assert.Assert(t, strings.HasSuffix(downData, "hello from /test"), downData)
+
+	r := <-res
+	assert.NilError(t, r.err)
+	assert.Equal(t, "hello from /test", r.body)
+
+	upstreamAddr, err := url.Parse(upstream.URL)
+	assert.NilError(t, err)
+
+	assert.Equal(t, up.Meta().SourceID, down.Meta().SourceID)
+
+	for _, c := range []struct {
+		r core.InputReader
+		d tcp.Direction
+	}{
+		{r: up, d: tcp.DirectionUp},
+		{r: down, d: tcp.DirectionDown},
+	} {
+		d, _ := c.r.Meta().Get(tcp.MetaDirection)
+		assert.Equal(t, c.d, d)
+		serverName, _ := c.r.Meta().GetString(tlsx.MetaServerName)
+		assert.Equal(t, "127.0.0.1", serverName)
+		version, _ := c.r.Meta().GetString(tlsx.MetaVersion)
+		assert.Equal(t, "TLS 1.3", version)
+		cipherSuite, _ := c.r.Meta().GetString(tlsx.MetaCipherSuite)
+		assert.Assert(t, cipherSuite != "")
+	}
+
+	dstPort, _ := up.Meta().GetString(tcp.MetaDstPort)
+	assert.Equal(t, upstreamAddr.Port(), dstPort)
+
+	ctx.Cancel()
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestTLSProxyMethodNotAllowed(t *testing.T) {
+	caCert, caKey, _, _ := newTestCA(t, true)
+
+	ca, err := newCertAuthority(caCert, caKey)
+	assert.NilError(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	var (
+		errs = make(chan error, 1)
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{
+			Addr:           l.Addr().String(),
+			SourceDuration: time.Minute,
+		}, errs)
+		s = newTLSSource(ca, nil)
+	)
+
+	s.listen = func(string, string) (net.Listener, error) {
+		return l, nil
+	}
+
+	go s.Init(ctx)
+
+	res, err := http.Get("http://" + l.Addr().String() + "/")
+	assert.NilError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+	assert.ErrorContains(t, <-errs, "unsupported proxy method: GET")
+
+	ctx.Cancel()
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+}
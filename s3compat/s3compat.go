@@ -2,14 +2,39 @@ package s3compat
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/nametmpl"
+	"github.com/rename-this/vhs/internal/objects"
 )
 
-// NewSink creates a new S3-compatible sink.
+const (
+	// DefaultPartSize is the default size of each part of
+	// a multipart upload. It is the smallest size that S3
+	// accepts for any part but the last.
+	DefaultPartSize = 5 << 20
+
+	// maxPartSize is the largest size that
+	// S3 accepts for a part.
+	maxPartSize = 5 << 30
+)
+
+// NewSink creates a new S3-compatible sink. The object is named
+// by the object name template and prefix, and the object labels
+// are attached to it as metadata. Output is streamed to the store
+// in a multipart upload: a part is uploaded each time the part
+// size is reached and the upload is completed when the sink is
+// closed. Output smaller than a single part is uploaded in one
+// request. If the flow stops and the sink is not closed within
+// a minute, the multipart upload is aborted.
 func NewSink(ctx core.Context) (core.Sink, error) {
 	ctx.Logger = ctx.Logger.With().
 		Str(core.LoggerKeyComponent, "s3compat_sink").
@@ -17,98 +42,290 @@ func NewSink(ctx core.Context) (core.Sink, error) {
 
 	ctx.Logger.Debug().Msg("creating sink")
 
+	partSize := ctx.FlowConfig.S3CompatPartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < DefaultPartSize || partSize > maxPartSize {
+		return nil, fmt.Errorf("part size must be between %d and %d bytes", int64(DefaultPartSize), int64(maxPartSize))
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hostname: %w", err)
+	}
+
 	client, err := newClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("falied to create S3-compatible sink client: %w", err)
 	}
 
-	ctx.Logger.Debug().Msg("creating sink")
+	object := nametmpl.Object(ctx.FlowConfig.S3CompatObjectPrefix, ctx.FlowConfig.S3CompatObjectName, nametmpl.Values{
+		SessionID: ctx.SessionID,
+		Time:      time.Now(),
+		Hostname:  hostname,
+		Seq:       nametmpl.NextObjectSeq(),
+	})
+
+	ctx.Logger.Debug().Str("name", object).Msg("sink created")
 
 	return &sink{
-		ctx:    ctx,
-		client: client,
-		buf:    &bytes.Buffer{},
+		ctx:          ctx,
+		core:         minio.Core{Client: client},
+		bucket:       ctx.FlowConfig.S3CompatBucketName,
+		object:       object,
+		opts:         minio.PutObjectOptions{UserMetadata: ctx.FlowConfig.ObjectLabels},
+		partSize:     int(partSize),
+		abortTimeout: objects.AbortTimeout,
+		closed:       make(chan struct{}),
 	}, nil
 }
 
 type sink struct {
-	ctx    core.Context
-	client *minio.Client
-	buf    *bytes.Buffer
+	ctx      core.Context
+	core     minio.Core
+	bucket   string
+	object   string
+	opts     minio.PutObjectOptions
+	partSize int
+
+	abortTimeout time.Duration
+	closed       chan struct{}
+	closeOnce    sync.Once
+
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	uploadID string
+	parts    []minio.CompletePart
+	err      error
 }
 
 func (s *sink) Write(p []byte) (int, error) {
-	return s.buf.Write(p)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	s.buf.Write(p)
+
+	// Sinks are still written to while a flow shuts down,
+	// after the session context is canceled, so parts are
+	// not bound to it. The upload is aborted if a part fails
+	// to upload or if the sink is not closed in time.
+	for s.buf.Len() >= s.partSize {
+		if err := s.putPart(context.Background(), s.buf.Next(s.partSize)); err != nil {
+			s.fail(err)
+			return 0, err
+		}
+	}
+
+	return len(p), nil
 }
 
 func (s *sink) Close() error {
-	_, err := s.client.PutObject(
-		s.ctx.StdContext,
-		s.ctx.FlowConfig.S3CompatBucketName,
-		s.ctx.SessionID,
-		s.buf,
-		int64(s.buf.Len()),
-		minio.PutObjectOptions{})
+	defer s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	// The session context is canceled before sinks are closed
+	// when a flow shuts down, so the final requests are not
+	// bound to it.
+	ctx := context.Background()
+
+	if s.uploadID == "" {
+		_, err := s.core.Client.PutObject(ctx, s.bucket, s.object, &s.buf, int64(s.buf.Len()), s.opts)
+		if err != nil {
+			s.err = fmt.Errorf("failed to put object to S3-compatible store: %w", err)
+			return s.err
+		}
+	} else {
+		if s.buf.Len() > 0 {
+			if err := s.putPart(ctx, s.buf.Bytes()); err != nil {
+				s.fail(err)
+				return err
+			}
+		}
+
+		if _, err := s.core.CompleteMultipartUpload(ctx, s.bucket, s.object, s.uploadID, s.parts); err != nil {
+			s.fail(fmt.Errorf("failed to complete multipart upload to S3-compatible store: %w", err))
+			return s.err
+		}
+	}
+
+	s.err = os.ErrClosed
+	s.buf.Reset()
+
+	s.ctx.Logger.Debug().Int("parts", len(s.parts)).Msg("sink closed")
+
+	return nil
+}
+
+// putPart uploads a part, starting the multipart upload
+// if this is the first part. s.mu must be held.
+func (s *sink) putPart(ctx context.Context, p []byte) error {
+	if s.uploadID == "" {
+		id, err := s.core.NewMultipartUpload(ctx, s.bucket, s.object, s.opts)
+		if err != nil {
+			return fmt.Errorf("failed to start multipart upload to S3-compatible store: %w", err)
+		}
+
+		s.uploadID = id
+
+		s.ctx.Logger.Debug().Str("upload_id", id).Msg("multipart upload started")
+
+		go objects.AbortIfNotClosed(s.ctx, s.closed, s.abortTimeout, s.abort)
+	}
+
+	num := len(s.parts) + 1
+
+	part, err := s.core.PutObjectPart(ctx, s.bucket, s.object, s.uploadID, num, bytes.NewReader(p), int64(len(p)), "", "", nil)
 	if err != nil {
-		return fmt.Errorf("failed to put object to S3-compatible store: %w", err)
+		return fmt.Errorf("failed to upload part %d to S3-compatible store: %w", num, err)
 	}
 
-	s.ctx.Logger.Debug().Msg("sink closed")
+	s.parts = append(s.parts, minio.CompletePart{
+		PartNumber: part.PartNumber,
+		ETag:       part.ETag,
+	})
+
+	s.ctx.Logger.Debug().Int("part", num).Int("size", len(p)).Msg("part uploaded")
 
 	return nil
 }
 
-// NewSource creates a new S3-compatible source.
+// fail records an error that ends the sink and aborts the
+// multipart upload, if one was started, so that the parts
+// already uploaded are discarded. s.mu must be held.
+func (s *sink) fail(err error) {
+	s.err = err
+	s.buf.Reset()
+
+	if s.uploadID == "" {
+		return
+	}
+
+	if err := s.core.AbortMultipartUpload(context.Background(), s.bucket, s.object, s.uploadID); err != nil {
+		s.ctx.Logger.Error().Err(err).Str("upload_id", s.uploadID).Msg("failed to abort multipart upload")
+		return
+	}
+
+	s.ctx.Logger.Debug().Str("upload_id", s.uploadID).Msg("multipart upload aborted")
+}
+
+// abort aborts the multipart upload of a sink that was
+// not closed in time after its flow stopped.
+func (s *sink) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The sink was closed or failed while waiting for the lock.
+	if s.err != nil {
+		return
+	}
+
+	s.ctx.Logger.Error().Str("upload_id", s.uploadID).Msg("sink not closed after flow stopped")
+
+	s.fail(fmt.Errorf("multipart upload aborted because the sink was not closed within %s of the flow stopping", s.abortTimeout))
+}
+
+// NewSource creates a new S3-compatible source. It reads the
+// object named by the object name and prefix or, if the name is
+// empty or a glob pattern, lists the objects under the prefix
+// and reads those that match and that were modified in the time
+// range, in name order, with one stream per object.
 func NewSource(ctx core.Context) (core.Source, error) {
+	sel, err := objects.NewSelector(
+		ctx.FlowConfig.S3CompatObjectPrefix,
+		ctx.FlowConfig.S3CompatObjectName,
+		ctx.FlowConfig.ObjectModifiedAfter,
+		ctx.FlowConfig.ObjectModifiedBefore,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select objects: %w", err)
+	}
+
 	client, err := newClient(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("falied to create S3-compatible source client: %w", err)
 	}
+
 	return &source{
 		client:  client,
-		streams: make(chan core.InputReader),
+		bucket:  ctx.FlowConfig.S3CompatBucketName,
+		emitter: objects.NewEmitter(ctx.FlowConfig.ObjectDownloads),
+		sel:     sel,
 	}, nil
 }
 
 type source struct {
 	client  *minio.Client
-	streams chan core.InputReader
+	bucket  string
+	emitter *objects.Emitter
+	sel     objects.Selector
+}
+
+func (s *source) Streams() <-chan core.InputReader {
+	return s.emitter.Streams()
 }
 
 func (s *source) Init(ctx core.Context) {
+	defer s.emitter.Close()
+
 	ctx.Logger = ctx.Logger.With().
 		Str(core.LoggerKeyComponent, "s3compat_source").
 		Logger()
 
-	o, err := s.client.GetObject(
-		ctx.StdContext,
-		ctx.FlowConfig.S3CompatBucketName,
-		ctx.FlowConfig.S3CompatObjectName,
-		minio.GetObjectOptions{})
-	if err != nil {
-		ctx.Errors <- fmt.Errorf("failed to get object from S3-compatible store: %w", err)
+	ctx.Logger.Debug().Msg("init")
+
+	if name, ok := s.sel.Single(); ok {
+		s.emitter.Emit(ctx, name, s.open)
 		return
 	}
 
-	s.streams <- &stream{
-		Object: o,
-		meta:   core.NewMeta(ctx.FlowConfig.S3CompatObjectName, nil),
-	}
+	// The listing is canceled if the source
+	// stops before all objects are read.
+	listCtx, cancel := context.WithCancel(ctx.StdContext)
+	defer cancel()
 
-	ctx.Logger.Debug().Msg("init complete")
-}
+	infos := s.client.ListObjects(listCtx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.sel.ListPrefix(),
+		Recursive: true,
+	})
 
-func (s *source) Streams() <-chan core.InputReader {
-	return s.streams
-}
+	for info := range infos {
+		if info.Err != nil {
+			ctx.Errors <- fmt.Errorf("failed to list objects in S3-compatible store: %w", info.Err)
+			return
+		}
 
-type stream struct {
-	*minio.Object
-	meta *core.Meta
+		if !s.sel.Match(info.Key, info.LastModified) {
+			continue
+		}
+
+		if !s.emitter.Emit(ctx, info.Key, s.open) {
+			return
+		}
+	}
+
+	ctx.Logger.Debug().Msg("all objects read")
 }
 
-func (s *stream) Meta() *core.Meta {
-	return s.meta
+// open opens an object in the bucket for reading.
+func (s *source) open(ctx context.Context, name string) (io.ReadCloser, error) {
+	o, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object %s from S3-compatible store: %w", name, err)
+	}
+	return o, nil
 }
 
 func newClient(ctx core.Context) (*minio.Client, error) {
@@ -1,13 +1,18 @@
 package s3compat
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/objects"
 	"github.com/rename-this/vhs/internal/smoke"
 	"gotest.tools/v3/assert"
 
@@ -172,3 +177,317 @@ func TestSourceWithSink(t *testing.T) {
 		})
 	}
 }
+
+func TestNewSink(t *testing.T) {
+	cases := []struct {
+		desc        string
+		partSize    int64
+		errContains string
+	}{
+		{
+			desc: "default part size",
+		},
+		{
+			desc:     "part size",
+			partSize: 8 << 20,
+		},
+		{
+			desc:        "part size too small",
+			partSize:    1 << 20,
+			errContains: "part size must be between",
+		},
+		{
+			desc:        "part size too large",
+			partSize:    6 << 30,
+			errContains: "part size must be between",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				S3CompatEndpoint: endpoint,
+				S3CompatPartSize: c.partSize,
+			}, nil)
+			_, err := NewSink(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+// newTestSink creates a sink that writes to a new bucket.
+func newTestSink(t *testing.T, bucketName string, opts ...func(*core.FlowConfig)) (core.Context, *sink) {
+	minioClient, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: false,
+	})
+	assert.NilError(t, err)
+	err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{Region: "tmp"})
+	assert.NilError(t, err)
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		S3CompatEndpoint:   endpoint,
+		S3CompatAccessKey:  accessKey,
+		S3CompatSecretKey:  secretKey,
+		S3CompatBucketName: bucketName,
+	}, nil)
+	ctx.SessionID = "session"
+
+	for _, opt := range opts {
+		opt(ctx.FlowConfig)
+	}
+
+	snk, err := NewSink(ctx)
+	assert.NilError(t, err)
+
+	return ctx, snk.(*sink)
+}
+
+func TestSinkMultipart(t *testing.T) {
+	ctx, s := newTestSink(t, "bucket-multipart")
+	defer ctx.Cancel()
+
+	// 11 MiB is written in 1 MiB chunks, so two full
+	// parts are uploaded by writes and the last 1 MiB
+	// is uploaded when the sink is closed.
+	var data []byte
+	for i := 0; i < 11; i++ {
+		chunk := bytes.Repeat([]byte{byte('a' + i)}, 1<<20)
+		data = append(data, chunk...)
+
+		_, err := s.Write(chunk)
+		assert.NilError(t, err)
+		assert.Equal(t, (i+1)/5, len(s.parts))
+		assert.Assert(t, s.buf.Len() < s.partSize)
+	}
+
+	assert.NilError(t, s.Close())
+	assert.Equal(t, 3, len(s.parts))
+
+	o, err := s.core.Client.GetObject(context.Background(), s.bucket, s.object, minio.GetObjectOptions{})
+	assert.NilError(t, err)
+	defer o.Close()
+
+	info, err := o.Stat()
+	assert.NilError(t, err)
+	assert.Assert(t, strings.HasSuffix(info.ETag, "-3"))
+
+	b, err := ioutil.ReadAll(o)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(data, b))
+
+	_, err = s.Write([]byte("111"))
+	assert.Assert(t, errors.Is(err, os.ErrClosed))
+}
+
+func TestSinkWriteAfterCancel(t *testing.T) {
+	ctx, s := newTestSink(t, "bucket-write-after-cancel")
+
+	_, err := s.Write(make([]byte, s.partSize))
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(s.parts))
+
+	// Writes made while the flow shuts down, after the
+	// session context is canceled, are still uploaded.
+	ctx.Cancel()
+
+	_, err = s.Write(make([]byte, s.partSize+1))
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(s.parts))
+	assert.NilError(t, s.Close())
+	assert.Equal(t, 3, len(s.parts))
+
+	info, err := s.core.StatObject(context.Background(), s.bucket, s.object, minio.StatObjectOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, int64(2*s.partSize+1), info.Size)
+}
+
+func TestSinkCancel(t *testing.T) {
+	ctx, s := newTestSink(t, "bucket-cancel")
+	s.abortTimeout = 10 * time.Millisecond
+
+	_, err := s.Write(make([]byte, s.partSize))
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(s.parts))
+
+	// The flow stops, but the sink is never closed.
+	ctx.Cancel()
+
+	var uploads minio.ListMultipartUploadsResult
+	for i := 0; i < 100; i++ {
+		uploads, err = s.core.ListMultipartUploads(context.Background(), s.bucket, "", "", "", "", 0)
+		assert.NilError(t, err)
+		if len(uploads.Uploads) == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 0, len(uploads.Uploads))
+
+	_, err = s.Write([]byte("111"))
+	assert.ErrorContains(t, err, "multipart upload aborted")
+	assert.ErrorContains(t, s.Close(), "multipart upload aborted")
+
+	_, err = s.core.StatObject(context.Background(), s.bucket, s.object, minio.StatObjectOptions{})
+	assert.Assert(t, err != nil)
+}
+
+func TestSinkObjectName(t *testing.T) {
+	hostname, err := os.Hostname()
+	assert.NilError(t, err)
+
+	cases := []struct {
+		desc string
+		size int
+	}{
+		{
+			desc: "single",
+			size: 3,
+		},
+		{
+			desc: "multipart",
+			size: DefaultPartSize + 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			bucketName := "bucket-name-" + c.desc
+
+			ctx, s := newTestSink(t, bucketName, func(cfg *core.FlowConfig) {
+				cfg.S3CompatObjectName = "{hostname}/{session}.json"
+				cfg.S3CompatObjectPrefix = "vhs/"
+				cfg.ObjectLabels = map[string]string{"env": "test"}
+			})
+			defer ctx.Cancel()
+
+			assert.Equal(t, "vhs/"+hostname+"/session.json", s.object)
+
+			_, err := s.Write(make([]byte, c.size))
+			assert.NilError(t, err)
+			assert.NilError(t, s.Close())
+
+			info, err := s.core.StatObject(context.Background(), bucketName, s.object, minio.StatObjectOptions{})
+			assert.NilError(t, err)
+			assert.Equal(t, int64(c.size), info.Size)
+			assert.Equal(t, "test", info.UserMetadata["Env"])
+		})
+	}
+}
+
+func TestSourceObjects(t *testing.T) {
+	bucketName := "bucket-objects"
+
+	minioClient, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: false,
+	})
+	assert.NilError(t, err)
+	err = minioClient.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{Region: "tmp"})
+	assert.NilError(t, err)
+
+	put := func(name string) {
+		_, err := minioClient.PutObject(context.Background(), bucketName, name, strings.NewReader(path.Base(name)[:1]), 1, minio.PutObjectOptions{})
+		assert.NilError(t, err)
+	}
+
+	put("vhs/2020-09-01/b.json")
+	put("vhs/2020-09-01/a.json")
+	put("other/e.json")
+
+	// Modification times are compared to the
+	// time between the first and later objects.
+	time.Sleep(time.Second)
+	mid := time.Now()
+	time.Sleep(time.Second)
+
+	put("vhs/2020-09-01/c.har")
+	put("vhs/2020-09-02/d.json")
+
+	cases := []struct {
+		desc         string
+		objectName   string
+		objectPrefix string
+		after        time.Time
+		before       time.Time
+		expected     []string
+		errContains  string
+	}{
+		{
+			desc:         "prefix",
+			objectPrefix: "vhs/",
+			expected:     []string{"vhs/2020-09-01/a.json", "vhs/2020-09-01/b.json", "vhs/2020-09-01/c.har", "vhs/2020-09-02/d.json"},
+		},
+		{
+			desc:         "pattern",
+			objectPrefix: "vhs/",
+			objectName:   "*/*.json",
+			expected:     []string{"vhs/2020-09-01/a.json", "vhs/2020-09-01/b.json", "vhs/2020-09-02/d.json"},
+		},
+		{
+			desc:         "after",
+			objectPrefix: "vhs/",
+			after:        mid,
+			expected:     []string{"vhs/2020-09-01/c.har", "vhs/2020-09-02/d.json"},
+		},
+		{
+			desc:         "before",
+			objectPrefix: "vhs/",
+			before:       mid,
+			expected:     []string{"vhs/2020-09-01/a.json", "vhs/2020-09-01/b.json"},
+		},
+		{
+			desc:         "no match",
+			objectPrefix: "none/",
+		},
+		{
+			desc:        "bad pattern",
+			objectName:  "[",
+			errContains: "failed to select objects",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			errs := make(chan error, 10)
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+				S3CompatEndpoint:     endpoint,
+				S3CompatAccessKey:    accessKey,
+				S3CompatSecretKey:    secretKey,
+				S3CompatBucketName:   bucketName,
+				S3CompatObjectName:   c.objectName,
+				S3CompatObjectPrefix: c.objectPrefix,
+				ObjectModifiedAfter:  c.after,
+				ObjectModifiedBefore: c.before,
+				ObjectDownloads:      2,
+			}, errs)
+			defer ctx.Cancel()
+
+			src, err := NewSource(ctx)
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+
+			go src.Init(ctx)
+
+			var names []string
+			for r := range src.Streams() {
+				name, _ := r.Meta().GetString(objects.MetaObjectName)
+				assert.Equal(t, name, r.Meta().SourceID)
+
+				data, err := ioutil.ReadAll(r)
+				assert.NilError(t, err)
+				assert.NilError(t, r.Close())
+				assert.Equal(t, path.Base(name)[:1], string(data))
+
+				names = append(names, name)
+			}
+
+			assert.DeepEqual(t, c.expected, names)
+			assert.Equal(t, 0, len(errs))
+		})
+	}
+}
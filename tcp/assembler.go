@@ -0,0 +1,136 @@
+package tcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/rename-this/vhs/core"
+)
+
+// assemblerPacket is a packet queued for an assembler.
+type assemblerPacket struct {
+	flow gopacket.Flow
+	tcp  *layers.TCP
+	ac   assemblerContext
+}
+
+// hash gets a hash of the packet's connection. It
+// is the same for packets in either direction.
+func (p *assemblerPacket) hash() uint64 {
+	return p.flow.FastHash() ^ p.tcp.TransportFlow().FastHash()
+}
+
+// assemblerShards spreads packets across assemblers, each running
+// in its own goroutine with its own stream pool. Packets are sharded
+// by a symmetric hash of their flow so that both directions of a
+// connection are always reassembled by the same assembler.
+type assemblerShards struct {
+	shards []*assemblerShard
+	wg     sync.WaitGroup
+}
+
+type assemblerShard struct {
+	packets   chan assemblerPacket
+	flush     chan time.Time
+	assembler *reassembly.Assembler
+}
+
+func newAssemblerShards(factory reassembly.StreamFactory, n, queueSize int) *assemblerShards {
+	if n <= 0 {
+		n = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	a := &assemblerShards{
+		shards: make([]*assemblerShard, n),
+	}
+	for i := range a.shards {
+		a.shards[i] = &assemblerShard{
+			packets:   make(chan assemblerPacket, queueSize),
+			flush:     make(chan time.Time, 1),
+			assembler: reassembly.NewAssembler(reassembly.NewStreamPool(factory)),
+		}
+	}
+
+	return a
+}
+
+// start starts the assemblers. They run until close is
+// called, or until stop or the context is done.
+func (a *assemblerShards) start(ctx core.Context, stop <-chan struct{}) {
+	a.wg.Add(len(a.shards))
+	for _, s := range a.shards {
+		go func(s *assemblerShard) {
+			defer a.wg.Done()
+			s.run(ctx, stop)
+		}(s)
+	}
+}
+
+// assemble queues a packet for its assembler, blocking
+// while the queue is full. It returns false if the
+// context is done before the packet is queued.
+func (a *assemblerShards) assemble(ctx core.Context, p assemblerPacket) bool {
+	s := a.shards[p.hash()%uint64(len(a.shards))]
+
+	select {
+	case s.packets <- p:
+		return true
+	case <-ctx.StdContext.Done():
+		return false
+	}
+}
+
+// flushCloseOlderThan asks every assembler to flush and close
+// connections older than t. A flush is skipped for assemblers
+// that have not finished the previous one.
+func (a *assemblerShards) flushCloseOlderThan(t time.Time) {
+	for _, s := range a.shards {
+		select {
+		case s.flush <- t:
+		default:
+		}
+	}
+}
+
+// close flushes all connections once the queued packets
+// have been assembled and waits for the assemblers to stop.
+func (a *assemblerShards) close() {
+	for _, s := range a.shards {
+		close(s.packets)
+	}
+	a.wg.Wait()
+}
+
+// queueDepths gets the number of packets queued for each assembler.
+func (a *assemblerShards) queueDepths() []int {
+	depths := make([]int, len(a.shards))
+	for i, s := range a.shards {
+		depths[i] = len(s.packets)
+	}
+	return depths
+}
+
+func (s *assemblerShard) run(ctx core.Context, stop <-chan struct{}) {
+	for {
+		select {
+		case p, more := <-s.packets:
+			if !more {
+				s.assembler.FlushAll()
+				return
+			}
+			s.assembler.AssembleWithContext(p.flow, p.tcp, &p.ac)
+		case t := <-s.flush:
+			s.assembler.FlushCloseOlderThan(t)
+		case <-stop:
+			return
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+}
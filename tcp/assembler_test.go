@@ -0,0 +1,127 @@
+package tcp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
+
+func newAssemblerPacket(p gopacket.Packet) assemblerPacket {
+	return assemblerPacket{
+		flow: p.NetworkLayer().NetworkFlow(),
+		tcp:  p.TransportLayer().(*layers.TCP),
+		ac:   assemblerContext(gopacket.CaptureInfo{Timestamp: time.Now()}),
+	}
+}
+
+func TestAssemblerShards(t *testing.T) {
+	cases := []struct {
+		desc      string
+		n         int
+		queueSize int
+	}{
+		{
+			desc: "default",
+		},
+		{
+			desc:      "one",
+			n:         1,
+			queueSize: 1,
+		},
+		{
+			desc:      "many",
+			n:         8,
+			queueSize: 16,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			const numConns = 20
+
+			var (
+				out        = make(chan core.InputReader)
+				ctx        = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+				factory    = newStreamFactory(ctx, out, nil)
+				assemblers = newAssemblerShards(factory, c.n, c.queueSize)
+				stop       = make(chan struct{})
+				packets    []assemblerPacket
+			)
+
+			defer close(stop)
+
+			for n := 0; n < numConns; n++ {
+				port := uint16(1000 + n)
+				packets = append(packets,
+					newAssemblerPacket(newSeqPacket(t, fmt.Sprintf("req%d", port), port, 80, 100)),
+					newAssemblerPacket(newSeqPacket(t, fmt.Sprintf("res%d", port), 80, port, 500)),
+				)
+			}
+
+			assemblers.start(ctx, stop)
+
+			go func() {
+				for _, p := range packets {
+					assemblers.assemble(ctx, p)
+				}
+				assemblers.close()
+				factory.Close()
+			}()
+
+			var (
+				wg    sync.WaitGroup
+				mu    sync.Mutex
+				conns = make(map[string][]string)
+			)
+
+			for r := range out {
+				wg.Add(1)
+				go func(r core.InputReader) {
+					defer wg.Done()
+
+					b, err := ioutil.ReadAll(r)
+					assert.Check(t, err)
+
+					port, _ := r.Meta().GetString(MetaSrcPort)
+					if d, _ := r.Meta().Get(MetaDirection); d == DirectionDown {
+						port, _ = r.Meta().GetString(MetaDstPort)
+					}
+
+					mu.Lock()
+					conns[r.Meta().SourceID] = append(conns[r.Meta().SourceID], port+" "+string(b))
+					mu.Unlock()
+				}(r)
+			}
+
+			wg.Wait()
+
+			assert.Equal(t, numConns, len(conns))
+			for _, data := range conns {
+				assert.Equal(t, 2, len(data))
+
+				var port string
+				fmt.Sscan(data[0], &port)
+				assert.Assert(t, data[0] == port+" req"+port || data[0] == port+" res"+port)
+				assert.Assert(t, data[1] == port+" req"+port || data[1] == port+" res"+port)
+				assert.Assert(t, data[0] != data[1])
+			}
+		})
+	}
+}
+
+func TestAssemblerPacketHash(t *testing.T) {
+	var (
+		up    = newAssemblerPacket(newSeqPacket(t, "", 1111, 80, 0))
+		down  = newAssemblerPacket(newSeqPacket(t, "", 80, 1111, 0))
+		other = newAssemblerPacket(newSeqPacket(t, "", 2222, 80, 0))
+	)
+
+	assert.Equal(t, up.hash(), down.hash())
+	assert.Assert(t, up.hash() != other.hash())
+}
@@ -1,17 +1,108 @@
 package tcp
 
-import "github.com/segmentio/ksuid"
+import (
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"github.com/segmentio/ksuid"
+)
 
 func newConn(up *stream) *conn {
 	return &conn{
 		id: ksuid.New().String(),
 		up: up,
+		// Only an open and a close event are ever sent.
+		events: make(chan *Connection, 2),
 	}
 }
 
 type conn struct {
-	id       string
-	up       *stream
-	down     *stream
+	id   string
+	key  string
+	up   *stream
+	down *stream
+
+	mu       sync.Mutex
 	complete bool
+	start    time.Time
+	end      time.Time
+	bytes    [2]int64
+	reason   CloseReason
+	events   chan *Connection
+}
+
+// seen records a packet of the connection, sending
+// the open event when the first packet is seen.
+func (c *conn) seen(ts time.Time, tcp *layers.TCP) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	open := c.start.IsZero()
+	if open {
+		c.start = ts
+	}
+	if ts.After(c.end) {
+		c.end = ts
+	}
+
+	switch {
+	case tcp.RST:
+		c.reason = CloseRST
+	case tcp.FIN && c.reason == "":
+		c.reason = CloseFIN
+	}
+
+	if open {
+		c.events <- c.event(ConnectionOpen)
+	}
+}
+
+// addBytes counts reassembled bytes in a direction.
+func (c *conn) addBytes(d Direction, n int) {
+	c.mu.Lock()
+	c.bytes[d] += int64(n)
+	c.mu.Unlock()
+}
+
+// close completes the connection, sending the close event.
+func (c *conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.complete {
+		return
+	}
+	c.complete = true
+
+	if c.reason == "" {
+		c.reason = CloseTimeout
+	}
+
+	c.events <- c.event(ConnectionClose)
+	close(c.events)
+}
+
+// event creates a snapshot of the connection. The up
+// stream is always the client side of the connection.
+func (c *conn) event(e ConnectionEvent) *Connection {
+	conn := &Connection{
+		ConnectionID: c.id,
+		SessionID:    c.up.ctx.SessionID,
+		Event:        e,
+		ClientAddr:   c.up.net.Src().String(),
+		ClientPort:   c.up.transport.Src().String(),
+		ServerAddr:   c.up.net.Dst().String(),
+		ServerPort:   c.up.transport.Dst().String(),
+		Start:        c.start,
+		BytesUp:      c.bytes[DirectionUp],
+		BytesDown:    c.bytes[DirectionDown],
+	}
+
+	if e == ConnectionClose {
+		conn.End = c.end
+		conn.CloseReason = c.reason
+	}
+
+	return conn
 }
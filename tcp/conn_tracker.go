@@ -0,0 +1,123 @@
+package tcp
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// defaultConnShards is the number of shards used to track connections.
+const defaultConnShards = 64
+
+// connTracker tracks open connections. Connections are spread
+// across shards, each with its own lock, so that streams of
+// different connections rarely contend. Completed connections
+// are queued for removal so that pruning only visits the
+// connections that have expired.
+type connTracker struct {
+	shards []*connShard
+}
+
+type connShard struct {
+	mu      sync.Mutex
+	conns   map[string]*conn
+	expired []*conn
+}
+
+func newConnTracker(n int) *connTracker {
+	if n <= 0 {
+		n = defaultConnShards
+	}
+
+	t := &connTracker{
+		shards: make([]*connShard, n),
+	}
+	for i := range t.shards {
+		t.shards[i] = &connShard{
+			conns: make(map[string]*conn),
+		}
+	}
+
+	return t
+}
+
+func (t *connTracker) shard(key string) *connShard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return t.shards[h.Sum32()%uint32(len(t.shards))]
+}
+
+// track finds the connection of a stream. The first stream
+// of a connection creates it and is its up-stream. The
+// connection is keyed by the reverse of the first stream's
+// ID so that it is found by the second. Both streams of a
+// connection are created by the same assembler, one after
+// the other, so the lookup and insert need not be atomic.
+func (t *connTracker) track(s *stream) (*conn, Direction) {
+	id := &streamID{net: s.net, transport: s.transport}
+
+	if c := t.setDown(id.String(), s); c != nil {
+		return c, DirectionDown
+	}
+
+	c := newConn(s)
+	c.key = id.Reverse().String()
+
+	shard := t.shard(c.key)
+	shard.mu.Lock()
+	shard.conns[c.key] = c
+	shard.mu.Unlock()
+
+	return c, DirectionUp
+}
+
+// setDown sets the down-stream of the connection with
+// the given key, if there is one.
+func (t *connTracker) setDown(key string, s *stream) *conn {
+	shard := t.shard(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	c, ok := shard.conns[key]
+	if !ok {
+		return nil
+	}
+	c.down = s
+	return c
+}
+
+// expire queues a completed connection for removal.
+func (t *connTracker) expire(c *conn) {
+	shard := t.shard(c.key)
+	shard.mu.Lock()
+	shard.expired = append(shard.expired, c)
+	shard.mu.Unlock()
+}
+
+// prune removes expired connections, returning how many were removed.
+func (t *connTracker) prune() int {
+	var n int
+	for _, shard := range t.shards {
+		shard.mu.Lock()
+		for _, c := range shard.expired {
+			// The key may have been reused by a newer connection.
+			if shard.conns[c.key] == c {
+				delete(shard.conns, c.key)
+				n++
+			}
+		}
+		shard.expired = nil
+		shard.mu.Unlock()
+	}
+	return n
+}
+
+// len gets the number of tracked connections.
+func (t *connTracker) len() int {
+	var n int
+	for _, shard := range t.shards {
+		shard.mu.Lock()
+		n += len(shard.conns)
+		shard.mu.Unlock()
+	}
+	return n
+}
@@ -0,0 +1,191 @@
+package tcp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"gotest.tools/v3/assert"
+)
+
+func newTestStream(n int) *stream {
+	var (
+		src = layers.NewTCPPortEndpoint(layers.TCPPort(1024 + n%60000))
+		dst = layers.NewTCPPortEndpoint(80)
+		ip  = layers.NewIPEndpoint([]byte{10, byte(n >> 16), byte(n >> 8), byte(n)})
+	)
+	return &stream{
+		net:       gopacket.NewFlow(layers.EndpointIPv4, ip.Raw(), []byte{10, 0, 0, 1}),
+		transport: gopacket.NewFlow(layers.EndpointTCPPort, src.Raw(), dst.Raw()),
+	}
+}
+
+func reverseStream(s *stream) *stream {
+	return &stream{
+		net:       s.net.Reverse(),
+		transport: s.transport.Reverse(),
+	}
+}
+
+func TestConnTracker(t *testing.T) {
+	for _, shards := range []int{0, 1, 8} {
+		t.Run(fmt.Sprintf("%d shards", shards), func(t *testing.T) {
+			var (
+				tracker = newConnTracker(shards)
+				up1     = newTestStream(1)
+				up2     = newTestStream(2)
+			)
+
+			c1, d := tracker.track(up1)
+			assert.Equal(t, DirectionUp, d)
+			assert.Equal(t, up1, c1.up)
+
+			c2, d := tracker.track(up2)
+			assert.Equal(t, DirectionUp, d)
+			assert.Assert(t, c1 != c2)
+
+			down1 := reverseStream(up1)
+			c, d := tracker.track(down1)
+			assert.Equal(t, DirectionDown, d)
+			assert.Equal(t, c1, c)
+			assert.Equal(t, down1, c1.down)
+
+			assert.Equal(t, 2, tracker.len())
+			assert.Equal(t, 0, tracker.prune())
+
+			tracker.expire(c1)
+			assert.Equal(t, 1, tracker.prune())
+			assert.Equal(t, 1, tracker.len())
+
+			// A connection replaced by a newer one with
+			// the same key is not removed.
+			c3, _ := tracker.track(up2)
+			tracker.expire(c2)
+			assert.Equal(t, 0, tracker.prune())
+			assert.Equal(t, 1, tracker.len())
+
+			tracker.expire(c3)
+			assert.Equal(t, 1, tracker.prune())
+			assert.Equal(t, 0, tracker.len())
+		})
+	}
+}
+
+// mutexTracker is the previous connection tracking implementation,
+// a single map guarded by one lock that is fully scanned on prune.
+// It is kept as a baseline for benchmarks.
+type mutexTracker struct {
+	mu    sync.Mutex
+	conns map[string]*conn
+}
+
+func (t *mutexTracker) track(s *stream) (*conn, Direction) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var (
+		id = &streamID{net: s.net, transport: s.transport}
+		c  = t.conns[id.String()]
+	)
+
+	if c == nil {
+		c = newConn(s)
+		t.conns[id.Reverse().String()] = c
+		return c, DirectionUp
+	}
+
+	c.down = s
+	return c, DirectionDown
+}
+
+func (t *mutexTracker) expire(c *conn) {
+	c.mu.Lock()
+	c.complete = true
+	c.mu.Unlock()
+}
+
+func (t *mutexTracker) prune() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var n int
+	for id, c := range t.conns {
+		c.mu.Lock()
+		complete := c.complete
+		c.mu.Unlock()
+		if complete {
+			delete(t.conns, id)
+			n++
+		}
+	}
+	return n
+}
+
+type tracker interface {
+	track(*stream) (*conn, Direction)
+	expire(*conn)
+	prune() int
+}
+
+func benchmarkTrackers() map[string]func() tracker {
+	return map[string]func() tracker{
+		"mutex":   func() tracker { return &mutexTracker{conns: make(map[string]*conn)} },
+		"sharded": func() tracker { return newConnTracker(defaultConnShards) },
+	}
+}
+
+// BenchmarkConnTrackerTrack measures connection churn, with
+// streams of many connections being tracked concurrently.
+func BenchmarkConnTrackerTrack(b *testing.B) {
+	for name, newTracker := range benchmarkTrackers() {
+		b.Run(name, func(b *testing.B) {
+			var (
+				tracker = newTracker()
+				next    int64
+			)
+
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					up := newTestStream(int(atomic.AddInt64(&next, 1)))
+					c, _ := tracker.track(up)
+					tracker.track(reverseStream(up))
+					tracker.expire(c)
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkConnTrackerPrune measures pruning a small number of
+// expired connections among a large number of open ones.
+func BenchmarkConnTrackerPrune(b *testing.B) {
+	const (
+		open    = 100000
+		expired = 100
+	)
+
+	for name, newTracker := range benchmarkTrackers() {
+		b.Run(name, func(b *testing.B) {
+			tracker := newTracker()
+			for n := 0; n < open; n++ {
+				tracker.track(newTestStream(n))
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				for n := 0; n < expired; n++ {
+					c, _ := tracker.track(newTestStream(open + n))
+					tracker.expire(c)
+				}
+				b.StartTimer()
+
+				tracker.prune()
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package tcp
+
+import (
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/envelope"
+)
+
+// ConnectionEvent is a connection lifecycle event.
+type ConnectionEvent string
+
+const (
+	// ConnectionOpen is emitted when a connection is first seen.
+	ConnectionOpen ConnectionEvent = "open"
+	// ConnectionClose is emitted when a connection has ended.
+	ConnectionClose ConnectionEvent = "close"
+)
+
+// CloseReason is the reason a connection ended.
+type CloseReason string
+
+const (
+	// CloseFIN is a connection closed with a FIN.
+	CloseFIN CloseReason = "fin"
+	// CloseRST is a connection reset with a RST.
+	CloseRST CloseReason = "rst"
+	// CloseTimeout is a connection that was flushed
+	// without seeing a FIN or RST.
+	CloseTimeout CloseReason = "timeout"
+)
+
+// Connection is a snapshot of a TCP connection at
+// an event in its lifecycle.
+type Connection struct {
+	ConnectionID string          `json:"connection_id,omitempty"`
+	SessionID    string          `json:"session_id,omitempty"`
+	Event        ConnectionEvent `json:"event,omitempty"`
+	ClientAddr   string          `json:"client_addr,omitempty"`
+	ClientPort   string          `json:"client_port,omitempty"`
+	ServerAddr   string          `json:"server_addr,omitempty"`
+	ServerPort   string          `json:"server_port,omitempty"`
+	Start        time.Time       `json:"start,omitempty"`
+	End          time.Time       `json:"end,omitempty"`
+	BytesUp      int64           `json:"bytes_up"`
+	BytesDown    int64           `json:"bytes_down"`
+	CloseReason  CloseReason     `json:"close_reason,omitempty"`
+}
+
+// Kind gets an envelope kind for a Connection.
+func (c *Connection) Kind() envelope.Kind { return "tcp.connection" }
+
+// RegisterEnvelopes registers the envelope kinds of this package,
+// so that connection events can be decoded in any flow that reads
+// TCP streams or formats that emit them.
+func RegisterEnvelopes(ctx core.Context) {
+	ctx.Registry.Register(func() envelope.Kindify { return &Connection{} })
+}
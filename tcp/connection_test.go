@@ -0,0 +1,29 @@
+package tcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/envelope"
+	"gotest.tools/v3/assert"
+)
+
+func TestRegisterEnvelopes(t *testing.T) {
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+	RegisterEnvelopes(ctx)
+
+	var (
+		c = &Connection{ConnectionID: "111", Event: ConnectionClose, CloseReason: CloseFIN}
+		e = envelope.New(c)
+	)
+
+	b, err := json.Marshal(&e)
+	assert.NilError(t, err)
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	c2, err := ctx.Registry.DecodeJSON(dec)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, c, c2)
+}
@@ -0,0 +1,91 @@
+package tcp
+
+import "sync"
+
+// Gap is a range of bytes that was lost or skipped during
+// reassembly. Offset is the position in the reassembled
+// stream at which the missing bytes would have been.
+type Gap struct {
+	Offset int64 `json:"offset"`
+	Length int   `json:"length"`
+}
+
+// Gaps records the gaps in a reassembled stream, so that
+// consumers can tell whether data they read is complete.
+// Like the timeline, gaps are only kept for timelineHistory
+// bytes behind the read position of the stream.
+type Gaps struct {
+	mu   sync.Mutex
+	gaps []Gap
+
+	// last is the last gap that was discarded. It is kept so
+	// that a range that started before the history still
+	// reports a gap, however long ago the gap was.
+	last *Gap
+}
+
+// NewGaps creates a new set of gaps.
+func NewGaps() *Gaps {
+	return &Gaps{}
+}
+
+// Add records that n bytes are missing at offset.
+func (g *Gaps) Add(offset int64, n int) {
+	if n <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	g.gaps = append(g.gaps, Gap{Offset: offset, Length: n})
+	g.mu.Unlock()
+}
+
+// Between gets the gaps at offsets in [start, end). A gap at
+// end is excluded since the bytes before it are complete.
+func (g *Gaps) Between(start, end int64) []Gap {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var gaps []Gap
+	if g.last != nil && g.last.Offset >= start && g.last.Offset < end {
+		gaps = append(gaps, *g.last)
+	}
+	for _, gap := range g.gaps {
+		if gap.Offset >= start && gap.Offset < end {
+			gaps = append(gaps, gap)
+		}
+	}
+
+	return gaps
+}
+
+// Consume records that the stream has been read up to offset.
+// Gaps more than timelineHistory behind it are discarded.
+func (g *Gaps) Consume(offset int64) {
+	cutoff := offset - timelineHistory
+	if cutoff <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	i := 0
+	for i < len(g.gaps) && g.gaps[i].Offset < cutoff {
+		i++
+	}
+
+	if i > 0 {
+		last := g.gaps[i-1]
+		g.last = &last
+		g.gaps = g.gaps[i:]
+	}
+}
+
+// All gets the gaps that have not been discarded.
+func (g *Gaps) All() []Gap {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([]Gap(nil), g.gaps...)
+}
@@ -0,0 +1,81 @@
+package tcp
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGaps(t *testing.T) {
+	gaps := NewGaps()
+	gaps.Add(10, 5)
+	gaps.Add(20, 0)
+	gaps.Add(30, 1)
+
+	cases := []struct {
+		desc  string
+		start int64
+		end   int64
+		gaps  []Gap
+	}{
+		{
+			desc:  "before",
+			start: 0,
+			end:   10,
+		},
+		{
+			desc:  "at start",
+			start: 10,
+			end:   15,
+			gaps:  []Gap{{Offset: 10, Length: 5}},
+		},
+		{
+			desc:  "within",
+			start: 5,
+			end:   15,
+			gaps:  []Gap{{Offset: 10, Length: 5}},
+		},
+		{
+			desc:  "all",
+			start: 0,
+			end:   100,
+			gaps: []Gap{
+				{Offset: 10, Length: 5},
+				{Offset: 30, Length: 1},
+			},
+		},
+		{
+			desc:  "after",
+			start: 31,
+			end:   100,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			assert.DeepEqual(t, c.gaps, gaps.Between(c.start, c.end))
+		})
+	}
+
+	assert.Equal(t, 2, len(gaps.All()))
+}
+
+func TestGapsConsume(t *testing.T) {
+	gaps := NewGaps()
+	gaps.Add(10, 5)
+	gaps.Add(20, 1)
+	gaps.Add(timelineHistory+10, 1)
+
+	// Nothing is discarded within the history.
+	gaps.Consume(timelineHistory + 10)
+	assert.Equal(t, 3, len(gaps.All()))
+
+	gaps.Consume(timelineHistory + 100)
+	assert.DeepEqual(t, []Gap{{Offset: timelineHistory + 10, Length: 1}}, gaps.All())
+
+	// The last discarded gap is still found.
+	assert.DeepEqual(t, []Gap{
+		{Offset: 20, Length: 1},
+		{Offset: timelineHistory + 10, Length: 1},
+	}, gaps.Between(15, timelineHistory+100))
+	assert.Equal(t, 0, len(gaps.Between(21, timelineHistory)))
+}
@@ -0,0 +1,144 @@
+package tcp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/segmentio/ksuid"
+)
+
+// NewListenSource creates a new TCP listener source, the
+// counterpart to the TCP sink. Each connection accepted on the
+// flow address is emitted as a stream, so that the output of
+// other vhs instances can be collected.
+func NewListenSource(ctx core.Context) (core.Source, error) {
+	if _, _, err := net.SplitHostPort(ctx.FlowConfig.Addr); err != nil {
+		return nil, fmt.Errorf("invalid address: %w", err)
+	}
+
+	// Other instances may send connection events.
+	RegisterEnvelopes(ctx)
+
+	return &listenSource{
+		streams: make(chan core.InputReader),
+		listen:  net.Listen,
+	}, nil
+}
+
+type listenSource struct {
+	streams chan core.InputReader
+	listen  func(network, address string) (net.Listener, error)
+}
+
+func (s *listenSource) Streams() <-chan core.InputReader {
+	return s.streams
+}
+
+func (s *listenSource) Init(ctx core.Context) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "tcp_listen_source").
+		Logger()
+
+	ctx.Logger.Debug().Msg("init")
+
+	l, err := s.listen("tcp", ctx.FlowConfig.Addr)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to listen: %w", err)
+		return
+	}
+
+	Serve(ctx, l, func(conn net.Conn, stop <-chan struct{}) {
+		r := newConnReader(conn, l.Addr(), stop)
+
+		ctx.Logger.Debug().
+			Str("peer", conn.RemoteAddr().String()).
+			Str("source_id", r.meta.SourceID).
+			Msg("accepted connection")
+
+		select {
+		case s.streams <- r:
+		case <-stop:
+			conn.Close()
+			return
+		}
+
+		go r.closeOnStop()
+	})
+
+	close(s.streams)
+
+	ctx.Logger.Debug().Msg("tcp listen source complete")
+}
+
+// connReader is a connection accepted by the listener source.
+type connReader struct {
+	conn net.Conn
+	meta *core.Meta
+
+	// stop is closed when the source stops, after
+	// which the connection is closed and reads end.
+	stop      <-chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newConnReader(conn net.Conn, listenAddr net.Addr, stop <-chan struct{}) *connReader {
+	var (
+		srcAddr, srcPort = SplitAddr(conn.RemoteAddr())
+		dstAddr, dstPort = SplitAddr(conn.LocalAddr())
+		_, listenPort    = SplitAddr(listenAddr)
+	)
+
+	return &connReader{
+		conn: conn,
+		meta: core.NewMeta(ksuid.New().String(), map[string]interface{}{
+			MetaSrcAddr:    srcAddr,
+			MetaSrcPort:    srcPort,
+			MetaDstAddr:    dstAddr,
+			MetaDstPort:    dstPort,
+			MetaListenPort: listenPort,
+		}),
+		stop:   stop,
+		closed: make(chan struct{}),
+	}
+}
+
+// closeOnStop closes the connection when the source
+// stops, unless the reader has been closed already.
+func (r *connReader) closeOnStop() {
+	select {
+	case <-r.stop:
+		r.Close()
+	case <-r.closed:
+	}
+}
+
+// Read reads from the connection. Reads that fail because
+// the source stopped end the stream rather than fail it.
+func (r *connReader) Read(p []byte) (int, error) {
+	n, err := r.conn.Read(p)
+	if err != nil && err != io.EOF {
+		select {
+		case <-r.stop:
+			return n, io.EOF
+		default:
+		}
+	}
+	return n, err
+}
+
+func (r *connReader) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		err = r.conn.Close()
+	})
+	return err
+}
+
+func (r *connReader) Meta() *core.Meta {
+	return r.meta
+}
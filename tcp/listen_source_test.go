@@ -0,0 +1,147 @@
+package tcp
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/rename-this/vhs/core"
+)
+
+func TestNewListenSource(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addr        string
+		errContains string
+	}{
+		{
+			desc: "success",
+			addr: "127.0.0.1:0",
+		},
+		{
+			desc:        "invalid address",
+			addr:        "127.0.0.1",
+			errContains: "invalid address",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{Addr: c.addr}, nil)
+			_, err := NewListenSource(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func newTestListenSource(t *testing.T) (core.Context, *listenSource, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{
+		Addr:           l.Addr().String(),
+		AddrSink:       l.Addr().String(),
+		SourceDuration: time.Minute,
+	}, make(chan error, 1))
+
+	source, err := NewListenSource(ctx)
+	assert.NilError(t, err)
+
+	s := source.(*listenSource)
+	s.listen = func(string, string) (net.Listener, error) {
+		return l, nil
+	}
+
+	return ctx, s, l
+}
+
+func TestListenSource(t *testing.T) {
+	ctx, s, l := newTestListenSource(t)
+
+	go s.Init(ctx)
+
+	data := map[string]string{}
+
+	for _, msg := range []string{"one", "two"} {
+		sink, err := NewSink(ctx)
+		assert.NilError(t, err)
+
+		_, err = sink.Write([]byte(msg))
+		assert.NilError(t, err)
+		assert.NilError(t, sink.Close())
+
+		r := <-s.Streams()
+
+		b, err := ioutil.ReadAll(r)
+		assert.NilError(t, err)
+		assert.NilError(t, r.Close())
+
+		var (
+			sinkPort      = strconv.Itoa(sink.(net.Conn).LocalAddr().(*net.TCPAddr).Port)
+			port          = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+			srcAddr, _    = r.Meta().GetString(MetaSrcAddr)
+			srcPort, _    = r.Meta().GetString(MetaSrcPort)
+			dstPort, _    = r.Meta().GetString(MetaDstPort)
+			listenPort, _ = r.Meta().GetString(MetaListenPort)
+		)
+
+		assert.Equal(t, "127.0.0.1", srcAddr)
+		assert.Equal(t, sinkPort, srcPort)
+		assert.Equal(t, port, dstPort)
+		assert.Equal(t, port, listenPort)
+
+		data[r.Meta().SourceID] = string(b)
+	}
+
+	assert.Equal(t, 2, len(data))
+	for _, msg := range data {
+		assert.Assert(t, msg == "one" || msg == "two")
+	}
+
+	ctx.Cancel()
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+	assert.Equal(t, 0, len(ctx.Errors))
+}
+
+func TestListenSourceCancel(t *testing.T) {
+	ctx, s, _ := newTestListenSource(t)
+
+	go s.Init(ctx)
+
+	sink, err := NewSink(ctx)
+	assert.NilError(t, err)
+	defer sink.Close()
+
+	_, err = sink.Write([]byte("partial"))
+	assert.NilError(t, err)
+
+	r := <-s.Streams()
+
+	b := make([]byte, 7)
+	_, err = io.ReadFull(r, b)
+	assert.NilError(t, err)
+	assert.Equal(t, "partial", string(b))
+
+	ctx.Cancel()
+
+	// Open connections are closed when the source
+	// stops, ending their streams without an error.
+	rest, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(rest))
+	assert.NilError(t, r.Close())
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+	assert.Equal(t, 0, len(ctx.Errors))
+}
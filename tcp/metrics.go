@@ -0,0 +1,38 @@
+package tcp
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// queueDepthInterval is how often assembler queue depths are sampled.
+const queueDepthInterval = time.Second
+
+// defaultMetrics are registered with the default Prometheus
+// registry. They are only updated when metrics are enabled.
+var defaultMetrics = newAssemblerMetrics(prometheus.DefaultRegisterer)
+
+// assemblerMetrics are the Prometheus metrics for assemblers.
+type assemblerMetrics struct {
+	QueueDepth *prometheus.GaugeVec
+}
+
+func newAssemblerMetrics(r prometheus.Registerer) *assemblerMetrics {
+	return &assemblerMetrics{
+		QueueDepth: promauto.With(r).NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "vhs",
+			Subsystem: "tcp",
+			Name:      "assembler_queue_depth",
+			Help:      "Number of packets queued for each TCP assembler.",
+		}, []string{"shard"}),
+	}
+}
+
+func (m *assemblerMetrics) setQueueDepths(depths []int) {
+	for i, d := range depths {
+		m.QueueDepth.With(prometheus.Labels{"shard": strconv.Itoa(i)}).Set(float64(d))
+	}
+}
@@ -0,0 +1,124 @@
+package tcp
+
+import (
+	"github.com/google/gopacket/reassembly"
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/chanreader"
+	"github.com/rename-this/vhs/tlsx"
+)
+
+func newReader(ctx core.Context, s *stream, meta *core.Meta, timeline *Timeline, gaps *Gaps) *reader {
+	return &reader{
+		ctx:      ctx,
+		s:        s,
+		meta:     meta,
+		timeline: timeline,
+		gaps:     gaps,
+		data:     chanreader.New(0),
+	}
+}
+
+// reader is one direction of a reassembled TCP connection.
+type reader struct {
+	ctx      core.Context
+	s        *stream
+	meta     *core.Meta
+	timeline *Timeline
+	gaps     *Gaps
+
+	// written is only accessed by the assembler.
+	written int64
+
+	// tls decrypts the reassembled bytes of the side of the
+	// connection. It is only accessed by the assembler.
+	tls  *tlsx.Conn
+	side tlsx.Side
+
+	data *chanreader.Reader
+
+	// read is only accessed by the consumer.
+	read int64
+}
+
+// reassembled hands reassembled bytes to the consumer, blocking
+// until they are taken or the reader is closed. It returns
+// the number of bytes reassembled.
+func (r *reader) reassembled(sg reassembly.ScatterGather) int {
+	var (
+		length, _     = sg.Lengths()
+		_, _, _, skip = sg.Info()
+	)
+
+	// The timeline and gaps must be updated before the
+	// reassembled bytes are handed to the consumer since
+	// they may be read as soon as they are available.
+	if skip > 0 {
+		r.gaps.Add(r.written, skip)
+		r.ctx.Logger.Debug().
+			Int64("offset", r.written).
+			Int("skip", skip).
+			Msg("bytes skipped")
+
+		if r.tls != nil {
+			r.tls.Skip(r.side)
+		}
+	}
+
+	if length == 0 {
+		return 0
+	}
+
+	b := make([]byte, length)
+	copy(b, sg.Fetch(length))
+
+	if r.tls != nil {
+		var err error
+		if b, err = r.tls.Decrypt(r.side, b); err != nil {
+			r.ctx.Logger.Debug().Err(err).Msg("failed to decrypt")
+		}
+		if len(b) == 0 {
+			return length
+		}
+	}
+
+	// Decrypted bytes are stamped with the capture time of
+	// the segment that completed their record.
+	r.timeline.Add(len(b), sg.CaptureInfo(0).Timestamp)
+	r.written += int64(len(b))
+
+	if r.ctx.Config.DebugPackets {
+		r.ctx.Logger.Debug().Int("length", len(b)).Bytes("data", b).Msg("reassembled")
+	} else {
+		r.ctx.Logger.Debug().Msg("reassembled")
+	}
+
+	r.data.Send(b)
+
+	return length
+}
+
+// complete signals that there is no more data.
+func (r *reader) complete() {
+	r.data.Complete()
+	r.ctx.Logger.Debug().Msg("reassembly complete")
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.data.Read(p)
+
+	r.read += int64(n)
+	r.timeline.Consume(r.read)
+	r.gaps.Consume(r.read)
+
+	return n, err
+}
+
+// Close closes the reader. Any data that has not
+// been read yet is discarded.
+func (r *reader) Close() error {
+	return r.data.Close()
+}
+
+func (r *reader) Meta() *core.Meta {
+	return r.meta
+}
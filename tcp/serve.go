@@ -0,0 +1,54 @@
+package tcp
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/rename-this/vhs/core"
+)
+
+// Serve accepts connections on l until the source duration
+// elapses or the context is canceled, at which point l is
+// closed. Each connection is passed to handle along with a
+// channel that is closed when serving stops.
+func Serve(ctx core.Context, l net.Listener, handle func(conn net.Conn, stop <-chan struct{})) {
+	stop := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.FlowConfig.SourceDurationElapsed():
+			ctx.Logger.Debug().Msg("source duration elapsed")
+		case <-ctx.StdContext.Done():
+		}
+		close(stop)
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				ctx.Logger.Debug().Err(err).Msg("temporary accept error")
+				continue
+			}
+			select {
+			case <-stop:
+			default:
+				ctx.Errors <- fmt.Errorf("failed to accept connection: %w", err)
+			}
+			return
+		}
+
+		handle(conn, stop)
+	}
+}
+
+// SplitAddr splits addr into its host and port. If addr
+// has no port, the whole address is returned as the host.
+func SplitAddr(addr net.Addr) (string, string) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String(), ""
+	}
+	return host, port
+}
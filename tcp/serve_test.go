@@ -0,0 +1,42 @@
+package tcp
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSplitAddr(t *testing.T) {
+	cases := []struct {
+		desc string
+		addr net.Addr
+		host string
+		port string
+	}{
+		{
+			desc: "tcp",
+			addr: &net.TCPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 80},
+			host: "1.2.3.4",
+			port: "80",
+		},
+		{
+			desc: "ipv6",
+			addr: &net.TCPAddr{IP: net.IPv6loopback, Port: 443},
+			host: "::1",
+			port: "443",
+		},
+		{
+			desc: "no port",
+			addr: &net.UnixAddr{Name: "/tmp/vhs.sock", Net: "unix"},
+			host: "/tmp/vhs.sock",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			host, port := SplitAddr(c.addr)
+			assert.Equal(t, host, c.host)
+			assert.Equal(t, port, c.port)
+		})
+	}
+}
@@ -4,21 +4,67 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/tcpassembly"
 	"github.com/rename-this/vhs/capture"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tlsx"
 )
 
 // NewSource creates a new TCP source.
-func NewSource(_ core.Context) (core.Source, error) {
+func NewSource(ctx core.Context) (core.Source, error) {
+	if err := capture.ValidateFlowConfig(ctx.FlowConfig); err != nil {
+		return nil, err
+	}
+
+	keys, err := loadKeyLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tcpSource{
+		streams:     make(chan core.InputReader),
+		newListener: capture.NewLiveListener,
+		keys:        keys,
+	}, nil
+}
+
+// NewPcapSource creates a new source that reassembles
+// TCP streams from a pcap or pcapng file.
+func NewPcapSource(ctx core.Context) (core.Source, error) {
+	keys, err := loadKeyLog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	return &tcpSource{
-		streams: make(chan core.InputReader),
+		streams:     make(chan core.InputReader),
+		newListener: newOfflineListener,
+		keys:        keys,
 	}, nil
 }
 
+// loadKeyLog loads the TLS key log, if one is configured.
+func loadKeyLog(ctx core.Context) (*tlsx.KeyLog, error) {
+	if ctx.FlowConfig.TLSKeyLogFile == "" {
+		return nil, nil
+	}
+
+	keys, err := tlsx.LoadKeyLog(ctx.FlowConfig.TLSKeyLogFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key log: %w", err)
+	}
+
+	return keys, nil
+}
+
 type tcpSource struct {
-	streams chan core.InputReader
+	streams     chan core.InputReader
+	newListener newListenerFn
+
+	// keys decrypt TLS connections. If nil, streams
+	// are not decrypted.
+	keys *tlsx.KeyLog
 }
 
 func (s *tcpSource) Streams() <-chan core.InputReader {
@@ -26,47 +72,79 @@ func (s *tcpSource) Streams() <-chan core.InputReader {
 }
 
 func (s *tcpSource) Init(ctx core.Context) {
-	s.read(ctx, capture.NewCapture, capture.NewListener)
+	s.read(ctx, s.newListener)
 }
 
-type (
-	newCaptureFn  func(addr string, response bool) (*capture.Capture, error)
-	newListenerFn func(*capture.Capture) capture.Listener
-)
+type newListenerFn func(core.Context) (capture.Listener, error)
+
+func newOfflineListener(ctx core.Context) (capture.Listener, error) {
+	return capture.NewOfflineListener(ctx.FlowConfig.InputFile), nil
+}
 
-func (s *tcpSource) read(ctx core.Context, newCapture newCaptureFn, newListener newListenerFn) {
+func (s *tcpSource) read(ctx core.Context, newListener newListenerFn) {
 	ctx.Logger = ctx.Logger.With().
 		Str(core.LoggerKeyComponent, "tcp_source").
 		Logger()
 
 	ctx.Logger.Debug().Msg("read")
 
-	cap, err := newCapture(ctx.FlowConfig.Addr, ctx.FlowConfig.CaptureResponse)
+	addrs, err := capture.ParseAddrs(ctx.FlowConfig.Addr)
 	if err != nil {
-		ctx.Errors <- fmt.Errorf("failed to initialize capture: %w", err)
+		ctx.Errors <- fmt.Errorf("failed to parse addresses: %w", err)
+		close(s.streams)
 		return
 	}
 
-	ctx.Logger.Debug().Interface("cap", cap).Msg("capture created")
+	listenPorts := make([]capture.PortRange, 0, len(addrs))
+	for _, a := range addrs {
+		listenPorts = append(listenPorts, a.Ports)
+	}
 
-	listener := newListener(cap)
+	listener, err := newListener(ctx)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to initialize capture: %w", err)
+		close(s.streams)
+		return
+	}
 
 	defer listener.Close()
 
 	go listener.Listen(ctx)
 
 	var (
-		factory   = newStreamFactory(ctx, s.streams)
-		pool      = tcpassembly.NewStreamPool(factory)
-		assembler = tcpassembly.NewAssembler(pool)
-		ticker    = time.Tick(ctx.FlowConfig.TCPTimeout)
-		complete  = time.After(ctx.FlowConfig.SourceDuration)
-		packets   = listener.Packets()
+		clock      capture.Clock
+		factory    = newStreamFactory(ctx, s.streams, listenPorts)
+		assemblers = newAssemblerShards(factory, ctx.FlowConfig.TCPAssemblers, ctx.FlowConfig.TCPAssemblerQueueSize)
+		stop       = make(chan struct{})
+		ticker     = time.Tick(ctx.FlowConfig.TCPTimeout)
+		complete   = ctx.FlowConfig.SourceDurationElapsed()
+		packets    = listener.Packets()
+	)
+
+	factory.keys = s.keys
+
+	assemblers.start(ctx, stop)
+	defer close(stop)
+
+	// Queue depths are only sampled when metrics are enabled.
+	var (
+		metrics         *assemblerMetrics
+		queueDepthTicks <-chan time.Time
 	)
+	if ctx.Config.PrometheusAddr != "" {
+		metrics = defaultMetrics
+		queueDepthTicks = time.Tick(queueDepthInterval)
+	}
 
 	for {
 		select {
-		case packet := <-packets:
+		case packet, more := <-packets:
+			if !more {
+				ctx.Logger.Debug().Msg("no more packets")
+				assemblers.close()
+				factory.Close()
+				return
+			}
 			if packet == nil {
 				if ctx.Config.DebugPackets {
 					ctx.Logger.Debug().Msg("nil packet")
@@ -86,17 +164,32 @@ func (s *tcpSource) read(ctx core.Context, newCapture newCaptureFn, newListener
 			var (
 				tcp  = packet.TransportLayer().(*layers.TCP)
 				flow = packet.NetworkLayer().NetworkFlow()
+				ci   = packet.Metadata().CaptureInfo
 			)
 
-			assembler.AssembleWithTimestamp(flow, tcp, time.Now())
+			ci.Timestamp = clock.Observe(ci.Timestamp)
+
+			if !assemblers.assemble(ctx, assemblerPacket{
+				flow: flow,
+				tcp:  tcp,
+				ac:   assemblerContext(ci),
+			}) {
+				return
+			}
 
 		case <-ticker:
 			ctx.Logger.Debug().Msg("flushing old streams")
-			assembler.FlushOlderThan(time.Now().Add(-ctx.FlowConfig.TCPTimeout))
+			assemblers.flushCloseOlderThan(clock.Now().Add(-ctx.FlowConfig.TCPTimeout))
 
 			factory.prune()
 
+		case <-queueDepthTicks:
+			metrics.setQueueDepths(assemblers.queueDepths())
+
 		case <-complete:
+			// The assemblers must stop before the factory is
+			// closed since they may be creating streams.
+			assemblers.close()
 			factory.Close()
 			return
 
@@ -105,3 +198,11 @@ func (s *tcpSource) read(ctx core.Context, newCapture newCaptureFn, newListener
 		}
 	}
 }
+
+// assemblerContext passes the capture info
+// of a packet to the assembler.
+type assemblerContext gopacket.CaptureInfo
+
+func (ac *assemblerContext) GetCaptureInfo() gopacket.CaptureInfo {
+	return gopacket.CaptureInfo(*ac)
+}
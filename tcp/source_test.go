@@ -4,6 +4,7 @@ import (
 	"io/ioutil"
 	"net"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,6 +12,7 @@ import (
 	"github.com/google/gopacket/layers"
 	"github.com/rename-this/vhs/capture"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tlsx"
 	"gotest.tools/v3/assert"
 )
 
@@ -20,16 +22,24 @@ const (
 )
 
 func newPacket(t *testing.T, data string, srcPort, dstPort uint16) gopacket.Packet {
+	return newSeqPacket(t, data, srcPort, dstPort, 0)
+}
+
+func newSeqPacket(t *testing.T, data string, srcPort, dstPort uint16, seq uint32) gopacket.Packet {
+	return newTCPPacket(t, data, layers.TCP{
+		SrcPort: layers.TCPPort(srcPort),
+		DstPort: layers.TCPPort(dstPort),
+		Seq:     seq,
+	})
+}
+
+func newTCPPacket(t *testing.T, data string, tcpLayer layers.TCP) gopacket.Packet {
 	var (
 		ipLayer = layers.IPv4{
 			SrcIP:    net.ParseIP("0.0.0.0"),
 			DstIP:    net.ParseIP("0.0.0.0"),
 			Protocol: layers.IPProtocolTCP,
 		}
-		tcpLayer = layers.TCP{
-			SrcPort: layers.TCPPort(srcPort),
-			DstPort: layers.TCPPort(dstPort),
-		}
 		opts = gopacket.SerializeOptions{
 			FixLengths: true,
 		}
@@ -88,16 +98,18 @@ func TestRead(t *testing.T) {
 		DebugPackets: true,
 	}
 	flowCfg := &core.FlowConfig{
+		Addr:           "0.0.0.0:22000-23000",
 		SourceDuration: 800 * time.Millisecond,
 		TCPTimeout:     50 * time.Millisecond,
 	}
 	cases := []struct {
-		desc     string
-		cfg      *core.Config
-		flowCfg  *core.FlowConfig
-		listener capture.Listener
-		data     []string
-		out      []string
+		desc       string
+		cfg        *core.Config
+		flowCfg    *core.FlowConfig
+		listener   capture.Listener
+		data       []string
+		out        []string
+		listenPort string
 	}{
 		{
 			desc:    "nil",
@@ -125,6 +137,7 @@ func TestRead(t *testing.T) {
 			out: []string{
 				"aaa",
 			},
+			listenPort: "22222",
 		},
 	}
 	for _, c := range cases {
@@ -141,10 +154,8 @@ func TestRead(t *testing.T) {
 			s, ok := source.(*tcpSource)
 			assert.Assert(t, ok)
 
-			go s.read(ctx, func(string, bool) (*capture.Capture, error) {
-				return nil, nil
-			}, func(*capture.Capture) capture.Listener {
-				return newTestListener(t, c.data)
+			go s.read(ctx, func(core.Context) (capture.Listener, error) {
+				return newTestListener(t, c.data), nil
 			})
 
 			if len(c.out) == 0 {
@@ -158,6 +169,9 @@ func TestRead(t *testing.T) {
 
 			assert.Assert(t, r.Meta().SourceID != "")
 
+			listenPort, _ := r.Meta().GetString(MetaListenPort)
+			assert.Equal(t, c.listenPort, listenPort)
+
 			b, err := ioutil.ReadAll(r)
 			assert.NilError(t, err)
 
@@ -173,3 +187,264 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+func TestNewSource(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addr        string
+		filter      string
+		errContains string
+	}{
+		{
+			desc: "no filter",
+		},
+		{
+			desc:   "valid filter",
+			filter: "not host 1.1.1.1",
+		},
+		{
+			desc:        "invalid addr",
+			addr:        "0.0.0.0:80,0.0.0.0:http",
+			errContains: "invalid port: http",
+		},
+		{
+			desc:        "invalid filter",
+			filter:      "tcp port",
+			errContains: "invalid capture filter",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{Addr: c.addr, CaptureFilter: c.filter}, nil)
+			_, err := NewSource(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}
+
+func TestPcapSource(t *testing.T) {
+	cases := []struct {
+		desc        string
+		file        string
+		assemblers  int
+		streams     int
+		bytes       int
+		errContains string
+	}{
+		{
+			desc:    "success",
+			file:    "../testdata/200722_tcp_anon.pcapng",
+			streams: 4,
+			bytes:   9531,
+		},
+		{
+			desc:       "sharded",
+			file:       "../testdata/200722_tcp_anon.pcapng",
+			assemblers: 4,
+			streams:    4,
+			bytes:      9531,
+		},
+		{
+			desc:        "no file",
+			file:        "/no/such/file",
+			errContains: "no such file or directory",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs    = make(chan error, 1)
+				flowCfg = &core.FlowConfig{
+					InputFile:      c.file,
+					SourceDuration: time.Minute,
+					TCPTimeout:     time.Minute,
+					TCPAssemblers:  c.assemblers,
+				}
+				ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+			)
+
+			s, err := NewPcapSource(ctx)
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				streams int
+				total   int
+			)
+
+			for r := range s.Streams() {
+				streams++
+				wg.Add(1)
+				go func(r core.InputReader) {
+					defer wg.Done()
+					b, err := ioutil.ReadAll(r)
+					assert.NilError(t, err)
+					mu.Lock()
+					total += len(b)
+					mu.Unlock()
+				}(r)
+			}
+
+			wg.Wait()
+
+			if c.errContains != "" {
+				assert.Equal(t, 1, len(errs))
+				assert.ErrorContains(t, <-errs, c.errContains)
+				return
+			}
+
+			assert.Equal(t, 0, len(errs))
+			assert.Equal(t, c.streams, streams)
+			assert.Equal(t, c.bytes, total)
+		})
+	}
+}
+
+func TestPcapSourceListenPort(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addr        string
+		listenPort  string
+		errContains string
+	}{
+		{
+			desc:       "captured port",
+			addr:       "0.0.0.0:2000",
+			listenPort: "2000",
+		},
+		{
+			desc: "default address",
+			addr: capture.DefaultAddr,
+		},
+		{
+			desc:        "bad address",
+			addr:        "bad/address:2000",
+			errContains: "failed to parse addresses",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs    = make(chan error, 1)
+				flowCfg = &core.FlowConfig{
+					Addr:           c.addr,
+					InputFile:      "../testdata/200722_tcp_anon.pcapng",
+					SourceDuration: time.Minute,
+					TCPTimeout:     time.Minute,
+				}
+				ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+			)
+
+			s, err := NewPcapSource(ctx)
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+
+			var streams int
+			for r := range s.Streams() {
+				streams++
+				port, _ := r.Meta().GetString(MetaListenPort)
+				assert.Equal(t, c.listenPort, port)
+				go ioutil.ReadAll(r)
+			}
+
+			if c.errContains != "" {
+				assert.Equal(t, 1, len(errs))
+				assert.ErrorContains(t, <-errs, c.errContains)
+				return
+			}
+
+			assert.Equal(t, 0, len(errs))
+			assert.Equal(t, 4, streams)
+		})
+	}
+}
+
+func TestPcapSourceTLS(t *testing.T) {
+	cases := []struct {
+		desc    string
+		file    string
+		keyLog  string
+		version string
+	}{
+		{
+			desc:    "tls 1.2",
+			file:    "../testdata/tls12.pcapng",
+			keyLog:  "../testdata/tls12.keylog",
+			version: "TLS 1.2",
+		},
+		{
+			desc:    "tls 1.3",
+			file:    "../testdata/tls13.pcapng",
+			keyLog:  "../testdata/tls13.keylog",
+			version: "TLS 1.3",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs    = make(chan error, 1)
+				flowCfg = &core.FlowConfig{
+					InputFile:      c.file,
+					TLSKeyLogFile:  c.keyLog,
+					SourceDuration: time.Minute,
+					TCPTimeout:     time.Minute,
+				}
+				ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+			)
+
+			s, err := NewPcapSource(ctx)
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				data = make(map[Direction]string)
+				rs   []core.InputReader
+			)
+
+			for r := range s.Streams() {
+				rs = append(rs, r)
+				wg.Add(1)
+				go func(r core.InputReader) {
+					defer wg.Done()
+					b, err := ioutil.ReadAll(r)
+					assert.NilError(t, err)
+					d, _ := r.Meta().Get(MetaDirection)
+					mu.Lock()
+					data[d.(Direction)] = string(b)
+					mu.Unlock()
+				}(r)
+			}
+
+			wg.Wait()
+
+			assert.Equal(t, 0, len(errs))
+			assert.Equal(t, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", data[DirectionUp])
+			assert.Equal(t, "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello", data[DirectionDown])
+
+			assert.Equal(t, 2, len(rs))
+			for _, r := range rs {
+				serverName, _ := r.Meta().GetString(tlsx.MetaServerName)
+				assert.Equal(t, "example.com", serverName)
+				version, _ := r.Meta().GetString(tlsx.MetaVersion)
+				assert.Equal(t, c.version, version)
+			}
+		})
+	}
+}
+
+func TestPcapSourceTLSKeyLog(t *testing.T) {
+	ctx := core.NewContext(&core.Config{}, &core.FlowConfig{TLSKeyLogFile: "/no/such/file"}, nil)
+	_, err := NewPcapSource(ctx)
+	assert.ErrorContains(t, err, "failed to load TLS key log")
+}
@@ -1,13 +1,17 @@
 package tcp
 
 import (
+	"crypto/tls"
+	"strconv"
 	"sync"
 
 	"github.com/google/gopacket"
-	"github.com/google/gopacket/tcpassembly"
-	"github.com/google/gopacket/tcpassembly/tcpreader"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
 
+	"github.com/rename-this/vhs/capture"
 	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tlsx"
 )
 
 // Direction is an enum indicating the direction
@@ -32,73 +36,210 @@ const (
 	MetaSrcPort = "tcp.srcport"
 	// MetaDstPort is the port of the destination.
 	MetaDstPort = "tcp.dstport"
+	// MetaListenPort is the captured port that matched the stream.
+	MetaListenPort = "tcp.listenport"
+	// MetaTimeline is the *Timeline of the stream, which records
+	// when each byte of the stream was captured.
+	MetaTimeline = "tcp.timeline"
+	// MetaEgress is true if the client of the connection is the
+	// local host, i.e. the stream is an outbound call captured
+	// in egress mode. Otherwise the client is the remote host.
+	MetaEgress = "tcp.egress"
+	// MetaGaps is the *Gaps of the stream, which records
+	// bytes that were lost or skipped during reassembly.
+	MetaGaps = "tcp.gaps"
+	// MetaConnectionEvents is a <-chan *Connection of the lifecycle
+	// events of the stream's connection. It is only set on the
+	// up-stream so that each connection's events are seen once.
+	MetaConnectionEvents = "tcp.connectionevents"
 )
 
-func newStreamFactory(ctx core.Context, out chan<- core.InputReader) *streamFactory {
+func newStreamFactory(ctx core.Context, out chan<- core.InputReader, listenPorts []capture.PortRange) *streamFactory {
 	ctx.Logger = ctx.Logger.With().
 		Str(core.LoggerKeyComponent, "tcp_stream_factory").
 		Logger()
 
 	return &streamFactory{
-		ctx:   ctx,
-		out:   out,
-		conns: make(map[string]*conn),
+		ctx:         ctx,
+		out:         out,
+		done:        make(chan struct{}),
+		conns:       newConnTracker(defaultConnShards),
+		listenPorts: listenPorts,
 	}
 }
 
 type streamFactory struct {
 	ctx core.Context
 
-	outMu  sync.Mutex
-	out    chan<- core.InputReader
-	closed bool
+	listenPorts []capture.PortRange
 
-	connsMu sync.Mutex
-	conns   map[string]*conn
+	// outMu is held for reading while streams are emitted
+	// and for writing while out is closed. done is closed
+	// first so that Close does not wait for a slow consumer.
+	outMu     sync.RWMutex
+	out       chan<- core.InputReader
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+
+	conns *connTracker
+
+	// keys decrypt TLS connections. If nil, streams
+	// are not decrypted.
+	keys *tlsx.KeyLog
 }
 
-type reader struct {
-	ctx  core.Context
-	rs   tcpreader.ReaderStream
-	s    *stream
-	meta *core.Meta
+type stream struct {
+	ctx       core.Context
+	net       gopacket.Flow
+	transport gopacket.Flow
+	conn      *conn
 }
 
-func (r *reader) Reassembled(reassembly []tcpassembly.Reassembly) {
-	r.rs.Reassembled(reassembly)
-	if r.ctx.Config.DebugPackets {
-		r.ctx.Logger.Debug().Interface("reassembly", reassembly).Msg("reassembled")
-	} else {
-		r.ctx.Logger.Debug().Msg("reassembled")
+// connStream receives the reassembled data of both
+// directions of a TCP connection. A reader is created for
+// each direction when its first packet is seen.
+type connStream struct {
+	f         *streamFactory
+	net       gopacket.Flow
+	transport gopacket.Flow
+
+	up   *reader
+	down *reader
+
+	// tls decrypts the connection if it is a TLS connection
+	// and a key log is configured.
+	tls *tlsx.Conn
+}
+
+func (f *streamFactory) New(net, transport gopacket.Flow, _ *layers.TCP, _ reassembly.AssemblerContext) reassembly.Stream {
+	cs := &connStream{
+		f:         f,
+		net:       net,
+		transport: transport,
+	}
+	if f.keys != nil {
+		cs.tls = tlsx.NewConn(f.keys)
 	}
+	return cs
 }
 
-func (r *reader) ReassemblyComplete() {
-	r.rs.ReassemblyComplete()
-	r.s.conn.complete = true
-	r.ctx.Logger.Debug().Msg("reassembly complete")
+// Accept accepts every packet of a connection once it has started.
+// Captures usually start in the middle of connections, so streams
+// are started by the first SYN or data without waiting for a SYN.
+// Packets without either are ignored until then, so that packets
+// trailing a completed connection, such as the final ACK, do not
+// start a new one.
+func (cs *connStream) Accept(tcp *layers.TCP, ci gopacket.CaptureInfo, dir reassembly.TCPFlowDirection, _ reassembly.Sequence, start *bool, _ reassembly.AssemblerContext) bool {
+	if cs.up == nil && cs.down == nil && !tcp.SYN && len(tcp.Payload) == 0 {
+		return false
+	}
+
+	*start = true
+
+	if cs.reader(dir) == nil {
+		if dir == reassembly.TCPDirClientToServer {
+			cs.up = cs.f.newReader(cs.net, cs.transport)
+		} else {
+			cs.down = cs.f.newReader(cs.net.Reverse(), cs.transport.Reverse())
+		}
+		if cs.tls != nil {
+			cs.reader(dir).tls = cs.tls
+			cs.reader(dir).side = tlsSide(dir)
+		}
+	}
+
+	cs.reader(dir).s.conn.seen(ci.Timestamp, tcp)
+
+	return true
 }
 
-func (r *reader) Read(p []byte) (int, error) {
-	return r.rs.Read(p)
+func (cs *connStream) ReassembledSG(sg reassembly.ScatterGather, _ reassembly.AssemblerContext) {
+	dir, _, _, _ := sg.Info()
+	if r := cs.reader(dir); r != nil {
+		n := r.reassembled(sg)
+		r.s.conn.addBytes(direction(dir), n)
+	}
+	cs.setTLSMeta()
 }
 
-func (r *reader) Close() error {
-	return r.rs.Close()
+// setTLSMeta adds the state of a decrypted TLS
+// connection to the metadata of its readers.
+func (cs *connStream) setTLSMeta() {
+	if cs.tls == nil {
+		return
+	}
+
+	state, ok := cs.tls.State()
+	if !ok {
+		return
+	}
+
+	for _, r := range []*reader{cs.up, cs.down} {
+		if r == nil {
+			continue
+		}
+		if _, ok := r.meta.Get(tlsx.MetaVersion); ok {
+			continue
+		}
+		r.meta.Set(tlsx.MetaServerName, state.ServerName)
+		r.meta.Set(tlsx.MetaVersion, tlsx.VersionName(state.Version))
+		r.meta.Set(tlsx.MetaCipherSuite, tls.CipherSuiteName(state.CipherSuite))
+	}
 }
 
-func (r *reader) Meta() *core.Meta {
-	return r.meta
+// ReassemblyComplete completes both readers. The connection is
+// removed from the pool so that a new connection between the same
+// addresses and ports starts new streams.
+func (cs *connStream) ReassemblyComplete(_ reassembly.AssemblerContext) bool {
+	for _, r := range []*reader{cs.up, cs.down} {
+		if r != nil {
+			r.complete()
+		}
+	}
+
+	if c := cs.conn(); c != nil {
+		c.close()
+		cs.f.conns.expire(c)
+	}
+	return true
 }
 
-type stream struct {
-	ctx       core.Context
-	net       gopacket.Flow
-	transport gopacket.Flow
-	conn      *conn
+func (cs *connStream) conn() *conn {
+	for _, r := range []*reader{cs.up, cs.down} {
+		if r != nil {
+			return r.s.conn
+		}
+	}
+	return nil
 }
 
-func (f *streamFactory) New(net, transport gopacket.Flow) tcpassembly.Stream {
+func (cs *connStream) reader(dir reassembly.TCPFlowDirection) *reader {
+	if dir == reassembly.TCPDirClientToServer {
+		return cs.up
+	}
+	return cs.down
+}
+
+// direction converts the direction of a half connection. The
+// client is the side that sent the first packet that was seen.
+func direction(dir reassembly.TCPFlowDirection) Direction {
+	if dir == reassembly.TCPDirClientToServer {
+		return DirectionUp
+	}
+	return DirectionDown
+}
+
+// tlsSide converts the direction of a half connection
+// to the side of a TLS connection that sends it.
+func tlsSide(dir reassembly.TCPFlowDirection) tlsx.Side {
+	if dir == reassembly.TCPDirClientToServer {
+		return tlsx.Client
+	}
+	return tlsx.Server
+}
+
+func (f *streamFactory) newReader(net, transport gopacket.Flow) *reader {
 	ctx := f.ctx
 	ctx.Logger = f.ctx.Logger.With().
 		Str("net", net.String()).
@@ -115,73 +256,114 @@ func (f *streamFactory) New(net, transport gopacket.Flow) tcpassembly.Stream {
 
 	d := f.trackStream(ctx, s)
 
-	r := &reader{
-		ctx: ctx,
-		rs:  tcpreader.NewReaderStream(),
-		s:   s,
-		meta: core.NewMeta(s.conn.id, map[string]interface{}{
-			MetaDirection: d,
-			MetaSrcAddr:   net.Src().String(),
-			MetaSrcPort:   transport.Src().String(),
-			MetaDstAddr:   net.Dst().String(),
-			MetaDstPort:   transport.Dst().String(),
-		}),
+	values := map[string]interface{}{
+		MetaDirection: d,
+		MetaSrcAddr:   net.Src().String(),
+		MetaSrcPort:   transport.Src().String(),
+		MetaDstAddr:   net.Dst().String(),
+		MetaDstPort:   transport.Dst().String(),
+		MetaEgress:    f.ctx.FlowConfig.CaptureEgress,
 	}
 
-	f.outMu.Lock()
-	if !f.closed {
-		f.out <- r
+	var (
+		timeline = NewTimeline()
+		gaps     = NewGaps()
+	)
+
+	values[MetaTimeline] = timeline
+	values[MetaGaps] = gaps
+
+	if d == DirectionUp {
+		values[MetaConnectionEvents] = (<-chan *Connection)(s.conn.events)
+	}
+
+	if port, ok := f.listenPort(transport); ok {
+		values[MetaListenPort] = port
+	}
+
+	r := newReader(ctx, s, core.NewMeta(s.conn.id, values), timeline, gaps)
+
+	if !f.emit(r) {
+		// Nothing will read the stream, so
+		// its data is discarded.
+		r.Close()
+		ctx.Logger.Debug().Msg("dropped reader stream")
+		return r
 	}
-	f.outMu.Unlock()
 
 	ctx.Logger.Debug().Msg("emitted reader stream")
 
 	return r
 }
 
-func (f *streamFactory) Close() {
-	f.outMu.Lock()
-	f.closed = true
-	close(f.out)
-	f.outMu.Unlock()
+// listenPort finds the port of a flow that matched one of the
+// captured port ranges. The destination port is preferred so
+// that both streams of a connection carry the same port.
+func (f *streamFactory) listenPort(transport gopacket.Flow) (string, bool) {
+	for _, e := range []gopacket.Endpoint{transport.Dst(), transport.Src()} {
+		port, err := strconv.Atoi(e.String())
+		if err != nil {
+			continue
+		}
+		for _, r := range f.listenPorts {
+			if r.Contains(port) {
+				return e.String(), true
+			}
+		}
+	}
+
+	return "", false
 }
 
-// Prune cleans up old streams and connections that are no longer being used.
-// This is a stop-the-world garbage collection.
-func (f *streamFactory) prune() {
-	f.connsMu.Lock()
-	defer f.connsMu.Unlock()
+// emit emits a stream unless the factory is closed
+// or the context is done. It reports whether it did.
+func (f *streamFactory) emit(r *reader) bool {
+	f.outMu.RLock()
+	defer f.outMu.RUnlock()
 
-	f.ctx.Logger.Debug().Msg("pruning")
+	if f.closed {
+		return false
+	}
 
-	for id, c := range f.conns {
-		if c.complete {
-			f.ctx.Logger.Debug().Str("id", id).Msg("removing connection")
-			delete(f.conns, id)
-		}
+	select {
+	case f.out <- r:
+		return true
+	case <-f.done:
+		return false
+	case <-f.ctx.StdContext.Done():
+		return false
 	}
 }
 
-func (f *streamFactory) trackStream(ctx core.Context, s *stream) Direction {
-	f.connsMu.Lock()
-	defer f.connsMu.Unlock()
+// Close stops emitting streams and closes the output channel.
+func (f *streamFactory) Close() {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
 
-	ctx.Logger.Debug().Msg("tracking stream")
+	f.outMu.Lock()
+	defer f.outMu.Unlock()
 
-	var (
-		id = &streamID{net: s.net, transport: s.transport}
-		c  = f.conns[id.String()]
-		d  = DirectionUp
-	)
+	if !f.closed {
+		f.closed = true
+		close(f.out)
+	}
+}
+
+// prune removes connections that have completed.
+func (f *streamFactory) prune() {
+	n := f.conns.prune()
+	f.ctx.Logger.Debug().Int("removed", n).Msg("pruned connections")
+}
+
+func (f *streamFactory) trackStream(ctx core.Context, s *stream) Direction {
+	ctx.Logger.Debug().Msg("tracking stream")
 
-	if c == nil {
-		c = newConn(s)
-		f.conns[id.Reverse().String()] = c
+	c, d := f.conns.track(s)
+	if d == DirectionUp {
 		ctx.Logger.Debug().Str("conn_id", c.id).Msg("creating new connection")
 	} else {
-		c.down = s
 		ctx.Logger.Debug().Str("conn_id", c.id).Msg("setting downstream connection")
-		d = DirectionDown
 	}
 
 	s.conn = c
@@ -1,17 +1,360 @@
 package tcp
 
-import "testing"
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/reassembly"
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
 
 func TestReader(t *testing.T) {
+	type packet struct {
+		data string
+		seq  uint32
+	}
+	cases := []struct {
+		desc    string
+		packets []packet
+		out     string
+		gaps    []Gap
+	}{
+		{
+			desc: "contiguous",
+			packets: []packet{
+				{data: "aaa", seq: 100},
+				{data: "bbb", seq: 103},
+			},
+			out: "aaabbb",
+		},
+		{
+			desc: "out of order",
+			packets: []packet{
+				{data: "aaa", seq: 100},
+				{data: "ccc", seq: 106},
+				{data: "bbb", seq: 103},
+			},
+			out: "aaabbbccc",
+		},
+		{
+			desc: "gap",
+			packets: []packet{
+				{data: "aaa", seq: 100},
+				{data: "bbb", seq: 110},
+			},
+			out:  "aaabbb",
+			gaps: []Gap{{Offset: 3, Length: 7}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				out       = make(chan core.InputReader, 1)
+				ctx       = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+				f         = newStreamFactory(ctx, out, nil)
+				assembler = reassembly.NewAssembler(reassembly.NewStreamPool(f))
+				packets   []gopacket.Packet
+			)
+
+			for _, p := range c.packets {
+				packets = append(packets, newSeqPacket(t, p.data, 1111, 2222, p.seq))
+			}
+
+			go func() {
+				for _, p := range packets {
+					ac := assemblerContext(gopacket.CaptureInfo{Timestamp: time.Now()})
+					assembler.AssembleWithContext(p.NetworkLayer().NetworkFlow(), p.TransportLayer().(*layers.TCP), &ac)
+				}
+				assembler.FlushAll()
+			}()
+
+			r := <-out
+			defer r.Close()
+
+			b, err := ioutil.ReadAll(r)
+			assert.NilError(t, err)
+			assert.Equal(t, c.out, string(b))
+
+			v, ok := r.Meta().Get(MetaGaps)
+			assert.Assert(t, ok)
+			assert.DeepEqual(t, c.gaps, v.(*Gaps).All())
+		})
+	}
+}
+
+func TestStreamFactoryClose(t *testing.T) {
+	var (
+		out       = make(chan core.InputReader)
+		ctx       = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+		f         = newStreamFactory(ctx, out, nil)
+		assembler = reassembly.NewAssembler(reassembly.NewStreamPool(f))
+		p         = newSeqPacket(t, "aaa", 1111, 2222, 100)
+		done      = make(chan struct{})
+	)
+
+	// Nothing reads the stream, so emitting it blocks.
+	go func() {
+		defer close(done)
+		ac := assemblerContext(gopacket.CaptureInfo{Timestamp: time.Now()})
+		assembler.AssembleWithContext(p.NetworkLayer().NetworkFlow(), p.TransportLayer().(*layers.TCP), &ac)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	f.Close()
+	<-done
+
+	_, more := <-out
+	assert.Assert(t, !more)
+
+	// Closing again is safe.
+	f.Close()
+}
+
+func TestListenPort(t *testing.T) {
+	cases := []struct {
+		desc        string
+		listenPorts []capture.PortRange
+		src         uint16
+		dst         uint16
+		port        string
+		ok          bool
+	}{
+		{
+			desc: "no ports",
+			src:  1111,
+			dst:  80,
+		},
+		{
+			desc:        "dst",
+			listenPorts: []capture.PortRange{{First: 80, Last: 80}},
+			src:         1111,
+			dst:         80,
+			port:        "80",
+			ok:          true,
+		},
+		{
+			desc:        "src",
+			listenPorts: []capture.PortRange{{First: 80, Last: 80}},
+			src:         80,
+			dst:         1111,
+			port:        "80",
+			ok:          true,
+		},
+		{
+			desc: "range",
+			listenPorts: []capture.PortRange{
+				{First: 80, Last: 80},
+				{First: 9000, Last: 9010},
+			},
+			src:  1111,
+			dst:  9005,
+			port: "9005",
+			ok:   true,
+		},
+		{
+			desc:        "no match",
+			listenPorts: []capture.PortRange{{First: 9000, Last: 9010}},
+			src:         1111,
+			dst:         80,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			f := &streamFactory{listenPorts: c.listenPorts}
+			transport := gopacket.NewFlow(layers.EndpointTCPPort,
+				layers.NewTCPPortEndpoint(layers.TCPPort(c.src)).Raw(),
+				layers.NewTCPPortEndpoint(layers.TCPPort(c.dst)).Raw())
+			port, ok := f.listenPort(transport)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.port, port)
+		})
+	}
+}
+
+func TestConnectionEvents(t *testing.T) {
+	var (
+		t1 = time.Unix(1000, 0)
+		t2 = time.Unix(2000, 0)
+		t3 = time.Unix(3000, 0)
+	)
 	cases := []struct {
-		desc string
+		desc   string
+		last   layers.TCP
+		end    time.Time
+		reason CloseReason
 	}{
 		{
-			desc: "",
+			desc:   "fin",
+			last:   layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 103, FIN: true},
+			end:    t3,
+			reason: CloseFIN,
+		},
+		{
+			desc:   "rst",
+			last:   layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 505, RST: true},
+			end:    t3,
+			reason: CloseRST,
+		},
+		{
+			desc:   "timeout",
+			end:    t2,
+			reason: CloseTimeout,
 		},
 	}
 	for _, c := range cases {
 		t.Run(c.desc, func(t *testing.T) {
+			var (
+				out       = make(chan core.InputReader, 2)
+				ctx       = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+				f         = newStreamFactory(ctx, out, nil)
+				assembler = reassembly.NewAssembler(reassembly.NewStreamPool(f))
+				packets   = []gopacket.Packet{
+					newSeqPacket(t, "aaa", 1111, 2222, 100),
+					newSeqPacket(t, "bbbbb", 2222, 1111, 500),
+				}
+				times = []time.Time{t1, t2, t3}
+			)
+
+			if c.last.SrcPort != 0 {
+				packets = append(packets, newTCPPacket(t, "", c.last))
+			}
+
+			go func() {
+				for n, p := range packets {
+					ac := assemblerContext(gopacket.CaptureInfo{Timestamp: times[n]})
+					assembler.AssembleWithContext(p.NetworkLayer().NetworkFlow(), p.TransportLayer().(*layers.TCP), &ac)
+				}
+				assembler.FlushAll()
+			}()
+
+			up := <-out
+			go ioutil.ReadAll(up)
+
+			down := <-out
+			_, err := ioutil.ReadAll(down)
+			assert.NilError(t, err)
+
+			_, ok := down.Meta().Get(MetaConnectionEvents)
+			assert.Assert(t, !ok)
+
+			v, ok := up.Meta().Get(MetaConnectionEvents)
+			assert.Assert(t, ok)
+
+			var events []*Connection
+			for e := range v.(<-chan *Connection) {
+				events = append(events, e)
+			}
+
+			assert.DeepEqual(t, []*Connection{
+				{
+					ConnectionID: up.Meta().SourceID,
+					SessionID:    ctx.SessionID,
+					Event:        ConnectionOpen,
+					ClientAddr:   "0.0.0.0",
+					ClientPort:   "1111",
+					ServerAddr:   "0.0.0.0",
+					ServerPort:   "2222",
+					Start:        t1,
+				},
+				{
+					ConnectionID: up.Meta().SourceID,
+					SessionID:    ctx.SessionID,
+					Event:        ConnectionClose,
+					ClientAddr:   "0.0.0.0",
+					ClientPort:   "1111",
+					ServerAddr:   "0.0.0.0",
+					ServerPort:   "2222",
+					Start:        t1,
+					End:          c.end,
+					BytesUp:      3,
+					BytesDown:    5,
+					CloseReason:  c.reason,
+				},
+			}, events)
 		})
 	}
 }
+
+func TestStreamFactoryReusedPorts(t *testing.T) {
+	var (
+		out       = make(chan core.InputReader, 4)
+		ctx       = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+		f         = newStreamFactory(ctx, out, nil)
+		assembler = reassembly.NewAssembler(reassembly.NewStreamPool(f))
+		packets   = []struct {
+			data string
+			tcp  layers.TCP
+		}{
+			// The first connection is closed by both sides,
+			// and the final ACK trails its completion.
+			{tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 99, SYN: true}},
+			{tcp: layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 499, SYN: true, ACK: true, Ack: 100}},
+			{data: "aaa", tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 100, ACK: true, Ack: 500}},
+			{data: "bbb", tcp: layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 500, ACK: true, Ack: 103}},
+			{tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 103, FIN: true, ACK: true, Ack: 503}},
+			{tcp: layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 503, FIN: true, ACK: true, Ack: 104}},
+			{tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 104, ACK: true, Ack: 504}},
+
+			// The second connection reuses the client port.
+			{tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 999, SYN: true}},
+			{tcp: layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 1999, SYN: true, ACK: true, Ack: 1000}},
+			{data: "ccc", tcp: layers.TCP{SrcPort: 1111, DstPort: 2222, Seq: 1000, ACK: true, Ack: 2000}},
+			{data: "ddd", tcp: layers.TCP{SrcPort: 2222, DstPort: 1111, Seq: 2000, ACK: true, Ack: 1003}},
+		}
+	)
+
+	go func() {
+		for n, p := range packets {
+			var (
+				packet = newTCPPacket(t, p.data, p.tcp)
+				ac     = assemblerContext(gopacket.CaptureInfo{Timestamp: time.Unix(int64(n), 0)})
+			)
+			assembler.AssembleWithContext(packet.NetworkLayer().NetworkFlow(), packet.TransportLayer().(*layers.TCP), &ac)
+		}
+		assembler.FlushAll()
+	}()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		data = make(map[string]string)
+		ids  = make(map[string]bool)
+	)
+	for i := 0; i < 4; i++ {
+		select {
+		case r := <-out:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b, err := ioutil.ReadAll(r)
+				assert.Check(t, err)
+				mu.Lock()
+				data[string(b)] = r.Meta().SourceID
+				ids[r.Meta().SourceID] = true
+				mu.Unlock()
+			}()
+		case <-time.After(time.Second):
+			t.Fatalf("got %d streams, want 4", i)
+		}
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 2, len(ids))
+	assert.Equal(t, data["aaa"], data["bbb"])
+	assert.Equal(t, data["ccc"], data["ddd"])
+	assert.Assert(t, data["aaa"] != data["ccc"])
+
+	select {
+	case r := <-out:
+		t.Fatalf("unexpected stream %s", r.Meta().SourceID)
+	default:
+	}
+}
@@ -0,0 +1,99 @@
+package tcp
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// timelineHistory is how far behind the read position of a
+// stream its timeline is kept, so that consumers can still
+// find the time of bytes they have read but not yet parsed.
+const timelineHistory = 1 << 20
+
+// Timeline records when each byte of a reassembled stream was
+// captured, so that consumers can find the wire time of any
+// message in the stream from its offset.
+type Timeline struct {
+	mu     sync.Mutex
+	starts []int64
+	times  []time.Time
+	total  int64
+}
+
+// NewTimeline creates a new timeline.
+func NewTimeline() *Timeline {
+	return &Timeline{}
+}
+
+// Add records that the next n bytes of the stream
+// were captured at the given time.
+func (t *Timeline) Add(n int, ts time.Time) {
+	if n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.starts = append(t.starts, t.total)
+	t.times = append(t.times, ts)
+	t.total += int64(n)
+}
+
+// At gets the time at which the byte at offset was captured.
+// Streams are read in order, so offsets must not decrease
+// between calls; earlier entries are discarded as the
+// offset moves forward.
+func (t *Timeline) At(offset int64) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if offset < 0 || offset >= t.total || len(t.starts) == 0 {
+		return time.Time{}, false
+	}
+
+	// Find the last entry that starts at or before the offset.
+	i := sort.Search(len(t.starts), func(i int) bool {
+		return t.starts[i] > offset
+	}) - 1
+
+	if i < 0 {
+		return time.Time{}, false
+	}
+
+	ts := t.times[i]
+	t.discard(i)
+
+	return ts, true
+}
+
+// Consume records that the stream has been read up to offset.
+// Entries for bytes more than timelineHistory behind it are
+// discarded, so that the timeline of a long-lived stream
+// does not grow whether or not its consumer calls At.
+func (t *Timeline) Consume(offset int64) {
+	cutoff := offset - timelineHistory
+	if cutoff <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Keep the entry that covers the cutoff.
+	i := sort.Search(len(t.starts), func(i int) bool {
+		return t.starts[i] > cutoff
+	}) - 1
+
+	t.discard(i)
+}
+
+// discard discards the entries before i.
+func (t *Timeline) discard(i int) {
+	if i <= 0 {
+		return
+	}
+	t.starts = t.starts[i:]
+	t.times = t.times[i:]
+}
@@ -0,0 +1,79 @@
+package tcp
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTimeline(t *testing.T) {
+	var (
+		t0 = time.Unix(1000, 0)
+		t1 = time.Unix(2000, 0)
+		t2 = time.Unix(3000, 0)
+	)
+
+	tl := NewTimeline()
+
+	_, ok := tl.At(0)
+	assert.Assert(t, !ok)
+
+	tl.Add(10, t0)
+	tl.Add(0, t1)
+	tl.Add(5, t1)
+	tl.Add(5, t2)
+
+	cases := []struct {
+		desc   string
+		offset int64
+		ts     time.Time
+		ok     bool
+	}{
+		{desc: "negative", offset: -1},
+		{desc: "first byte", offset: 0, ts: t0, ok: true},
+		{desc: "within first chunk", offset: 9, ts: t0, ok: true},
+		{desc: "second chunk", offset: 10, ts: t1, ok: true},
+		{desc: "third chunk", offset: 17, ts: t2, ok: true},
+		{desc: "last byte", offset: 19, ts: t2, ok: true},
+		{desc: "past end", offset: 20},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ts, ok := tl.At(c.offset)
+			assert.Equal(t, c.ok, ok)
+			assert.Equal(t, c.ts, ts)
+		})
+	}
+
+	assert.Equal(t, 1, len(tl.starts))
+}
+
+func TestTimelineConsume(t *testing.T) {
+	var (
+		t0 = time.Unix(1000, 0)
+		t1 = time.Unix(2000, 0)
+		t2 = time.Unix(3000, 0)
+	)
+
+	tl := NewTimeline()
+	tl.Add(timelineHistory, t0)
+	tl.Add(10, t1)
+	tl.Add(10, t2)
+
+	// Nothing is discarded within the history.
+	tl.Consume(timelineHistory)
+	assert.Equal(t, 3, len(tl.starts))
+
+	// The entry that covers the cutoff is kept.
+	tl.Consume(2*timelineHistory + 5)
+	assert.Equal(t, 2, len(tl.starts))
+
+	ts, ok := tl.At(5)
+	assert.Assert(t, !ok)
+	assert.Equal(t, time.Time{}, ts)
+
+	ts, ok = tl.At(timelineHistory + 5)
+	assert.Assert(t, ok)
+	assert.Equal(t, t1, ts)
+}
@@ -0,0 +1,115 @@
+package tlsmeta
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/envelope"
+	"github.com/rename-this/vhs/tcp"
+	"github.com/rename-this/vhs/tlsx"
+)
+
+// Handshake is the metadata of a TLS handshake, as seen in
+// the plaintext hello messages of a connection.
+type Handshake struct {
+	ConnectionID string    `json:"connection_id,omitempty"`
+	SessionID    string    `json:"session_id,omitempty"`
+	Created      time.Time `json:"created,omitempty"`
+	ClientAddr   string    `json:"client_addr,omitempty"`
+	ClientPort   string    `json:"client_port,omitempty"`
+	ServerAddr   string    `json:"server_addr,omitempty"`
+	ServerPort   string    `json:"server_port,omitempty"`
+	ServerName   string    `json:"server_name,omitempty"`
+	ALPN         []string  `json:"alpn,omitempty"`
+
+	// ClientVersions and ClientCipherSuites are
+	// the versions and cipher suites offered by
+	// the client.
+	ClientVersions     []string `json:"client_versions,omitempty"`
+	ClientCipherSuites []string `json:"client_cipher_suites,omitempty"`
+	JA3                string   `json:"ja3,omitempty"`
+	JA3Hash            string   `json:"ja3_hash,omitempty"`
+
+	// Version, CipherSuite, and NegotiatedALPN are chosen
+	// by the server. They are empty if the ServerHello
+	// was not seen.
+	Version        string `json:"version,omitempty"`
+	CipherSuite    string `json:"cipher_suite,omitempty"`
+	NegotiatedALPN string `json:"negotiated_alpn,omitempty"`
+	JA3S           string `json:"ja3s,omitempty"`
+	JA3SHash       string `json:"ja3s_hash,omitempty"`
+
+	// Certificate is the certificate of the server. It is
+	// only sent in plaintext by versions before TLS 1.3.
+	Certificate *Certificate `json:"certificate,omitempty"`
+}
+
+// Kind gets an envelope kind for a Handshake.
+func (h *Handshake) Kind() envelope.Kind { return "tls.handshake" }
+
+// Certificate is a summary of an X.509 certificate.
+type Certificate struct {
+	Subject   string    `json:"subject,omitempty"`
+	Issuer    string    `json:"issuer,omitempty"`
+	DNSNames  []string  `json:"dns_names,omitempty"`
+	NotBefore time.Time `json:"not_before,omitempty"`
+	NotAfter  time.Time `json:"not_after,omitempty"`
+}
+
+func registerEnvelopes(ctx core.Context) {
+	ctx.Registry.Register(func() envelope.Kindify { return &Handshake{} })
+	tcp.RegisterEnvelopes(ctx)
+}
+
+// setClientHello sets the fields of a handshake that
+// come from the ClientHello and its stream.
+func (h *Handshake) setClientHello(hello *tlsx.ClientHello, m *core.Meta) {
+	h.ConnectionID = m.SourceID
+	h.ClientAddr, _ = m.GetString(tcp.MetaSrcAddr)
+	h.ClientPort, _ = m.GetString(tcp.MetaSrcPort)
+	h.ServerAddr, _ = m.GetString(tcp.MetaDstAddr)
+	h.ServerPort, _ = m.GetString(tcp.MetaDstPort)
+	h.ServerName = hello.ServerName
+	h.ALPN = hello.ALPN
+
+	versions := hello.SupportedVersions
+	if len(versions) == 0 {
+		versions = []uint16{hello.Version}
+	}
+	for _, v := range versions {
+		if !tlsx.IsGREASE(v) {
+			h.ClientVersions = append(h.ClientVersions, tlsx.VersionName(v))
+		}
+	}
+
+	for _, s := range hello.CipherSuites {
+		if !tlsx.IsGREASE(s) {
+			h.ClientCipherSuites = append(h.ClientCipherSuites, tls.CipherSuiteName(s))
+		}
+	}
+
+	h.JA3 = hello.JA3()
+	h.JA3Hash = tlsx.FingerprintHash(h.JA3)
+}
+
+// setServerHello sets the fields of a
+// handshake that come from the ServerHello.
+func (h *Handshake) setServerHello(hello *tlsx.ServerHello) {
+	h.Version = tlsx.VersionName(hello.Version)
+	h.CipherSuite = tls.CipherSuiteName(hello.CipherSuite)
+	h.NegotiatedALPN = hello.ALPN
+	h.JA3S = hello.JA3S()
+	h.JA3SHash = tlsx.FingerprintHash(h.JA3S)
+}
+
+func newCertificate(cert *x509.Certificate) *Certificate {
+	return &Certificate{
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		DNSNames:  cert.DNSNames,
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
@@ -0,0 +1,264 @@
+package tlsmeta
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"github.com/rename-this/vhs/tlsx"
+)
+
+// serverHelloTimeout is how long the handshake of a connection
+// waits for the ServerHello before it is emitted without it.
+const serverHelloTimeout = 10 * time.Second
+
+// NewInputFormat creates a new TLS input format that emits the
+// handshake metadata of TLS connections. Connections are not
+// decrypted, and streams that are not TLS are ignored.
+func NewInputFormat(ctx core.Context) (core.InputFormat, error) {
+	registerEnvelopes(ctx)
+	return &inputFormat{
+		out:   make(chan interface{}),
+		conns: make(map[string]*conn),
+	}, nil
+}
+
+type inputFormat struct {
+	out chan interface{}
+
+	mu    sync.Mutex
+	conns map[string]*conn
+}
+
+// conn is a connection whose handshake is
+// filled in by the readers of both streams.
+type conn struct {
+	hs   Handshake
+	refs int
+
+	// server is closed once the server's stream
+	// has no more handshake messages to give.
+	server chan struct{}
+}
+
+func (i *inputFormat) Init(ctx core.Context, _ core.Middleware, streams <-chan core.InputReader) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "tls_input_format").
+		Logger()
+
+	ctx.Logger.Debug().Msg("init")
+
+	for rdr := range streams {
+		go func(r core.InputReader) {
+			id := r.Meta().SourceID
+
+			c := i.acquire(id)
+			defer i.release(id)
+
+			if i.read(ctx, r, c) {
+				i.emit(ctx, c)
+			}
+		}(rdr)
+	}
+}
+
+func (i *inputFormat) Out() <-chan interface{} { return i.out }
+
+// read reads the handshake messages of a stream into the handshake
+// of its connection. It reports whether a ClientHello was read,
+// in which case the handshake should be emitted. The stream is
+// closed once its handshake messages are read.
+func (i *inputFormat) read(ctx core.Context, r core.InputReader, c *conn) bool {
+	defer func() {
+		if err := r.Close(); err != nil {
+			ctx.Errors <- fmt.Errorf("failed to close tls input format: %w", err)
+		}
+	}()
+
+	direction, ok := r.Meta().Get(tcp.MetaDirection)
+	if !ok {
+		ctx.Errors <- fmt.Errorf("failed to find direction for %s", r.Meta().SourceID)
+		return false
+	}
+
+	switch direction {
+	case tcp.DirectionUp:
+		return i.readClient(ctx, r, c)
+	case tcp.DirectionDown:
+		i.readServer(ctx, r, c)
+		return false
+	default:
+		ctx.Errors <- fmt.Errorf("invalid TCP direction: %s", direction)
+		return false
+	}
+}
+
+func (i *inputFormat) readClient(ctx core.Context, r core.InputReader, c *conn) bool {
+	typ, body, err := tlsx.NewHandshakeReader(r).Next()
+	if err != nil {
+		logReadError(ctx, r, err)
+		return false
+	}
+
+	if typ != tlsx.TypeClientHello {
+		return false
+	}
+
+	hello, err := tlsx.ParseClientHello(body)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to parse ClientHello: %w", err)
+		return false
+	}
+
+	i.mu.Lock()
+	c.hs.setClientHello(hello, r.Meta())
+	c.hs.Created = created(r.Meta())
+	i.mu.Unlock()
+
+	return true
+}
+
+func (i *inputFormat) readServer(ctx core.Context, r core.InputReader, c *conn) {
+	defer close(c.server)
+
+	hr := tlsx.NewHandshakeReader(r)
+
+	for {
+		typ, body, err := hr.Next()
+		if err != nil {
+			logReadError(ctx, r, err)
+			return
+		}
+
+		switch typ {
+		case tlsx.TypeServerHello:
+			hello, err := tlsx.ParseServerHello(body)
+			if err != nil {
+				ctx.Errors <- fmt.Errorf("failed to parse ServerHello: %w", err)
+				return
+			}
+
+			// The client answers a HelloRetryRequest with
+			// a new ClientHello, which is answered by the
+			// actual ServerHello.
+			if hello.IsHelloRetryRequest() {
+				continue
+			}
+
+			i.mu.Lock()
+			c.hs.setServerHello(hello)
+			i.mu.Unlock()
+
+			// The rest of a TLS 1.3 handshake is encrypted.
+			if hello.Version == tls.VersionTLS13 {
+				return
+			}
+
+		case tlsx.TypeCertificate:
+			certs, err := tlsx.ParseCertificates(body)
+			if err != nil {
+				ctx.Errors <- fmt.Errorf("failed to parse certificates: %w", err)
+				return
+			}
+
+			if len(certs) > 0 {
+				i.mu.Lock()
+				c.hs.Certificate = newCertificate(certs[0])
+				i.mu.Unlock()
+			}
+
+		case tlsx.TypeServerHelloDone:
+			return
+		}
+	}
+}
+
+// emit emits the handshake of a connection once the server's
+// stream has been read, or the ServerHello has not been seen
+// in time.
+func (i *inputFormat) emit(ctx core.Context, c *conn) {
+	timedOut := false
+
+	select {
+	case <-c.server:
+	case <-time.After(serverHelloTimeout):
+		timedOut = true
+	case <-ctx.StdContext.Done():
+		return
+	}
+
+	i.mu.Lock()
+	hs := c.hs
+	i.mu.Unlock()
+
+	if timedOut {
+		ctx.Logger.Debug().Str("connection_id", hs.ConnectionID).Msg("timed out waiting for ServerHello")
+	}
+
+	hs.SessionID = ctx.SessionID
+
+	select {
+	case i.out <- &hs:
+	case <-ctx.StdContext.Done():
+	}
+}
+
+// acquire gets the connection of a stream,
+// creating it for the first of its streams.
+func (i *inputFormat) acquire(id string) *conn {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	c, ok := i.conns[id]
+	if !ok {
+		c = &conn{server: make(chan struct{})}
+		i.conns[id] = c
+	}
+	c.refs++
+
+	return c
+}
+
+// release removes the connection of a stream
+// once the last of its streams is done with it.
+func (i *inputFormat) release(id string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	c := i.conns[id]
+	if c.refs--; c.refs == 0 {
+		delete(i.conns, id)
+	}
+}
+
+// logReadError logs why the handshake of a stream could not be read.
+// Streams that end before their handshake, or that are not TLS,
+// are expected.
+func logReadError(ctx core.Context, r core.InputReader, err error) {
+	if errors.Is(err, io.EOF) || errors.Is(err, tlsx.ErrNotHandshake) {
+		return
+	}
+	ctx.Logger.Debug().Err(err).Str("connection_id", r.Meta().SourceID).Msg("failed to read handshake")
+}
+
+// created gets the time at which the first byte
+// of a stream was captured.
+func created(m *core.Meta) time.Time {
+	v, ok := m.Get(tcp.MetaTimeline)
+	if !ok {
+		return time.Now()
+	}
+
+	if timeline, ok := v.(*tcp.Timeline); ok {
+		if t, ok := timeline.At(0); ok {
+			return t
+		}
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,187 @@
+package tlsmeta
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/tcp"
+	"github.com/rename-this/vhs/tlsx"
+)
+
+func TestInputFormat(t *testing.T) {
+	cases := []struct {
+		desc        string
+		file        string
+		version     string
+		cipherSuite string
+		certificate bool
+	}{
+		{
+			desc:        "tls 1.2",
+			file:        "../testdata/tls12.pcapng",
+			version:     "TLS 1.2",
+			cipherSuite: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			certificate: true,
+		},
+		{
+			desc:        "tls 1.3",
+			file:        "../testdata/tls13.pcapng",
+			version:     "TLS 1.3",
+			cipherSuite: "TLS_AES_128_GCM_SHA256",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				errs    = make(chan error, 1)
+				flowCfg = &core.FlowConfig{
+					InputFile:      c.file,
+					SourceDuration: time.Minute,
+					TCPTimeout:     time.Minute,
+				}
+				ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+			)
+
+			s, err := tcp.NewPcapSource(ctx)
+			assert.NilError(t, err)
+
+			f, err := NewInputFormat(ctx)
+			assert.NilError(t, err)
+
+			go s.Init(ctx)
+			go f.Init(ctx, nil, s.Streams())
+
+			var hs *Handshake
+			select {
+			case n := <-f.Out():
+				hs = n.(*Handshake)
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for handshake")
+			}
+
+			assert.Equal(t, 0, len(errs))
+
+			assert.Equal(t, ctx.SessionID, hs.SessionID)
+			assert.Assert(t, hs.ConnectionID != "")
+			assert.Equal(t, "10.0.0.1", hs.ClientAddr)
+			assert.Equal(t, "50000", hs.ClientPort)
+			assert.Equal(t, "10.0.0.2", hs.ServerAddr)
+			assert.Equal(t, "443", hs.ServerPort)
+			assert.Equal(t, "example.com", hs.ServerName)
+			assert.Equal(t, c.version, hs.ClientVersions[0])
+			assert.Equal(t, c.version, hs.Version)
+			assert.Equal(t, c.cipherSuite, hs.CipherSuite)
+			assert.Assert(t, len(hs.ClientCipherSuites) > 0)
+			assert.Assert(t, strings.HasPrefix(hs.JA3, "771,"))
+			assert.Equal(t, tlsx.FingerprintHash(hs.JA3), hs.JA3Hash)
+			assert.Assert(t, strings.HasPrefix(hs.JA3S, "771,"))
+			assert.Equal(t, tlsx.FingerprintHash(hs.JA3S), hs.JA3SHash)
+			assert.Equal(t, time.Date(2020, 9, 1, 0, 0, 0, int(time.Millisecond), time.UTC), hs.Created.UTC())
+
+			if c.certificate {
+				assert.Assert(t, hs.Certificate != nil)
+				assert.Equal(t, "CN=example.com", hs.Certificate.Subject)
+				assert.DeepEqual(t, []string{"example.com"}, hs.Certificate.DNSNames)
+				assert.Assert(t, hs.Certificate.NotAfter.After(hs.Certificate.NotBefore))
+			} else {
+				assert.Assert(t, hs.Certificate == nil)
+			}
+		})
+	}
+}
+
+type testInputReader struct {
+	*strings.Reader
+	meta   *core.Meta
+	closed chan struct{}
+}
+
+func (r *testInputReader) Close() error {
+	close(r.closed)
+	return nil
+}
+
+func (r *testInputReader) Meta() *core.Meta { return r.meta }
+
+func newTestInputReader(id string, direction tcp.Direction, s string) *testInputReader {
+	return &testInputReader{
+		Reader: strings.NewReader(s),
+		meta: core.NewMeta(id, map[string]interface{}{
+			tcp.MetaDirection: direction,
+		}),
+		closed: make(chan struct{}),
+	}
+}
+
+func TestInputFormatNotTLS(t *testing.T) {
+	var (
+		errs    = make(chan error, 1)
+		ctx     = core.NewContext(&core.Config{}, &core.FlowConfig{}, errs)
+		streams = make(chan core.InputReader)
+	)
+
+	f, err := NewInputFormat(ctx)
+	assert.NilError(t, err)
+
+	go f.Init(ctx, nil, streams)
+
+	var (
+		up   = newTestInputReader("a", tcp.DirectionUp, "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n")
+		down = newTestInputReader("a", tcp.DirectionDown, "HTTP/1.1 204 No Content\r\n\r\n")
+	)
+
+	streams <- up
+	streams <- down
+	close(streams)
+
+	<-up.closed
+	<-down.closed
+
+	// Streams are released once they are closed.
+	i := f.(*inputFormat)
+	for {
+		i.mu.Lock()
+		n := len(i.conns)
+		i.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	select {
+	case n := <-f.Out():
+		t.Fatalf("unexpected output: %v", n)
+	default:
+	}
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestEmitCancel(t *testing.T) {
+	var (
+		ctx  = core.NewContext(&core.Config{}, &core.FlowConfig{}, nil)
+		done = make(chan struct{})
+	)
+
+	f, err := NewInputFormat(ctx)
+	assert.NilError(t, err)
+
+	c := &conn{server: make(chan struct{})}
+	close(c.server)
+
+	// Nothing reads the handshake.
+	go func() {
+		defer close(done)
+		f.(*inputFormat).emit(ctx, c)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	ctx.Cancel()
+	<-done
+}
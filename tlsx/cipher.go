@@ -0,0 +1,228 @@
+package tlsx
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+// cipherSuite is a supported cipher suite. Only AEAD
+// cipher suites can be decrypted.
+type cipherSuite struct {
+	id     uint16
+	keyLen int
+	// ivLen is the length of the fixed part of the
+	// nonce that is derived from the secrets.
+	ivLen int
+	// explicitNonceLen is the length of the part of the nonce
+	// that is sent with each TLS 1.2 record.
+	explicitNonceLen int
+	hash             func() hash.Hash
+	aead             func(key []byte) (cipher.AEAD, error)
+}
+
+var cipherSuites = []*cipherSuite{
+	// TLS 1.3
+	{tls.TLS_AES_128_GCM_SHA256, 16, 12, 0, sha256.New, newGCM},
+	{tls.TLS_AES_256_GCM_SHA384, 32, 12, 0, sha512.New384, newGCM},
+	{tls.TLS_CHACHA20_POLY1305_SHA256, 32, 12, 0, sha256.New, chacha20poly1305.New},
+
+	// TLS 1.2
+	{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, 16, 4, 8, sha256.New, newGCM},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, 16, 4, 8, sha256.New, newGCM},
+	{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, 32, 4, 8, sha512.New384, newGCM},
+	{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, 32, 4, 8, sha512.New384, newGCM},
+	{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, 16, 4, 8, sha256.New, newGCM},
+	{tls.TLS_RSA_WITH_AES_256_GCM_SHA384, 32, 4, 8, sha512.New384, newGCM},
+	{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, 32, 12, 0, sha256.New, chacha20poly1305.New},
+	{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, 32, 12, 0, sha256.New, chacha20poly1305.New},
+}
+
+func cipherSuiteByID(id uint16) (*cipherSuite, bool) {
+	for _, s := range cipherSuites {
+		if s.id == id {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordCipher decrypts the records of one direction of a connection.
+type recordCipher struct {
+	suite *cipherSuite
+	aead  cipher.AEAD
+	iv    []byte
+	seq   uint64
+}
+
+func newRecordCipher(suite *cipherSuite, key, iv []byte) (*recordCipher, error) {
+	aead, err := suite.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	return &recordCipher{
+		suite: suite,
+		aead:  aead,
+		iv:    iv,
+	}, nil
+}
+
+// newRecordCipher13 creates a TLS 1.3 record cipher from a traffic secret.
+func newRecordCipher13(suite *cipherSuite, secret []byte) (*recordCipher, error) {
+	var (
+		key = hkdfExpandLabel(suite.hash, secret, "key", suite.keyLen)
+		iv  = hkdfExpandLabel(suite.hash, secret, "iv", suite.ivLen)
+	)
+	return newRecordCipher(suite, key, iv)
+}
+
+// nonce gets the nonce of the next record. For TLS 1.2 GCM
+// cipher suites, the explicit part of the nonce is sent
+// with the record. Otherwise, the IV is XORed with the
+// sequence number.
+func (c *recordCipher) nonce(explicit []byte) []byte {
+	if c.suite.explicitNonceLen > 0 {
+		return append(append([]byte{}, c.iv...), explicit...)
+	}
+
+	nonce := append([]byte{}, c.iv...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], c.seq)
+	for i, b := range seq {
+		nonce[len(nonce)-8+i] ^= b
+	}
+	return nonce
+}
+
+// open12 decrypts a TLS 1.2 record.
+func (c *recordCipher) open12(typ uint8, version uint16, fragment []byte) ([]byte, error) {
+	n := c.suite.explicitNonceLen
+	if len(fragment) < n+c.aead.Overhead() {
+		return nil, errors.New("record too short")
+	}
+
+	var (
+		nonce      = c.nonce(fragment[:n])
+		ciphertext = fragment[n:]
+		ad         = make([]byte, 13)
+	)
+
+	binary.BigEndian.PutUint64(ad, c.seq)
+	ad[8] = typ
+	binary.BigEndian.PutUint16(ad[9:], version)
+	binary.BigEndian.PutUint16(ad[11:], uint16(len(ciphertext)-c.aead.Overhead()))
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	c.seq++
+
+	return plaintext, nil
+}
+
+// open13 decrypts a TLS 1.3 record, returning
+// its plaintext and its inner content type.
+func (c *recordCipher) open13(header, fragment []byte) ([]byte, uint8, error) {
+	plaintext, err := c.aead.Open(nil, c.nonce(nil), fragment, header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c.seq++
+
+	// The content type follows the content and precedes any padding.
+	i := len(plaintext) - 1
+	for i >= 0 && plaintext[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return nil, 0, errors.New("record has no content type")
+	}
+
+	return plaintext[:i], plaintext[i], nil
+}
+
+// keyBlock12 derives the client and server keys and
+// IVs of a TLS 1.2 connection from its master secret.
+func keyBlock12(suite *cipherSuite, master, clientRandom, serverRandom []byte) (clientKey, serverKey, clientIV, serverIV []byte) {
+	var (
+		seed = append(append([]byte{}, serverRandom...), clientRandom...)
+		n    = 2*suite.keyLen + 2*suite.ivLen
+		b    = prf12(suite.hash, master, []byte("key expansion"), seed, n)
+	)
+
+	clientKey, b = b[:suite.keyLen], b[suite.keyLen:]
+	serverKey, b = b[:suite.keyLen], b[suite.keyLen:]
+	clientIV, b = b[:suite.ivLen], b[suite.ivLen:]
+	serverIV = b[:suite.ivLen]
+
+	return clientKey, serverKey, clientIV, serverIV
+}
+
+// prf12 is the TLS 1.2 pseudorandom function, as defined in RFC 5246.
+func prf12(h func() hash.Hash, secret, label, seed []byte, n int) []byte {
+	var (
+		out = make([]byte, 0, n)
+		mac = hmac.New(h, secret)
+		s   = append(append([]byte{}, label...), seed...)
+		a   = s
+	)
+
+	for len(out) < n {
+		mac.Reset()
+		mac.Write(a)
+		a = mac.Sum(nil)
+
+		mac.Reset()
+		mac.Write(a)
+		mac.Write(s)
+		out = mac.Sum(out)
+	}
+
+	return out[:n]
+}
+
+// hkdfExpandLabel is HKDF-Expand-Label, as defined in RFC 8446,
+// with an empty context.
+func hkdfExpandLabel(h func() hash.Hash, secret []byte, label string, n int) []byte {
+	label = "tls13 " + label
+
+	info := make([]byte, 0, 4+len(label))
+	info = append(info, byte(n>>8), byte(n))
+	info = append(info, byte(len(label)))
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, n)
+	if _, err := hkdf.Expand(h, secret, info).Read(out); err != nil {
+		// HKDF only fails if too much output is requested.
+		panic("tlsx: hkdf expansion failed: " + err.Error())
+	}
+
+	return out
+}
+
+// nextTrafficSecret derives the traffic secret
+// that follows a TLS 1.3 KeyUpdate message.
+func nextTrafficSecret(suite *cipherSuite, secret []byte) []byte {
+	return hkdfExpandLabel(suite.hash, secret, "traffic upd", suite.hash().Size())
+}
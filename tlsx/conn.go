@@ -0,0 +1,431 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Side is a side of a TLS connection.
+type Side int
+
+const (
+	// Client is the side that sends the ClientHello.
+	Client Side = iota
+	// Server is the side that sends the ServerHello.
+	Server
+)
+
+const recordHeaderLen = 5
+
+type connMode int
+
+const (
+	modeUnknown connMode = iota
+	modeTLS
+	modePassthrough
+)
+
+// State is the state of a TLS connection
+// once its ServerHello has been seen.
+type State struct {
+	ServerName  string
+	Version     uint16
+	CipherSuite uint16
+}
+
+// Conn decrypts the records of both sides of a captured TLS
+// connection. Data of each side must be given in order, and the
+// ServerHello must be given before the client's encrypted records,
+// as they are on the wire. Connections that do not start with a TLS
+// record are passed through unchanged. A Conn must not be used
+// concurrently.
+type Conn struct {
+	keys *KeyLog
+	mode connMode
+
+	client  *ClientHello
+	server  *ServerHello
+	suite   *cipherSuite
+	secrets *secrets
+
+	sides [2]*halfConn
+}
+
+// halfConn is one side of a connection.
+type halfConn struct {
+	side Side
+	buf  []byte
+	hs   handshakeBuffer
+
+	// encrypted is true once records of the side
+	// are encrypted.
+	encrypted bool
+	failed    bool
+
+	// cipher decrypts TLS 1.2 records, and TLS 1.3
+	// records until the handshake is complete.
+	cipher *recordCipher
+
+	// app, appSecret, and post are the application cipher,
+	// its traffic secret, and the post-handshake messages
+	// of a TLS 1.3 connection.
+	app           *recordCipher
+	appSecret     []byte
+	handshakeDone bool
+	post          handshakeBuffer
+}
+
+// NewConn creates a new Conn that decrypts with secrets from a key log.
+func NewConn(keys *KeyLog) *Conn {
+	return &Conn{
+		keys: keys,
+		sides: [2]*halfConn{
+			{side: Client},
+			{side: Server},
+		},
+	}
+}
+
+// State gets the state of the connection. It returns
+// false until the ServerHello has been seen.
+func (c *Conn) State() (State, bool) {
+	if c.server == nil {
+		return State{}, false
+	}
+
+	s := State{
+		Version:     c.server.Version,
+		CipherSuite: c.server.CipherSuite,
+	}
+	if c.client != nil {
+		s.ServerName = c.client.ServerName
+	}
+
+	return s, true
+}
+
+// Decrypt decrypts data sent by a side of the connection, returning
+// the application data of any records that are now complete. Once
+// decryption of a side fails, the error is returned and the rest
+// of the side's data is discarded.
+func (c *Conn) Decrypt(side Side, data []byte) ([]byte, error) {
+	if c.mode == modeUnknown && len(data) > 0 {
+		if isRecordType(data[0]) {
+			c.mode = modeTLS
+		} else {
+			c.mode = modePassthrough
+		}
+	}
+
+	if c.mode == modePassthrough {
+		return data, nil
+	}
+
+	h := c.sides[side]
+	if h.failed {
+		return nil, nil
+	}
+
+	h.buf = append(h.buf, data...)
+
+	var out []byte
+
+	for len(h.buf) >= recordHeaderLen {
+		n := int(binary.BigEndian.Uint16(h.buf[3:5]))
+		if len(h.buf) < recordHeaderLen+n {
+			break
+		}
+
+		// The client's encrypted records cannot be decrypted
+		// until the ServerHello has been seen.
+		if h.encrypted && c.suite == nil {
+			break
+		}
+
+		var (
+			header   = h.buf[:recordHeaderLen]
+			fragment = h.buf[recordHeaderLen : recordHeaderLen+n]
+		)
+
+		p, err := c.record(h, header, fragment)
+		if err != nil {
+			h.failed = true
+			h.buf = nil
+			return out, fmt.Errorf("failed to decrypt %s record: %w", side, err)
+		}
+
+		out = append(out, p...)
+		h.buf = h.buf[recordHeaderLen+n:]
+	}
+
+	return out, nil
+}
+
+// Skip records that bytes sent by a side were lost. Records
+// cannot be framed or decrypted after a loss, so the rest of
+// the side's data is discarded. Connections that are passed
+// through are unaffected.
+func (c *Conn) Skip(side Side) {
+	if c.mode == modePassthrough {
+		return
+	}
+
+	h := c.sides[side]
+	h.failed = true
+	h.buf = nil
+}
+
+func (s Side) String() string {
+	if s == Client {
+		return "client"
+	}
+	return "server"
+}
+
+func isRecordType(b byte) bool {
+	return b >= recordTypeChangeCipherSpec && b <= recordTypeApplicationData
+}
+
+// record handles a record, returning its application data.
+func (c *Conn) record(h *halfConn, header, fragment []byte) ([]byte, error) {
+	typ := header[0]
+
+	if typ == recordTypeChangeCipherSpec {
+		// TLS 1.3 sends ChangeCipherSpec records only for
+		// compatibility with middleboxes.
+		if c.version() == tls.VersionTLS13 {
+			return nil, nil
+		}
+		if err := c.startCipher12(h); err != nil {
+			return nil, err
+		}
+		h.encrypted = true
+		return nil, nil
+	}
+
+	if !h.encrypted {
+		switch typ {
+		case recordTypeHandshake:
+			h.hs.add(fragment)
+			return nil, c.handshake(h)
+		case recordTypeAlert:
+			return nil, nil
+		default:
+			return nil, errors.New("application data before handshake")
+		}
+	}
+
+	if c.version() == tls.VersionTLS13 {
+		return c.record13(h, header, fragment)
+	}
+
+	p, err := h.cipher.open12(typ, binary.BigEndian.Uint16(header[1:3]), fragment)
+	if err != nil {
+		return nil, err
+	}
+	if typ != recordTypeApplicationData {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// handshake handles the plaintext handshake messages of a side.
+func (c *Conn) handshake(h *halfConn) error {
+	for {
+		typ, body, ok := h.hs.next()
+		if !ok {
+			return nil
+		}
+
+		switch {
+		case h.side == Client && typ == TypeClientHello:
+			hello, err := ParseClientHello(body)
+			if err != nil {
+				return err
+			}
+			c.client = hello
+
+		case h.side == Server && typ == TypeServerHello:
+			hello, err := ParseServerHello(body)
+			if err != nil {
+				return err
+			}
+			if hello.IsHelloRetryRequest() {
+				continue
+			}
+
+			suite, ok := cipherSuiteByID(hello.CipherSuite)
+			if !ok {
+				return fmt.Errorf("unsupported cipher suite: %s", tls.CipherSuiteName(hello.CipherSuite))
+			}
+
+			c.server, c.suite = hello, suite
+
+			switch hello.Version {
+			case tls.VersionTLS12:
+			case tls.VersionTLS13:
+				// All further records are encrypted, and there
+				// are no more plaintext handshake messages.
+				for _, s := range c.sides {
+					s.encrypted = true
+				}
+				return nil
+			default:
+				return fmt.Errorf("unsupported version: %s", VersionName(hello.Version))
+			}
+		}
+	}
+}
+
+func (c *Conn) version() uint16 {
+	if c.server == nil {
+		return 0
+	}
+	return c.server.Version
+}
+
+// lookupSecrets finds the secrets of the connection in the key log.
+func (c *Conn) lookupSecrets() (*secrets, error) {
+	if c.secrets != nil {
+		return c.secrets, nil
+	}
+
+	if c.client == nil {
+		return nil, errors.New("missing ClientHello")
+	}
+
+	s, ok := c.keys.lookup(c.client.Random)
+	if !ok {
+		return nil, fmt.Errorf("no secrets for client random %x", c.client.Random)
+	}
+
+	c.secrets = s
+
+	return s, nil
+}
+
+// startCipher12 starts decrypting the TLS 1.2 records of a side.
+func (c *Conn) startCipher12(h *halfConn) error {
+	if c.suite == nil {
+		return errors.New("missing ServerHello")
+	}
+
+	s, err := c.lookupSecrets()
+	if err != nil {
+		return err
+	}
+	if s.master == nil {
+		return errors.New("missing master secret")
+	}
+
+	clientKey, serverKey, clientIV, serverIV := keyBlock12(c.suite, s.master, c.client.Random, c.server.Random)
+
+	key, iv := clientKey, clientIV
+	if h.side == Server {
+		key, iv = serverKey, serverIV
+	}
+
+	h.cipher, err = newRecordCipher(c.suite, key, iv)
+	return err
+}
+
+// startCipher13 starts decrypting the TLS 1.3 records of a side.
+func (c *Conn) startCipher13(h *halfConn) error {
+	s, err := c.lookupSecrets()
+	if err != nil {
+		return err
+	}
+
+	handshakeSecret, appSecret := s.clientHandshake, s.clientTraffic
+	if h.side == Server {
+		handshakeSecret, appSecret = s.serverHandshake, s.serverTraffic
+	}
+
+	if appSecret == nil {
+		return errors.New("missing traffic secret")
+	}
+
+	// The handshake secret is optional since the
+	// handshake records are not needed.
+	if handshakeSecret != nil {
+		if h.cipher, err = newRecordCipher13(c.suite, handshakeSecret); err != nil {
+			return err
+		}
+	}
+
+	h.appSecret = appSecret
+	h.app, err = newRecordCipher13(c.suite, appSecret)
+	return err
+}
+
+// record13 decrypts a TLS 1.3 record. Until the handshake of a side
+// is complete, its records are tried with both the handshake and the
+// application ciphers, since the end of the handshake is only known
+// from the encrypted Finished message.
+func (c *Conn) record13(h *halfConn, header, fragment []byte) ([]byte, error) {
+	if h.app == nil {
+		if err := c.startCipher13(h); err != nil {
+			return nil, err
+		}
+	}
+
+	if !h.handshakeDone {
+		if h.cipher != nil {
+			if _, _, err := h.cipher.open13(header, fragment); err == nil {
+				return nil, nil
+			}
+		}
+
+		p, typ, err := h.app.open13(header, fragment)
+		if err != nil {
+			if h.cipher == nil {
+				// Without the handshake secret, handshake
+				// records cannot be told apart from records
+				// that cannot be decrypted.
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		h.handshakeDone = true
+
+		return c.inner13(h, p, typ)
+	}
+
+	p, typ, err := h.app.open13(header, fragment)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.inner13(h, p, typ)
+}
+
+// inner13 handles the content of a TLS 1.3 record after the handshake.
+func (c *Conn) inner13(h *halfConn, p []byte, typ uint8) ([]byte, error) {
+	switch typ {
+	case recordTypeApplicationData:
+		return p, nil
+	case recordTypeHandshake:
+		h.post.add(p)
+		for {
+			msgType, _, ok := h.post.next()
+			if !ok {
+				return nil, nil
+			}
+			if msgType != TypeKeyUpdate {
+				continue
+			}
+
+			h.appSecret = nextTrafficSecret(c.suite, h.appSecret)
+
+			var err error
+			if h.app, err = newRecordCipher13(c.suite, h.appSecret); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, nil
+	}
+}
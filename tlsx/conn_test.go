@@ -0,0 +1,277 @@
+package tlsx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type capturedWrite struct {
+	side Side
+	data []byte
+}
+
+// capture records the writes of both sides of a connection in order.
+type capture struct {
+	mu     sync.Mutex
+	writes []capturedWrite
+}
+
+func (c *capture) add(side Side, p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writes = append(c.writes, capturedWrite{
+		side: side,
+		data: append([]byte{}, p...),
+	})
+}
+
+type captureConn struct {
+	net.Conn
+	side Side
+	c    *capture
+}
+
+func (c *captureConn) Write(p []byte) (int, error) {
+	c.c.add(c.side, p)
+	return c.Conn.Write(p)
+}
+
+func newTestCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NilError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NilError(t, err)
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}
+}
+
+// exchange runs a TLS connection in which the client sends a
+// request and the server sends a response, returning the
+// captured writes and the key log.
+func exchange(t *testing.T, maxVersion uint16, cipherSuite uint16, req, res string) (*capture, string) {
+	var (
+		c              = &capture{}
+		keyLog         bytes.Buffer
+		clientConn, sc = net.Pipe()
+		cert           = newTestCertificate(t)
+	)
+
+	clientCfg := &tls.Config{
+		ServerName:         "example.com",
+		InsecureSkipVerify: true,
+		MaxVersion:         maxVersion,
+		KeyLogWriter:       &keyLog,
+	}
+	if cipherSuite != 0 {
+		clientCfg.CipherSuites = []uint16{cipherSuite}
+	}
+
+	var (
+		client = tls.Client(&captureConn{Conn: clientConn, side: Client, c: c}, clientCfg)
+		server = tls.Server(&captureConn{Conn: sc, side: Server, c: c}, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		})
+		errs = make(chan error, 1)
+	)
+
+	go func() {
+		b := make([]byte, len(req))
+		if _, err := io.ReadFull(server, b); err != nil {
+			errs <- err
+			return
+		}
+		_, err := server.Write([]byte(res))
+		errs <- err
+	}()
+
+	_, err := client.Write([]byte(req))
+	assert.NilError(t, err)
+
+	b := make([]byte, len(res))
+	_, err = io.ReadFull(client, b)
+	assert.NilError(t, err)
+	assert.Equal(t, res, string(b))
+
+	assert.NilError(t, <-errs)
+
+	clientConn.Close()
+	sc.Close()
+
+	return c, keyLog.String()
+}
+
+// decrypt decrypts captured writes, splitting
+// them into chunks of at most chunkSize bytes.
+func decrypt(c *capture, conn *Conn, chunkSize int) ([2]string, error) {
+	var out [2]bytes.Buffer
+	for _, w := range c.writes {
+		for data := w.data; len(data) > 0; {
+			n := len(data)
+			if chunkSize > 0 && n > chunkSize {
+				n = chunkSize
+			}
+			p, err := conn.Decrypt(w.side, data[:n])
+			out[w.side].Write(p)
+			if err != nil {
+				return [2]string{out[0].String(), out[1].String()}, err
+			}
+			data = data[n:]
+		}
+	}
+	return [2]string{out[0].String(), out[1].String()}, nil
+}
+
+func TestConnDecrypt(t *testing.T) {
+	const (
+		req = "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"
+		res = "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"
+	)
+
+	cases := []struct {
+		desc        string
+		maxVersion  uint16
+		cipherSuite uint16
+		chunkSize   int
+		filter      func(line string) bool
+	}{
+		{
+			desc:       "tls 1.3",
+			maxVersion: tls.VersionTLS13,
+		},
+		{
+			desc:       "tls 1.3 one byte at a time",
+			maxVersion: tls.VersionTLS13,
+			chunkSize:  1,
+		},
+		{
+			desc:       "tls 1.3 without handshake secrets",
+			maxVersion: tls.VersionTLS13,
+			filter: func(line string) bool {
+				return !strings.Contains(line, "HANDSHAKE")
+			},
+		},
+		{
+			desc:        "tls 1.2 aes 128 gcm",
+			maxVersion:  tls.VersionTLS12,
+			cipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		},
+		{
+			desc:        "tls 1.2 aes 256 gcm",
+			maxVersion:  tls.VersionTLS12,
+			cipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		},
+		{
+			desc:        "tls 1.2 chacha20 poly1305",
+			maxVersion:  tls.VersionTLS12,
+			cipherSuite: tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+			chunkSize:   7,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			captured, keyLog := exchange(t, c.maxVersion, c.cipherSuite, req, res)
+
+			if c.filter != nil {
+				var lines []string
+				for _, line := range strings.Split(keyLog, "\n") {
+					if c.filter(line) {
+						lines = append(lines, line)
+					}
+				}
+				keyLog = strings.Join(lines, "\n")
+			}
+
+			keys, err := ParseKeyLog(strings.NewReader(keyLog))
+			assert.NilError(t, err)
+
+			conn := NewConn(keys)
+
+			out, err := decrypt(captured, conn, c.chunkSize)
+			assert.NilError(t, err)
+			assert.Equal(t, req, out[Client])
+			assert.Equal(t, res, out[Server])
+
+			state, ok := conn.State()
+			assert.Assert(t, ok)
+			assert.Equal(t, "example.com", state.ServerName)
+			assert.Equal(t, c.maxVersion, state.Version)
+			if c.cipherSuite != 0 {
+				assert.Equal(t, c.cipherSuite, state.CipherSuite)
+			}
+		})
+	}
+}
+
+func TestConnDecryptErrors(t *testing.T) {
+	captured, _ := exchange(t, tls.VersionTLS13, 0, "ping", "pong")
+
+	t.Run("no secrets", func(t *testing.T) {
+		keys, err := ParseKeyLog(strings.NewReader(""))
+		assert.NilError(t, err)
+
+		_, err = decrypt(captured, NewConn(keys), 0)
+		assert.ErrorContains(t, err, "no secrets for client random")
+	})
+
+	t.Run("missing handshake", func(t *testing.T) {
+		keys, err := ParseKeyLog(strings.NewReader(""))
+		assert.NilError(t, err)
+
+		conn := NewConn(keys)
+
+		_, err = conn.Decrypt(Client, []byte{recordTypeApplicationData, 3, 3, 0, 1, 0})
+		assert.ErrorContains(t, err, "application data before handshake")
+
+		// The rest of the side is discarded.
+		p, err := conn.Decrypt(Client, []byte{recordTypeApplicationData, 3, 3, 0, 1, 0})
+		assert.NilError(t, err)
+		assert.Equal(t, 0, len(p))
+	})
+}
+
+func TestConnPassthrough(t *testing.T) {
+	conn := NewConn(nil)
+
+	for _, s := range []struct {
+		side Side
+		data string
+	}{
+		{side: Client, data: "GET / HTTP/1.1\r\n\r\n"},
+		{side: Server, data: "HTTP/1.1 204 No Content\r\n\r\n"},
+	} {
+		p, err := conn.Decrypt(s.side, []byte(s.data))
+		assert.NilError(t, err)
+		assert.Equal(t, s.data, string(p))
+	}
+
+	_, ok := conn.State()
+	assert.Assert(t, !ok)
+}
@@ -0,0 +1,143 @@
+package tlsx
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// Record content types.
+const (
+	recordTypeChangeCipherSpec uint8 = 20
+	recordTypeAlert            uint8 = 21
+	recordTypeHandshake        uint8 = 22
+	recordTypeApplicationData  uint8 = 23
+)
+
+// Handshake message types.
+const (
+	TypeClientHello     uint8 = 1
+	TypeServerHello     uint8 = 2
+	TypeCertificate     uint8 = 11
+	TypeServerHelloDone uint8 = 14
+	TypeKeyUpdate       uint8 = 24
+)
+
+// maxRecordLen is the maximum length of the
+// fragment of a record, as defined in RFC 8446.
+const maxRecordLen = 1<<14 + 256
+
+var (
+	// ErrNotHandshake is returned when a stream does
+	// not start with a TLS handshake record.
+	ErrNotHandshake = errors.New("not a TLS handshake")
+
+	errMalformedRecord = errors.New("malformed record")
+)
+
+// handshakeBuffer splits handshake messages, which
+// may span or share records.
+type handshakeBuffer struct {
+	buf []byte
+}
+
+// add adds the content of a handshake record.
+func (b *handshakeBuffer) add(p []byte) {
+	b.buf = append(b.buf, p...)
+}
+
+// next gets the type and body of the next complete
+// message, if there is one.
+func (b *handshakeBuffer) next() (uint8, []byte, bool) {
+	if len(b.buf) < 4 {
+		return 0, nil, false
+	}
+
+	n := int(b.buf[1])<<16 | int(b.buf[2])<<8 | int(b.buf[3])
+	if len(b.buf) < 4+n {
+		return 0, nil, false
+	}
+
+	typ, body := b.buf[0], b.buf[4:4+n]
+	b.buf = b.buf[4+n:]
+
+	return typ, body, true
+}
+
+// HandshakeReader reads the plaintext handshake messages
+// sent by one side of a TLS connection.
+type HandshakeReader struct {
+	r       io.Reader
+	hs      handshakeBuffer
+	started bool
+	done    bool
+
+	// retry is true after a HelloRetryRequest, whose
+	// ChangeCipherSpec does not end the plaintext handshake.
+	retry bool
+}
+
+// NewHandshakeReader creates a new HandshakeReader that
+// reads the records sent by one side of a connection.
+func NewHandshakeReader(r io.Reader) *HandshakeReader {
+	return &HandshakeReader{r: r}
+}
+
+// Next reads the next handshake message, returning its type and
+// body. ErrNotHandshake is returned if the stream does not start
+// with a handshake record. io.EOF is returned once the stream
+// ends or the side stops sending plaintext handshake records.
+func (h *HandshakeReader) Next() (uint8, []byte, error) {
+	for {
+		if typ, body, ok := h.hs.next(); ok {
+			if typ == TypeServerHello && len(body) >= 34 {
+				h.retry = bytes.Equal(body[2:34], helloRetryRequestRandom)
+			}
+			return typ, body, nil
+		}
+		if h.done {
+			return 0, nil, io.EOF
+		}
+
+		var header [recordHeaderLen]byte
+		if _, err := io.ReadFull(h.r, header[:]); err != nil {
+			if !h.started && errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, nil, ErrNotHandshake
+			}
+			return 0, nil, err
+		}
+
+		typ, n := header[0], int(header[3])<<8|int(header[4])
+
+		if !h.started {
+			// The major version of every TLS version is 3.
+			if typ != recordTypeHandshake || header[1] != 3 {
+				return 0, nil, ErrNotHandshake
+			}
+			h.started = true
+		}
+
+		if n > maxRecordLen {
+			return 0, nil, errMalformedRecord
+		}
+
+		fragment := make([]byte, n)
+		if _, err := io.ReadFull(h.r, fragment); err != nil {
+			return 0, nil, err
+		}
+
+		if typ == recordTypeChangeCipherSpec && h.retry {
+			h.retry = false
+			continue
+		}
+
+		if typ != recordTypeHandshake {
+			// Handshake messages that follow a ChangeCipherSpec
+			// or an alert are encrypted or never sent.
+			h.done = true
+			continue
+		}
+
+		h.hs.add(fragment)
+	}
+}
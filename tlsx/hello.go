@@ -0,0 +1,348 @@
+package tlsx
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// Extension types.
+const (
+	extensionServerName        uint16 = 0
+	extensionSupportedGroups   uint16 = 10
+	extensionECPointFormats    uint16 = 11
+	extensionALPN              uint16 = 16
+	extensionSupportedVersions uint16 = 43
+)
+
+// serverNameTypeHostName is the only defined type of server name.
+const serverNameTypeHostName uint8 = 0
+
+// helloRetryRequestRandom is the random of a ServerHello
+// that is a HelloRetryRequest, as defined in RFC 8446.
+var helloRetryRequestRandom = func() []byte {
+	b := sha256.Sum256([]byte("HelloRetryRequest"))
+	return b[:]
+}()
+
+var errMalformedHello = errors.New("malformed hello")
+
+// ClientHello is a parsed ClientHello message.
+type ClientHello struct {
+	// Version is the version field of the message. Clients
+	// that offer TLS 1.3 send TLS 1.2 and list the versions
+	// they support in SupportedVersions.
+	Version      uint16
+	Random       []byte
+	CipherSuites []uint16
+	// Extensions are the types of the extensions
+	// of the message, in the order they were sent.
+	Extensions        []uint16
+	ServerName        string
+	ALPN              []string
+	SupportedGroups   []uint16
+	PointFormats      []uint8
+	SupportedVersions []uint16
+}
+
+// ServerHello is a parsed ServerHello message.
+type ServerHello struct {
+	// Version is the negotiated version. It is taken from the
+	// supported versions extension if present, since TLS 1.3
+	// servers send TLS 1.2 in the version field.
+	Version uint16
+	// LegacyVersion is the version field of the message.
+	LegacyVersion uint16
+	Random        []byte
+	CipherSuite   uint16
+	// Extensions are the types of the extensions
+	// of the message, in the order they were sent.
+	Extensions []uint16
+	ALPN       string
+}
+
+// ParseClientHello parses the body of a ClientHello message.
+func ParseClientHello(b []byte) (*ClientHello, error) {
+	var (
+		s            = cryptobyte.String(b)
+		h            = &ClientHello{}
+		sessionID    cryptobyte.String
+		cipherSuites cryptobyte.String
+		compression  cryptobyte.String
+	)
+
+	if !s.ReadUint16(&h.Version) ||
+		!s.ReadBytes(&h.Random, 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compression) {
+		return nil, errMalformedHello
+	}
+
+	for !cipherSuites.Empty() {
+		var suite uint16
+		if !cipherSuites.ReadUint16(&suite) {
+			return nil, errMalformedHello
+		}
+		h.CipherSuites = append(h.CipherSuites, suite)
+	}
+
+	if s.Empty() {
+		return h, nil
+	}
+
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errMalformedHello
+	}
+
+	for !extensions.Empty() {
+		var (
+			typ  uint16
+			data cryptobyte.String
+		)
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errMalformedHello
+		}
+
+		h.Extensions = append(h.Extensions, typ)
+
+		var ok bool
+		switch typ {
+		case extensionServerName:
+			h.ServerName, ok = readServerName(data)
+		case extensionSupportedGroups:
+			h.SupportedGroups, ok = readUint16List(data)
+		case extensionECPointFormats:
+			var formats cryptobyte.String
+			ok = data.ReadUint8LengthPrefixed(&formats)
+			h.PointFormats = formats
+		case extensionALPN:
+			h.ALPN, ok = readProtocols(data)
+		case extensionSupportedVersions:
+			var versions cryptobyte.String
+			ok = data.ReadUint8LengthPrefixed(&versions)
+			for ok && !versions.Empty() {
+				var v uint16
+				if ok = versions.ReadUint16(&v); ok {
+					h.SupportedVersions = append(h.SupportedVersions, v)
+				}
+			}
+		default:
+			ok = true
+		}
+		if !ok {
+			return nil, errMalformedHello
+		}
+	}
+
+	return h, nil
+}
+
+// ParseServerHello parses the body of a ServerHello message.
+func ParseServerHello(b []byte) (*ServerHello, error) {
+	var (
+		s           = cryptobyte.String(b)
+		h           = &ServerHello{}
+		sessionID   cryptobyte.String
+		compression uint8
+	)
+
+	if !s.ReadUint16(&h.LegacyVersion) ||
+		!s.ReadBytes(&h.Random, 32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint16(&h.CipherSuite) ||
+		!s.ReadUint8(&compression) {
+		return nil, errMalformedHello
+	}
+
+	h.Version = h.LegacyVersion
+
+	if s.Empty() {
+		return h, nil
+	}
+
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil, errMalformedHello
+	}
+
+	for !extensions.Empty() {
+		var (
+			typ  uint16
+			data cryptobyte.String
+		)
+		if !extensions.ReadUint16(&typ) || !extensions.ReadUint16LengthPrefixed(&data) {
+			return nil, errMalformedHello
+		}
+
+		h.Extensions = append(h.Extensions, typ)
+
+		switch typ {
+		case extensionSupportedVersions:
+			if !data.ReadUint16(&h.Version) {
+				return nil, errMalformedHello
+			}
+		case extensionALPN:
+			protocols, ok := readProtocols(data)
+			if !ok || len(protocols) != 1 {
+				return nil, errMalformedHello
+			}
+			h.ALPN = protocols[0]
+		}
+	}
+
+	return h, nil
+}
+
+// ParseCertificates parses the body of a TLS 1.2 Certificate
+// message, returning the certificate chain of the sender. The
+// Certificate messages of TLS 1.3 are encrypted.
+func ParseCertificates(b []byte) ([]*x509.Certificate, error) {
+	var (
+		s     = cryptobyte.String(b)
+		chain cryptobyte.String
+		certs []*x509.Certificate
+	)
+
+	if !s.ReadUint24LengthPrefixed(&chain) || !s.Empty() {
+		return nil, errors.New("malformed certificate message")
+	}
+
+	for !chain.Empty() {
+		var der cryptobyte.String
+		if !chain.ReadUint24LengthPrefixed(&der) {
+			return nil, errors.New("malformed certificate message")
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// IsHelloRetryRequest reports whether the ServerHello
+// is a TLS 1.3 HelloRetryRequest.
+func (h *ServerHello) IsHelloRetryRequest() bool {
+	return bytes.Equal(h.Random, helloRetryRequestRandom)
+}
+
+// JA3 gets the JA3 fingerprint of a ClientHello. GREASE
+// values are left out, since clients choose them at random.
+func (h *ClientHello) JA3() string {
+	formats := make([]uint16, len(h.PointFormats))
+	for i, f := range h.PointFormats {
+		formats[i] = uint16(f)
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(h.Version)),
+		joinValues(h.CipherSuites),
+		joinValues(h.Extensions),
+		joinValues(h.SupportedGroups),
+		joinValues(formats),
+	}, ",")
+}
+
+// JA3S gets the JA3S fingerprint of a ServerHello.
+func (h *ServerHello) JA3S() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(h.LegacyVersion)),
+		strconv.Itoa(int(h.CipherSuite)),
+		joinValues(h.Extensions),
+	}, ",")
+}
+
+// FingerprintHash gets the MD5 hash of a JA3 or JA3S
+// fingerprint, which is how fingerprints are usually shared.
+func FingerprintHash(fingerprint string) string {
+	sum := md5.Sum([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsGREASE reports whether a value is one of the values reserved by
+// RFC 8701 that clients send to keep servers tolerant of unknown
+// cipher suites, extensions, groups, and versions.
+func IsGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// joinValues joins values with dashes, leaving out GREASE values.
+func joinValues(values []uint16) string {
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		if !IsGREASE(v) {
+			s = append(s, strconv.Itoa(int(v)))
+		}
+	}
+	return strings.Join(s, "-")
+}
+
+func readServerName(data cryptobyte.String) (string, bool) {
+	var (
+		names      cryptobyte.String
+		serverName string
+	)
+	if !data.ReadUint16LengthPrefixed(&names) {
+		return "", false
+	}
+	for !names.Empty() {
+		var (
+			nameType uint8
+			name     cryptobyte.String
+		)
+		if !names.ReadUint8(&nameType) || !names.ReadUint16LengthPrefixed(&name) {
+			return "", false
+		}
+		if nameType == serverNameTypeHostName {
+			serverName = string(name)
+		}
+	}
+	return serverName, true
+}
+
+func readUint16List(data cryptobyte.String) ([]uint16, bool) {
+	var (
+		list   cryptobyte.String
+		values []uint16
+	)
+	if !data.ReadUint16LengthPrefixed(&list) {
+		return nil, false
+	}
+	for !list.Empty() {
+		var v uint16
+		if !list.ReadUint16(&v) {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+func readProtocols(data cryptobyte.String) ([]string, bool) {
+	var (
+		list      cryptobyte.String
+		protocols []string
+	)
+	if !data.ReadUint16LengthPrefixed(&list) {
+		return nil, false
+	}
+	for !list.Empty() {
+		var proto cryptobyte.String
+		if !list.ReadUint8LengthPrefixed(&proto) {
+			return nil, false
+		}
+		protocols = append(protocols, string(proto))
+	}
+	return protocols, true
+}
@@ -0,0 +1,278 @@
+package tlsx
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"testing"
+
+	"golang.org/x/crypto/cryptobyte"
+	"gotest.tools/v3/assert"
+)
+
+type testExtension struct {
+	typ  uint16
+	data func(b *cryptobyte.Builder)
+}
+
+func buildExtensions(b *cryptobyte.Builder, extensions []testExtension) {
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, e := range extensions {
+			b.AddUint16(e.typ)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				if e.data != nil {
+					e.data(b)
+				}
+			})
+		}
+	})
+}
+
+func buildClientHello(t *testing.T) []byte {
+	var b cryptobyte.Builder
+
+	b.AddUint16(tls.VersionTLS12)
+	b.AddBytes(make([]byte, 32))
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint16(0x0a0a)
+		b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+		b.AddUint16(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
+	})
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0)
+	})
+	buildExtensions(&b, []testExtension{
+		{typ: 0x1a1a},
+		{typ: extensionServerName, data: func(b *cryptobyte.Builder) {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint8(serverNameTypeHostName)
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes([]byte("example.com"))
+				})
+			})
+		}},
+		{typ: extensionSupportedGroups, data: func(b *cryptobyte.Builder) {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(0x2a2a)
+				b.AddUint16(uint16(tls.X25519))
+				b.AddUint16(uint16(tls.CurveP256))
+			})
+		}},
+		{typ: extensionECPointFormats, data: func(b *cryptobyte.Builder) {
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint8(0)
+			})
+		}},
+		{typ: extensionALPN, data: func(b *cryptobyte.Builder) {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, p := range []string{"h2", "http/1.1"} {
+					b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+						b.AddBytes([]byte(p))
+					})
+				}
+			})
+		}},
+		{typ: extensionSupportedVersions, data: func(b *cryptobyte.Builder) {
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(0x3a3a)
+				b.AddUint16(tls.VersionTLS13)
+				b.AddUint16(tls.VersionTLS12)
+			})
+		}},
+	})
+
+	hello, err := b.Bytes()
+	assert.NilError(t, err)
+
+	return hello
+}
+
+func buildServerHello(t *testing.T, random []byte) []byte {
+	var b cryptobyte.Builder
+
+	b.AddUint16(tls.VersionTLS12)
+	b.AddBytes(random)
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})
+	b.AddUint16(tls.TLS_AES_128_GCM_SHA256)
+	b.AddUint8(0)
+	buildExtensions(&b, []testExtension{
+		{typ: extensionSupportedVersions, data: func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS13)
+		}},
+		{typ: extensionALPN, data: func(b *cryptobyte.Builder) {
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {
+					b.AddBytes([]byte("h2"))
+				})
+			})
+		}},
+	})
+
+	hello, err := b.Bytes()
+	assert.NilError(t, err)
+
+	return hello
+}
+
+func TestParseClientHello(t *testing.T) {
+	h, err := ParseClientHello(buildClientHello(t))
+	assert.NilError(t, err)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), h.Version)
+	assert.Equal(t, "example.com", h.ServerName)
+	assert.DeepEqual(t, []string{"h2", "http/1.1"}, h.ALPN)
+	assert.DeepEqual(t, []uint16{0x0a0a, 4865, 49199}, h.CipherSuites)
+	assert.DeepEqual(t, []uint16{0x1a1a, 0, 10, 11, 16, 43}, h.Extensions)
+	assert.DeepEqual(t, []uint16{0x2a2a, 29, 23}, h.SupportedGroups)
+	assert.DeepEqual(t, []uint8{0}, h.PointFormats)
+	assert.DeepEqual(t, []uint16{0x3a3a, tls.VersionTLS13, tls.VersionTLS12}, h.SupportedVersions)
+
+	ja3 := "771,4865-49199,0-10-11-16-43,29-23,0"
+	assert.Equal(t, ja3, h.JA3())
+	assert.Equal(t, "ba56e367277299892e1a86aefd53de70", FingerprintHash(ja3))
+}
+
+func TestParseClientHelloMalformed(t *testing.T) {
+	hello := buildClientHello(t)
+	for _, n := range []int{0, 10, 40, len(hello) - 1} {
+		_, err := ParseClientHello(hello[:n])
+		assert.ErrorContains(t, err, "malformed hello")
+	}
+}
+
+func TestParseServerHello(t *testing.T) {
+	h, err := ParseServerHello(buildServerHello(t, make([]byte, 32)))
+	assert.NilError(t, err)
+
+	assert.Equal(t, uint16(tls.VersionTLS13), h.Version)
+	assert.Equal(t, uint16(tls.VersionTLS12), h.LegacyVersion)
+	assert.Equal(t, uint16(tls.TLS_AES_128_GCM_SHA256), h.CipherSuite)
+	assert.Equal(t, "h2", h.ALPN)
+	assert.Assert(t, !h.IsHelloRetryRequest())
+	assert.Equal(t, "771,4865,43-16", h.JA3S())
+
+	h, err = ParseServerHello(buildServerHello(t, helloRetryRequestRandom))
+	assert.NilError(t, err)
+	assert.Assert(t, h.IsHelloRetryRequest())
+}
+
+func TestIsGREASE(t *testing.T) {
+	cases := []struct {
+		v      uint16
+		grease bool
+	}{
+		{v: 0x0a0a, grease: true},
+		{v: 0xfafa, grease: true},
+		{v: 0x0a1a},
+		{v: 0x1301},
+		{v: 0},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.grease, IsGREASE(c.v), "%#04x", c.v)
+	}
+}
+
+func record(typ uint8, fragment []byte) []byte {
+	return append([]byte{typ, 3, 3, byte(len(fragment) >> 8), byte(len(fragment))}, fragment...)
+}
+
+func message(typ uint8, body []byte) []byte {
+	n := len(body)
+	return append([]byte{typ, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+}
+
+func TestHandshakeReader(t *testing.T) {
+	var (
+		clientHello = message(TypeClientHello, []byte("client"))
+		serverHello = message(TypeServerHello, []byte("server"))
+		retry       = message(TypeServerHello, append([]byte{3, 3}, helloRetryRequestRandom...))
+		ccs         = record(recordTypeChangeCipherSpec, []byte{1})
+		encrypted   = record(recordTypeHandshake, []byte("encrypted"))
+	)
+
+	cases := []struct {
+		desc  string
+		data  []byte
+		types []uint8
+		err   error
+	}{
+		{
+			desc:  "one message",
+			data:  record(recordTypeHandshake, clientHello),
+			types: []uint8{TypeClientHello},
+			err:   io.EOF,
+		},
+		{
+			desc: "message spanning records",
+			data: bytes.Join([][]byte{
+				record(recordTypeHandshake, clientHello[:3]),
+				record(recordTypeHandshake, clientHello[3:]),
+			}, nil),
+			types: []uint8{TypeClientHello},
+			err:   io.EOF,
+		},
+		{
+			desc:  "messages sharing a record",
+			data:  record(recordTypeHandshake, append(append([]byte{}, serverHello...), message(TypeServerHelloDone, nil)...)),
+			types: []uint8{TypeServerHello, TypeServerHelloDone},
+			err:   io.EOF,
+		},
+		{
+			desc:  "change cipher spec",
+			data:  bytes.Join([][]byte{record(recordTypeHandshake, serverHello), ccs, encrypted}, nil),
+			types: []uint8{TypeServerHello},
+			err:   io.EOF,
+		},
+		{
+			desc: "hello retry request",
+			data: bytes.Join([][]byte{
+				record(recordTypeHandshake, retry),
+				ccs,
+				record(recordTypeHandshake, serverHello),
+				ccs,
+				encrypted,
+			}, nil),
+			types: []uint8{TypeServerHello, TypeServerHello},
+			err:   io.EOF,
+		},
+		{
+			desc: "not tls",
+			data: []byte("GET / HTTP/1.1\r\n\r\n"),
+			err:  ErrNotHandshake,
+		},
+		{
+			desc: "short",
+			data: []byte{recordTypeHandshake, 3},
+			err:  ErrNotHandshake,
+		},
+		{
+			desc: "truncated",
+			data: record(recordTypeHandshake, clientHello)[:8],
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			desc: "empty",
+			err:  io.EOF,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			var (
+				r     = NewHandshakeReader(bytes.NewReader(c.data))
+				types []uint8
+				err   error
+			)
+			for {
+				var typ uint8
+				if typ, _, err = r.Next(); err != nil {
+					break
+				}
+				types = append(types, typ)
+			}
+			assert.DeepEqual(t, c.types, types)
+			assert.Assert(t, errors.Is(err, c.err), "%v", err)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package tlsx
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Key log labels, as defined by the NSS key log format.
+const (
+	labelClientRandom                 = "CLIENT_RANDOM"
+	labelClientHandshakeTrafficSecret = "CLIENT_HANDSHAKE_TRAFFIC_SECRET"
+	labelServerHandshakeTrafficSecret = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+	labelClientTrafficSecret0         = "CLIENT_TRAFFIC_SECRET_0"
+	labelServerTrafficSecret0         = "SERVER_TRAFFIC_SECRET_0"
+)
+
+// secrets are the secrets logged for a connection. Only the master
+// secret is logged for TLS 1.2; the traffic secrets are logged
+// for TLS 1.3.
+type secrets struct {
+	master          []byte
+	clientHandshake []byte
+	serverHandshake []byte
+	clientTraffic   []byte
+	serverTraffic   []byte
+}
+
+// KeyLog is a set of secrets read from a key log file, keyed by the
+// client random of their connection. Key logs are often appended to
+// while traffic is captured, so the file is read again when the
+// secrets of a connection are not found and the file has changed.
+type KeyLog struct {
+	path string
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	secrets map[string]*secrets
+}
+
+// LoadKeyLog loads a key log file.
+func LoadKeyLog(path string) (*KeyLog, error) {
+	k := &KeyLog{
+		path:    path,
+		secrets: make(map[string]*secrets),
+	}
+
+	if _, err := k.reload(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// ParseKeyLog parses a key log. The key log is
+// never read again.
+func ParseKeyLog(r io.Reader) (*KeyLog, error) {
+	k := &KeyLog{
+		secrets: make(map[string]*secrets),
+	}
+
+	if err := k.parse(r); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// lookup gets the secrets of the connection with a client random.
+func (k *KeyLog) lookup(clientRandom []byte) (*secrets, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key := string(clientRandom)
+
+	if s, ok := k.secrets[key]; ok {
+		return s, true
+	}
+
+	if k.path == "" {
+		return nil, false
+	}
+
+	if changed, err := k.reload(); err != nil || !changed {
+		return nil, false
+	}
+
+	s, ok := k.secrets[key]
+	return s, ok
+}
+
+// reload reads the key log file if it has changed
+// since it was last read. k.mu must be held.
+func (k *KeyLog) reload() (bool, error) {
+	info, err := os.Stat(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat key log: %w", err)
+	}
+
+	if info.ModTime().Equal(k.modTime) && info.Size() == k.size {
+		return false, nil
+	}
+
+	f, err := os.Open(k.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open key log: %w", err)
+	}
+	defer f.Close()
+
+	if err := k.parse(f); err != nil {
+		return false, err
+	}
+
+	k.modTime, k.size = info.ModTime(), info.Size()
+
+	return true, nil
+}
+
+// parse adds the secrets in a key log. Comments, blank
+// lines, and lines with unknown labels are ignored.
+func (k *KeyLog) parse(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("invalid key log line %d", n)
+		}
+
+		clientRandom, err := hex.DecodeString(fields[1])
+		if err != nil {
+			return fmt.Errorf("invalid client random on key log line %d: %w", n, err)
+		}
+
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return fmt.Errorf("invalid secret on key log line %d: %w", n, err)
+		}
+
+		key := string(clientRandom)
+
+		// Secrets are copied rather than updated since they
+		// may be in use by connections while the file is read.
+		sec := &secrets{}
+		if old, ok := k.secrets[key]; ok {
+			*sec = *old
+		}
+
+		switch fields[0] {
+		case labelClientRandom:
+			sec.master = secret
+		case labelClientHandshakeTrafficSecret:
+			sec.clientHandshake = secret
+		case labelServerHandshakeTrafficSecret:
+			sec.serverHandshake = secret
+		case labelClientTrafficSecret0:
+			sec.clientTraffic = secret
+		case labelServerTrafficSecret0:
+			sec.serverTraffic = secret
+		default:
+			continue
+		}
+
+		k.secrets[key] = sec
+	}
+
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("failed to read key log: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package tlsx
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseKeyLog(t *testing.T) {
+	cases := []struct {
+		desc         string
+		keyLog       string
+		clientRandom string
+		secrets      *secrets
+		errContains  string
+	}{
+		{
+			desc:         "tls 1.2",
+			keyLog:       "# comment\n\nCLIENT_RANDOM 0102 aabb\n",
+			clientRandom: "\x01\x02",
+			secrets:      &secrets{master: []byte{0xaa, 0xbb}},
+		},
+		{
+			desc: "tls 1.3",
+			keyLog: "CLIENT_HANDSHAKE_TRAFFIC_SECRET 01 0a\n" +
+				"SERVER_HANDSHAKE_TRAFFIC_SECRET 01 0b\n" +
+				"CLIENT_TRAFFIC_SECRET_0 01 0c\n" +
+				"SERVER_TRAFFIC_SECRET_0 01 0d\n" +
+				"EXPORTER_SECRET 01 0e\n",
+			clientRandom: "\x01",
+			secrets: &secrets{
+				clientHandshake: []byte{0x0a},
+				serverHandshake: []byte{0x0b},
+				clientTraffic:   []byte{0x0c},
+				serverTraffic:   []byte{0x0d},
+			},
+		},
+		{
+			desc:        "missing field",
+			keyLog:      "CLIENT_RANDOM 0102\n",
+			errContains: "invalid key log line 1",
+		},
+		{
+			desc:        "invalid client random",
+			keyLog:      "CLIENT_RANDOM xx aabb\n",
+			errContains: "invalid client random on key log line 1",
+		},
+		{
+			desc:        "invalid secret",
+			keyLog:      "CLIENT_RANDOM 0102 xx\n",
+			errContains: "invalid secret on key log line 1",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			k, err := ParseKeyLog(strings.NewReader(c.keyLog))
+			if c.errContains != "" {
+				assert.ErrorContains(t, err, c.errContains)
+				return
+			}
+			assert.NilError(t, err)
+
+			s, ok := k.lookup([]byte(c.clientRandom))
+			assert.Assert(t, ok)
+			assert.DeepEqual(t, c.secrets.master, s.master)
+			assert.DeepEqual(t, c.secrets.clientHandshake, s.clientHandshake)
+			assert.DeepEqual(t, c.secrets.serverHandshake, s.serverHandshake)
+			assert.DeepEqual(t, c.secrets.clientTraffic, s.clientTraffic)
+			assert.DeepEqual(t, c.secrets.serverTraffic, s.serverTraffic)
+
+			_, ok = k.lookup([]byte("other"))
+			assert.Assert(t, !ok)
+		})
+	}
+}
+
+func TestLoadKeyLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vhs-tlsx")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys.log")
+
+	_, err = LoadKeyLog(path)
+	assert.ErrorContains(t, err, "failed to stat key log")
+
+	assert.NilError(t, ioutil.WriteFile(path, []byte("CLIENT_RANDOM 01 aa\n"), 0600))
+
+	k, err := LoadKeyLog(path)
+	assert.NilError(t, err)
+
+	_, ok := k.lookup([]byte{0x01})
+	assert.Assert(t, ok)
+	_, ok = k.lookup([]byte{0x02})
+	assert.Assert(t, !ok)
+
+	// Secrets appended to the file are found.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	assert.NilError(t, err)
+	_, err = f.WriteString("CLIENT_RANDOM 02 bb\n")
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	s, ok := k.lookup([]byte{0x02})
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, []byte{0xbb}, s.master)
+}
@@ -0,0 +1,35 @@
+// Package tlsx parses the handshakes of captured TLS connections, and
+// decrypts them using the secrets recorded in an NSS key log file,
+// such as one written by Go's tls.Config.KeyLogWriter, curl, or a
+// browser's SSLKEYLOGFILE.
+package tlsx
+
+import (
+	"crypto/tls"
+	"strconv"
+)
+
+const (
+	// MetaServerName is the server name requested by the client.
+	MetaServerName = "tls.servername"
+	// MetaVersion is the negotiated TLS version, e.g. "TLS 1.3".
+	MetaVersion = "tls.version"
+	// MetaCipherSuite is the negotiated cipher suite.
+	MetaCipherSuite = "tls.ciphersuite"
+)
+
+// VersionName gets the name of a TLS version, e.g. "TLS 1.3".
+func VersionName(v uint16) string {
+	switch v {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
+	default:
+		return "0x" + strconv.FormatUint(uint64(v), 16)
+	}
+}
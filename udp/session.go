@@ -0,0 +1,63 @@
+package udp
+
+import (
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"github.com/rename-this/vhs/internal/chanreader"
+)
+
+// sessionBufferSize is the number of datagrams that can be
+// buffered for a session before further datagrams are dropped.
+const sessionBufferSize = 64
+
+func newSession(meta *core.Meta) *session {
+	return &session{
+		meta:      meta,
+		datagrams: chanreader.New(sessionBufferSize),
+	}
+}
+
+// session is one direction of a UDP 5-tuple. Each read
+// returns at most one datagram, so formats can parse
+// one message per datagram.
+type session struct {
+	meta *core.Meta
+
+	// lastSeen and dropped are only accessed by the source.
+	lastSeen time.Time
+	dropped  int
+
+	datagrams *chanreader.Reader
+}
+
+// add hands a datagram captured at ts to the consumer. Datagrams
+// are dropped while the buffer is full so that a slow consumer
+// does not hold up the capture of other sessions.
+func (s *session) add(data []byte, ts time.Time) {
+	s.lastSeen = ts
+	if !s.datagrams.TrySend(data) && !s.datagrams.Closed() {
+		s.dropped++
+	}
+}
+
+// complete signals that there are no more datagrams.
+func (s *session) complete() {
+	s.datagrams.Complete()
+}
+
+// Read reads at most one datagram. If p is too small to hold
+// the datagram, the rest is returned by the following reads.
+func (s *session) Read(p []byte) (int, error) {
+	return s.datagrams.Read(p)
+}
+
+// Close closes the session. Any datagrams that have
+// not been read yet are discarded.
+func (s *session) Close() error {
+	return s.datagrams.Close()
+}
+
+func (s *session) Meta() *core.Meta {
+	return s.meta
+}
@@ -0,0 +1,41 @@
+package udp
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
+
+func TestSessionClose(t *testing.T) {
+	s := newSession(core.NewMeta("", nil))
+	assert.NilError(t, s.Close())
+	assert.NilError(t, s.Close())
+
+	// Adding to a closed session does not block.
+	for i := 0; i < 2*sessionBufferSize; i++ {
+		s.add([]byte("a"), time.Time{})
+	}
+
+	b, err := ioutil.ReadAll(s)
+	assert.NilError(t, err)
+	assert.Assert(t, len(b) <= sessionBufferSize)
+}
+
+func TestSessionDrop(t *testing.T) {
+	s := newSession(core.NewMeta("", nil))
+
+	// Nothing reads the session while it is added to.
+	for i := 0; i < 2*sessionBufferSize; i++ {
+		s.add([]byte("a"), time.Time{})
+	}
+	s.complete()
+
+	assert.Equal(t, sessionBufferSize, s.dropped)
+
+	b, err := ioutil.ReadAll(s)
+	assert.NilError(t, err)
+	assert.Equal(t, sessionBufferSize, len(b))
+}
@@ -0,0 +1,227 @@
+package udp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+	"github.com/segmentio/ksuid"
+)
+
+// Direction is an enum indicating the
+// direction of a UDP session.
+type Direction int
+
+const (
+	// DirectionUp is the direction of the first datagram seen.
+	DirectionUp Direction = iota
+	// DirectionDown is the reverse direction.
+	DirectionDown
+)
+
+const (
+	// MetaDirection is a key for a flow.Meta to retrieve a direction.
+	MetaDirection = "udp.direction"
+	// MetaSrcAddr is address of the source.
+	MetaSrcAddr = "ip.srcaddr"
+	// MetaDstAddr is the address of the destination.
+	MetaDstAddr = "ip.dstaddr"
+	// MetaSrcPort is the port of the source.
+	MetaSrcPort = "udp.srcport"
+	// MetaDstPort is the port of the destination.
+	MetaDstPort = "udp.dstport"
+)
+
+// NewSource creates a new UDP source.
+func NewSource(ctx core.Context) (core.Source, error) {
+	if err := capture.ValidateFlowConfig(ctx.FlowConfig); err != nil {
+		return nil, err
+	}
+
+	return &udpSource{
+		streams:     make(chan core.InputReader),
+		newListener: capture.NewLiveUDPListener,
+	}, nil
+}
+
+type newListenerFn func(core.Context) (capture.Listener, error)
+
+// udpSource emits a reader for each direction of each UDP
+// 5-tuple. Both directions of a 5-tuple share a source ID.
+// Sessions that receive no datagrams for the UDP timeout
+// of capture time are completed.
+type udpSource struct {
+	streams     chan core.InputReader
+	newListener newListenerFn
+	sessions    map[string]*session
+}
+
+func (s *udpSource) Streams() <-chan core.InputReader {
+	return s.streams
+}
+
+func (s *udpSource) Init(ctx core.Context) {
+	s.read(ctx, s.newListener)
+}
+
+func (s *udpSource) read(ctx core.Context, newListener newListenerFn) {
+	ctx.Logger = ctx.Logger.With().
+		Str(core.LoggerKeyComponent, "udp_source").
+		Logger()
+
+	ctx.Logger.Debug().Msg("read")
+
+	listener, err := newListener(ctx)
+	if err != nil {
+		ctx.Errors <- fmt.Errorf("failed to initialize capture: %w", err)
+		return
+	}
+
+	defer listener.Close()
+
+	go listener.Listen(ctx)
+
+	s.sessions = make(map[string]*session)
+
+	var (
+		clock    capture.Clock
+		ticker   = time.Tick(ctx.FlowConfig.UDPTimeout)
+		complete = ctx.FlowConfig.SourceDurationElapsed()
+		packets  = listener.Packets()
+	)
+
+	for {
+		select {
+		case packet, more := <-packets:
+			if !more {
+				ctx.Logger.Debug().Msg("no more packets")
+				s.close(ctx)
+				return
+			}
+			if packet == nil {
+				if ctx.Config.DebugPackets {
+					ctx.Logger.Debug().Msg("nil packet")
+				}
+				return
+			}
+
+			if packet.NetworkLayer() == nil ||
+				packet.TransportLayer() == nil ||
+				packet.TransportLayer().LayerType() != layers.LayerTypeUDP {
+				if ctx.Config.DebugPackets {
+					ctx.Logger.Debug().Str("p", packet.String()).Msg("wrong packet layers")
+				}
+				continue
+			}
+
+			var (
+				udp       = packet.TransportLayer().(*layers.UDP)
+				net       = packet.NetworkLayer().NetworkFlow()
+				transport = udp.TransportFlow()
+				ts        = clock.Observe(packet.Metadata().Timestamp)
+			)
+
+			// The payload may share memory with the packet data.
+			data := make([]byte, len(udp.Payload))
+			copy(data, udp.Payload)
+
+			sess, ok := s.session(ctx, net, transport)
+			if !ok {
+				return
+			}
+
+			sess.add(data, ts)
+
+		case <-ticker:
+			ctx.Logger.Debug().Msg("expiring idle sessions")
+			s.expire(ctx, clock.Now().Add(-ctx.FlowConfig.UDPTimeout))
+
+		case <-complete:
+			s.close(ctx)
+			return
+
+		case <-ctx.StdContext.Done():
+			return
+		}
+	}
+}
+
+// session gets the session of a flow, creating and emitting it if
+// this is its first datagram. It returns false if the context is
+// done before a new session is emitted.
+func (s *udpSource) session(ctx core.Context, net, transport gopacket.Flow) (*session, bool) {
+	key := sessionKey(net, transport)
+	if sess, ok := s.sessions[key]; ok {
+		return sess, true
+	}
+
+	var (
+		id = ksuid.New().String()
+		d  = DirectionUp
+	)
+
+	if reverse, ok := s.sessions[sessionKey(net.Reverse(), transport.Reverse())]; ok {
+		id = reverse.meta.SourceID
+		d = DirectionDown
+	}
+
+	sess := newSession(core.NewMeta(id, map[string]interface{}{
+		MetaDirection: d,
+		MetaSrcAddr:   net.Src().String(),
+		MetaSrcPort:   transport.Src().String(),
+		MetaDstAddr:   net.Dst().String(),
+		MetaDstPort:   transport.Dst().String(),
+	}))
+
+	s.sessions[key] = sess
+
+	ctx.Logger.Debug().
+		Str("net", net.String()).
+		Str("trans", transport.String()).
+		Str("source_id", id).
+		Msg("created new session")
+
+	select {
+	case s.streams <- sess:
+		return sess, true
+	case <-ctx.StdContext.Done():
+		return nil, false
+	}
+}
+
+// expire completes sessions that have not seen a datagram since t.
+func (s *udpSource) expire(ctx core.Context, t time.Time) {
+	for key, sess := range s.sessions {
+		if sess.lastSeen.Before(t) {
+			ctx.Logger.Debug().Str("key", key).Msg("session expired")
+			s.complete(ctx, key, sess)
+		}
+	}
+}
+
+// close completes all sessions and closes the streams.
+func (s *udpSource) close(ctx core.Context) {
+	for key, sess := range s.sessions {
+		s.complete(ctx, key, sess)
+	}
+	close(s.streams)
+}
+
+// complete completes a session and removes it from the source.
+func (s *udpSource) complete(ctx core.Context, key string, sess *session) {
+	if sess.dropped > 0 {
+		ctx.Logger.Warn().
+			Str("key", key).
+			Int("dropped", sess.dropped).
+			Msg("dropped datagrams because the session was not read fast enough")
+	}
+	sess.complete()
+	delete(s.sessions, key)
+}
+
+func sessionKey(net, transport gopacket.Flow) string {
+	return fmt.Sprintf("%v:%v", net, transport)
+}
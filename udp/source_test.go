@@ -0,0 +1,254 @@
+package udp
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/rename-this/vhs/capture"
+	"github.com/rename-this/vhs/core"
+	"gotest.tools/v3/assert"
+)
+
+func newPacket(t *testing.T, data string, srcPort, dstPort uint16) gopacket.Packet {
+	var (
+		ipLayer = layers.IPv4{
+			SrcIP:    net.ParseIP("0.0.0.0"),
+			DstIP:    net.ParseIP("0.0.0.0"),
+			Protocol: layers.IPProtocolUDP,
+		}
+		udpLayer = layers.UDP{
+			SrcPort: layers.UDPPort(srcPort),
+			DstPort: layers.UDPPort(dstPort),
+		}
+		opts = gopacket.SerializeOptions{
+			FixLengths: true,
+		}
+		buf = gopacket.NewSerializeBuffer()
+	)
+
+	err := gopacket.SerializeLayers(buf, opts, &ipLayer, &udpLayer, gopacket.Payload(data))
+	assert.NilError(t, err)
+
+	return gopacket.NewPacket(buf.Bytes(), layers.LayerTypeIPv4, gopacket.DecodeOptions{})
+}
+
+type testListener struct {
+	packets chan gopacket.Packet
+}
+
+func (l *testListener) Packets() <-chan gopacket.Packet { return l.packets }
+func (l *testListener) Listen(ctx core.Context)         {}
+func (l *testListener) Close()                          {}
+
+func TestRead(t *testing.T) {
+	var (
+		errs    = make(chan error, 1)
+		flowCfg = &core.FlowConfig{
+			SourceDuration: time.Minute,
+			UDPTimeout:     50 * time.Millisecond,
+		}
+		ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+		l   = &testListener{
+			packets: make(chan gopacket.Packet),
+		}
+	)
+
+	source, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	s, ok := source.(*udpSource)
+	assert.Assert(t, ok)
+
+	go s.read(ctx, func(core.Context) (capture.Listener, error) {
+		return l, nil
+	})
+
+	readDatagram := func(r core.InputReader) string {
+		p := make([]byte, 64)
+		n, err := r.Read(p)
+		assert.NilError(t, err)
+		return string(p[:n])
+	}
+	readEOF := func(r core.InputReader) {
+		_, err := r.Read(make([]byte, 64))
+		assert.Equal(t, io.EOF, err)
+	}
+
+	l.packets <- newPacket(t, "query1", 1111, 53)
+	up := <-s.Streams()
+	assert.Equal(t, "query1", readDatagram(up))
+
+	l.packets <- newPacket(t, "answer1", 53, 1111)
+	down := <-s.Streams()
+	assert.Equal(t, "answer1", readDatagram(down))
+
+	l.packets <- newPacket(t, "query2", 1111, 53)
+	assert.Equal(t, "query2", readDatagram(up))
+
+	assert.Equal(t, up.Meta().SourceID, down.Meta().SourceID)
+
+	for _, c := range []struct {
+		r       core.InputReader
+		d       Direction
+		srcPort string
+		dstPort string
+	}{
+		{r: up, d: DirectionUp, srcPort: "1111", dstPort: "53"},
+		{r: down, d: DirectionDown, srcPort: "53", dstPort: "1111"},
+	} {
+		d, _ := c.r.Meta().Get(MetaDirection)
+		assert.Equal(t, c.d, d)
+		srcPort, _ := c.r.Meta().GetString(MetaSrcPort)
+		assert.Equal(t, c.srcPort, srcPort)
+		dstPort, _ := c.r.Meta().GetString(MetaDstPort)
+		assert.Equal(t, c.dstPort, dstPort)
+	}
+
+	// Idle sessions expire.
+	readEOF(up)
+	readEOF(down)
+
+	// A new datagram after expiry starts a new session.
+	l.packets <- newPacket(t, "query3", 1111, 53)
+	next := <-s.Streams()
+	assert.Equal(t, "query3", readDatagram(next))
+	assert.Assert(t, next.Meta().SourceID != up.Meta().SourceID)
+
+	close(l.packets)
+
+	_, more := <-s.Streams()
+	assert.Assert(t, !more)
+
+	readEOF(next)
+
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestReadCaptureTime(t *testing.T) {
+	var (
+		errs    = make(chan error, 1)
+		flowCfg = &core.FlowConfig{
+			SourceDuration: time.Minute,
+			UDPTimeout:     50 * time.Millisecond,
+		}
+		ctx = core.NewContext(&core.Config{}, flowCfg, errs)
+		l   = &testListener{
+			packets: make(chan gopacket.Packet),
+		}
+		t0    = time.Unix(1000, 0)
+		count = 10
+	)
+
+	source, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	go source.(*udpSource).read(ctx, func(core.Context) (capture.Listener, error) {
+		return l, nil
+	})
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		streams int
+		data    string
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := range source.Streams() {
+			wg.Add(1)
+			go func(r core.InputReader) {
+				defer wg.Done()
+				b, err := ioutil.ReadAll(r)
+				assert.Check(t, err)
+				mu.Lock()
+				defer mu.Unlock()
+				streams++
+				data += string(b)
+			}(r)
+		}
+	}()
+
+	// The datagrams were captured long ago, but they
+	// are close enough in capture time to share a session.
+	for i := 0; i < count; i++ {
+		p := newPacket(t, "a", 1111, 53)
+		p.Metadata().Timestamp = t0.Add(time.Duration(i) * 10 * time.Millisecond)
+		l.packets <- p
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(l.packets)
+	wg.Wait()
+
+	assert.Equal(t, 1, streams)
+	assert.Equal(t, strings.Repeat("a", count), data)
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestReadCancel(t *testing.T) {
+	var (
+		flowCfg = &core.FlowConfig{
+			SourceDuration: time.Minute,
+			UDPTimeout:     time.Minute,
+		}
+		ctx = core.NewContext(&core.Config{}, flowCfg, nil)
+		l   = &testListener{
+			packets: make(chan gopacket.Packet, 1),
+		}
+		done = make(chan struct{})
+	)
+
+	source, err := NewSource(ctx)
+	assert.NilError(t, err)
+
+	go func() {
+		defer close(done)
+		source.(*udpSource).read(ctx, func(core.Context) (capture.Listener, error) {
+			return l, nil
+		})
+	}()
+
+	// Nothing reads the new session's stream.
+	l.packets <- newPacket(t, "query1", 1111, 53)
+	time.Sleep(50 * time.Millisecond)
+
+	ctx.Cancel()
+	<-done
+}
+
+func TestNewSource(t *testing.T) {
+	cases := []struct {
+		desc        string
+		addr        string
+		errContains string
+	}{
+		{
+			desc: "valid",
+			addr: "0.0.0.0:53",
+		},
+		{
+			desc:        "invalid addr",
+			addr:        "0.0.0.0:dns",
+			errContains: "invalid port: dns",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			ctx := core.NewContext(&core.Config{}, &core.FlowConfig{Addr: c.addr}, nil)
+			_, err := NewSource(ctx)
+			if c.errContains == "" {
+				assert.NilError(t, err)
+			} else {
+				assert.ErrorContains(t, err, c.errContains)
+			}
+		})
+	}
+}